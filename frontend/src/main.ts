@@ -92,6 +92,7 @@ interface ChatMessage {
     sender_id: string;
     sender_username: string;
     content: string;
+    is_system?: boolean;
     created_at: string;
 }
 
@@ -182,7 +183,7 @@ async function handleLogin(event: Event): Promise<void> {
         const data = await response.json();
 
         if (!response.ok) {
-            showLoginMessage(data.error || "Login failed", "error");
+            showLoginMessage(data.error?.message || "Login failed", "error");
             return;
         }
 
@@ -209,6 +210,14 @@ async function handleLogin(event: Event): Promise<void> {
 }
 
 function handleLogout(): void {
+    // Revoke the token on the server; we log out locally either way.
+    if (authToken) {
+        fetch(`${API_URL}/api/logout`, {
+            method: "POST",
+            headers: { "Authorization": `Bearer ${authToken}` },
+        }).catch((error) => console.error("Logout error:", error));
+    }
+
     authToken = null;
     currentUserId = null;
     currentUsername = null;
@@ -457,7 +466,9 @@ function connectWebSocket(): void {
         websocket.close();
     }
 
-    websocket = new WebSocket(`${WS_URL}/ws?token=${authToken}`);
+    // Send the token as a subprotocol rather than in the URL, so it
+    // doesn't end up in server or proxy logs.
+    websocket = new WebSocket(`${WS_URL}/ws`, ["chatgo", `bearer.${authToken}`]);
 
     websocket.onopen = (): void => {
         console.log("WebSocket connected");
@@ -473,6 +484,8 @@ function connectWebSocket(): void {
         } else if (data.type === "new_conversation") {
             // Refresh conversation list when added to a new conversation
             loadUsersAndConversations();
+        } else if (data.type === "conversation_deleted") {
+            handleConversationDeleted(data.conversation_id as string);
         }
     };
 
@@ -491,6 +504,18 @@ function connectWebSocket(): void {
     };
 }
 
+// Close a conversation that was deleted and drop it from the list
+function handleConversationDeleted(conversationId: string): void {
+    unreadCounts.delete(conversationId);
+    if (conversationId === currentConversationId) {
+        currentConversationId = null;
+        messagesContainer.innerHTML = "";
+        activeChat.style.display = "none";
+        chatPlaceholder.style.display = "";
+    }
+    loadUsersAndConversations();
+}
+
 // Handle incoming chat message
 function handleIncomingMessage(msg: ChatMessage): void {
     if (msg.conversation_id === currentConversationId) {
@@ -555,7 +580,11 @@ function handleTypingIndicator(data: TypingMessage): void {
 function addMessageToUI(msg: ChatMessage): void {
     const messageDiv = document.createElement("div");
     const isSent = msg.sender_id === currentUserId;
-    messageDiv.className = `message ${isSent ? "sent" : "received"}`;
+    if (msg.is_system) {
+        messageDiv.className = "message system";
+    } else {
+        messageDiv.className = `message ${isSent ? "sent" : "received"}`;
+    }
 
     const time = new Date(msg.created_at).toLocaleTimeString([], { hour: '2-digit', minute: '2-digit' });
 
@@ -652,7 +681,8 @@ function hideAdminPanel(): void {
 // Load all users for admin management
 async function loadAdminUsers(): Promise<void> {
     try {
-        const response = await fetch(`${API_URL}/api/users`, {
+        // Admins manage bot accounts too, so include them here.
+        const response = await fetch(`${API_URL}/api/users?include_bots=true`, {
             headers: { "Authorization": `Bearer ${authToken}` }
         });
 
@@ -738,7 +768,7 @@ async function handleCreateUser(event: Event): Promise<void> {
         const data = await response.json();
 
         if (!response.ok) {
-            showCreateUserMessage(data.error || "Failed to create user", "error");
+            showCreateUserMessage(data.error?.message || "Failed to create user", "error");
             return;
         }
 
@@ -808,7 +838,7 @@ async function handleEditUser(event: Event): Promise<void> {
         const data = await response.json();
 
         if (!response.ok) {
-            showEditUserMessage(data.error || "Failed to update user", "error");
+            showEditUserMessage(data.error?.message || "Failed to update user", "error");
             return;
         }
 
@@ -845,7 +875,7 @@ async function handleDeleteUser(userId: string, username: string): Promise<void>
 
         if (!response.ok) {
             const data = await response.json();
-            alert(data.error || "Failed to delete user");
+            alert(data.error?.message || "Failed to delete user");
             return;
         }
 
@@ -924,7 +954,7 @@ async function handleCreateGroup(event: Event): Promise<void> {
 
         if (!response.ok) {
             const data = await response.json();
-            showGroupMessage(data.error || "Failed to create group", "error");
+            showGroupMessage(data.error?.message || "Failed to create group", "error");
             return;
         }
 
@@ -0,0 +1,137 @@
+// Package api - admin diagnostics handlers
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"chatgo/internal/db"
+	"chatgo/internal/models"
+	"chatgo/internal/websocket"
+)
+
+// MetricsResponse is returned by GET /api/metrics.
+type MetricsResponse struct {
+	WebSocket websocket.Stats `json:"websocket"`
+}
+
+// MetricsHandler handles GET /api/metrics (admin only)
+// Reports this server's WebSocket counters: connections, frames sent and
+// dropped on full send buffers, and bytes before and after compression.
+func MetricsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	WriteJSON(w, http.StatusOK, MetricsResponse{
+		WebSocket: websocket.GetStats(),
+	})
+}
+
+// DeliveryTraceHandler handles GET /api/admin/messages/{id}/delivery (admin only)
+// Reports, for each participant, what happened when the message was pushed
+// and whether they're online right now.
+func DeliveryTraceHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// Message ID from the route pattern /api/admin/messages/{id}/delivery
+	messageID := r.PathValue("id")
+	if !uuidPattern.MatchString(messageID) {
+		WriteError(w, http.StatusNotFound, ErrCodeNotFound, "Message not found")
+		return
+	}
+
+	trace, err := db.GetDeliveryTrace(messageID)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to get delivery trace")
+		return
+	}
+	if trace == nil {
+		WriteError(w, http.StatusNotFound, ErrCodeNotFound, "Message not found")
+		return
+	}
+
+	// Return empty array instead of null
+	if trace.Recipients == nil {
+		trace.Recipients = []models.DeliveryStatus{}
+	}
+
+	for i := range trace.Recipients {
+		trace.Recipients[i].OnlineNow = notifier.IsUserOnline(trace.Recipients[i].UserID)
+	}
+
+	WriteJSON(w, http.StatusOK, trace)
+}
+
+// Longest range the activity endpoint accepts for each bucket size.
+var maxActivityRange = map[string]time.Duration{
+	"hour": 31 * 24 * time.Hour,
+	"day":  366 * 24 * time.Hour,
+}
+
+// ActivityHandler handles GET /api/admin/activity?from=&to=&bucket=hour|day (admin only)
+// Returns message counts per bucket. from/to are RFC3339 timestamps; they
+// default to the last 24 hours (hour buckets) or 30 days (day buckets).
+func ActivityHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	query := r.URL.Query()
+
+	bucket := query.Get("bucket")
+	if bucket == "" {
+		bucket = "hour"
+	}
+	maxRange, ok := maxActivityRange[bucket]
+	if !ok {
+		WriteError(w, http.StatusBadRequest, ErrCodeBadRequest, "bucket must be hour or day")
+		return
+	}
+
+	to := time.Now()
+	if v := query.Get("to"); v != "" {
+		parsed, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			WriteError(w, http.StatusBadRequest, ErrCodeBadRequest, "to must be an RFC3339 timestamp")
+			return
+		}
+		to = parsed
+	}
+
+	from := to.Add(-24 * time.Hour)
+	if bucket == "day" {
+		from = to.Add(-30 * 24 * time.Hour)
+	}
+	if v := query.Get("from"); v != "" {
+		parsed, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			WriteError(w, http.StatusBadRequest, ErrCodeBadRequest, "from must be an RFC3339 timestamp")
+			return
+		}
+		from = parsed
+	}
+
+	if !from.Before(to) {
+		WriteError(w, http.StatusBadRequest, ErrCodeBadRequest, "from must be before to")
+		return
+	}
+	if to.Sub(from) > maxRange {
+		WriteError(w, http.StatusBadRequest, ErrCodeBadRequest, "range too large for this bucket")
+		return
+	}
+
+	buckets, err := db.GetMessageActivity(from, to, bucket)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to get activity")
+		return
+	}
+
+	// Return empty array instead of null
+	if buckets == nil {
+		buckets = []models.ActivityBucket{}
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"from":    from.UTC(),
+		"to":      to.UTC(),
+		"bucket":  bucket,
+		"buckets": buckets,
+	})
+}
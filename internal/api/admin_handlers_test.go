@@ -0,0 +1,29 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestActivityValidatesQuery(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+	}{
+		{"unknown bucket", "bucket=minute"},
+		{"bad from", "from=yesterday"},
+		{"bad to", "to=tomorrow"},
+		{"empty range", "from=2026-03-02T10:00:00Z&to=2026-03-02T10:00:00Z"},
+		{"reversed range", "from=2026-03-02T11:00:00Z&to=2026-03-02T10:00:00Z"},
+		{"too long for hours", "bucket=hour&from=2026-01-01T00:00:00Z&to=2026-03-01T00:00:00Z"},
+		{"too long for days", "bucket=day&from=2024-01-01T00:00:00Z&to=2026-01-01T00:00:00Z"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(t, "GET /api/admin/activity", ActivityHandler, "GET", "/api/admin/activity?"+tt.query, nil, nil)
+			if got := errorCode(t, rec); rec.Code != http.StatusBadRequest || got != ErrCodeBadRequest {
+				t.Errorf("status %d code %q, want 400 %s", rec.Code, got, ErrCodeBadRequest)
+			}
+		})
+	}
+}
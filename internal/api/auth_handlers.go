@@ -3,10 +3,15 @@ package api
 
 import (
 	"encoding/json"
+	"io"
+	"log"
+	"math"
 	"net/http"
+	"strconv"
 
 	"chatgo/internal/auth"
 	"chatgo/internal/db"
+	"chatgo/internal/models"
 )
 
 // LoginRequest is the expected JSON body for login.
@@ -17,66 +22,310 @@ type LoginRequest struct {
 
 // LoginResponse is what we send back after successful login.
 type LoginResponse struct {
-	Token    string `json:"token"`
-	Username string `json:"username"`
-	IsAdmin  bool   `json:"is_admin"`
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	Username     string `json:"username"`
+	IsAdmin      bool   `json:"is_admin"`
+}
+
+// RefreshRequest is the expected JSON body for refreshing an access token.
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// LogoutRequest is the optional JSON body for logout.
+// If a refresh token is given it is revoked too.
+type LogoutRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// ChangePasswordRequest is the expected JSON body for changing your own password.
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
 }
 
 // LoginHandler handles POST /api/login
 func LoginHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
-	// Only accept POST requests.
-	if r.Method != http.MethodPost {
-		http.Error(w, `{"error": "Method not allowed"}`, http.StatusMethodNotAllowed)
-		return
-	}
-
 	// Parse the JSON body.
 	var req LoginRequest
 	err := json.NewDecoder(r.Body).Decode(&req)
 	if err != nil {
-		http.Error(w, `{"error": "Invalid JSON"}`, http.StatusBadRequest)
+		WriteError(w, http.StatusBadRequest, ErrCodeInvalidJSON, "Invalid JSON")
 		return
 	}
 
 	// Validate input.
 	if req.Username == "" || req.Password == "" {
-		http.Error(w, `{"error": "Username and password required"}`, http.StatusBadRequest)
+		WriteError(w, http.StatusBadRequest, ErrCodeBadRequest, "Username and password required")
 		return
 	}
 
+	// Too many recent failures for this username or from this IP?
+	userKey, ipKey := loginLimiterKeys(r, req.Username)
+	for _, key := range []string{userKey, ipKey} {
+		if ok, retryAfter := loginLimiter.Allow(key); !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			WriteError(w, http.StatusTooManyRequests, ErrCodeRateLimited, "Too many failed login attempts, try again later")
+			return
+		}
+	}
+
 	// Find the user in the database.
 	user, err := db.GetUserByUsername(req.Username)
 	if err != nil {
-		http.Error(w, `{"error": "Database error"}`, http.StatusInternalServerError)
+		WriteError(w, http.StatusInternalServerError, ErrCodeInternal, "Database error")
 		return
 	}
-	if user == nil {
-		// User not found - but don't reveal this! Say "invalid credentials" instead.
-		http.Error(w, `{"error": "Invalid credentials"}`, http.StatusUnauthorized)
+
+	// Check the password. An unknown user counts as a failure too, and gets
+	// the same "invalid credentials" so we don't reveal which usernames exist.
+	if user == nil || !auth.CheckPassword(req.Password, user.PasswordHash) {
+		loginLimiter.Fail(userKey)
+		loginLimiter.Fail(ipKey)
+		WriteError(w, http.StatusUnauthorized, ErrCodeInvalidCredentials, "Invalid credentials")
 		return
 	}
 
-	// Check the password.
-	if !auth.CheckPassword(req.Password, user.PasswordHash) {
-		http.Error(w, `{"error": "Invalid credentials"}`, http.StatusUnauthorized)
+	// Right password, but an admin deactivated the account.
+	if !user.IsActive {
+		WriteError(w, http.StatusForbidden, ErrCodeAccountDisabled, "Account is disabled")
 		return
 	}
 
+	// Success clears the username's failures. The IP's are kept, so one valid
+	// account can't be used to keep resetting a guessing attack on others.
+	loginLimiter.Reset(userKey)
+
+	// We only see the plaintext at login, so this is when a hash made with an
+	// older, cheaper bcrypt cost gets upgraded. Failing here mustn't block the login.
+	if auth.NeedsRehash(user.PasswordHash) {
+		rehashPassword(user.ID, req.Password)
+	}
+
+	writeLoginResponse(w, user)
+}
+
+// rehashPassword stores a fresh hash of password at the current bcrypt cost.
+// Errors are logged, not returned: the old hash still works.
+func rehashPassword(userID, password string) {
+	hash, err := auth.HashPassword(password)
+	if err != nil {
+		log.Printf("Failed to rehash password for %s: %v", userID, err)
+		return
+	}
+	if _, err := db.UpdateUserPassword(userID, hash); err != nil {
+		log.Printf("Failed to store rehashed password for %s: %v", userID, err)
+	}
+}
+
+// writeLoginResponse signs the user in: it issues an access token and a
+// refresh token and writes them as a LoginResponse. In single-session mode
+// this also ends the user's other sessions.
+func writeLoginResponse(w http.ResponseWriter, user *models.User) {
 	// Generate a JWT token.
-	token, err := auth.GenerateToken(user.ID, user.Username, user.IsAdmin)
+	token, jti, err := auth.IssueToken(user.ID, user.Username, user.IsAdmin)
 	if err != nil {
-		http.Error(w, `{"error": "Failed to generate token"}`, http.StatusInternalServerError)
+		WriteError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to generate token")
+		return
+	}
+
+	if auth.SingleSession {
+		// Recording the new jti invalidates older access tokens; their refresh
+		// tokens and any open WebSocket have to go too.
+		if err := db.SetCurrentSessionID(user.ID, jti); err != nil {
+			WriteError(w, http.StatusInternalServerError, ErrCodeInternal, "Database error")
+			return
+		}
+		if err := db.RevokeUserRefreshTokens(user.ID); err != nil {
+			WriteError(w, http.StatusInternalServerError, ErrCodeInternal, "Database error")
+			return
+		}
+		notifier.DisconnectUser(user.ID)
+	}
+
+	// Generate a refresh token so the client can get new access tokens later.
+	refreshToken, refreshHash, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to generate token")
+		return
+	}
+	if err := db.CreateRefreshToken(user.ID, refreshHash, auth.RefreshTokenTTL); err != nil {
+		WriteError(w, http.StatusInternalServerError, ErrCodeInternal, "Database error")
 		return
 	}
 
 	// Send the response.
 	response := LoginResponse{
+		Token:        token,
+		RefreshToken: refreshToken,
+		Username:     user.Username,
+		IsAdmin:      user.IsAdmin,
+	}
+
+	WriteJSON(w, http.StatusOK, response)
+}
+
+// RefreshHandler handles POST /api/refresh
+// Exchanges a valid refresh token for a new access token.
+// If auth.RefreshIdleTTL is set, tokens unused for longer than that are rejected.
+func RefreshHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var req RefreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, ErrCodeInvalidJSON, "Invalid JSON")
+		return
+	}
+	if req.RefreshToken == "" {
+		WriteError(w, http.StatusBadRequest, ErrCodeBadRequest, "refresh_token required")
+		return
+	}
+
+	userID, err := db.ValidateRefreshToken(auth.HashOpaqueToken(req.RefreshToken), auth.RefreshIdleTTL)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, ErrCodeInternal, "Database error")
+		return
+	}
+	if userID == "" {
+		WriteError(w, http.StatusUnauthorized, ErrCodeInvalidToken, "Invalid or expired refresh token")
+		return
+	}
+
+	// Load the user so the new token reflects their current username/admin status.
+	user, err := db.GetUserByID(userID)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, ErrCodeInternal, "Database error")
+		return
+	}
+	if user == nil || !user.IsActive {
+		WriteError(w, http.StatusUnauthorized, ErrCodeInvalidToken, "Invalid or expired refresh token")
+		return
+	}
+
+	token, jti, err := auth.IssueToken(user.ID, user.Username, user.IsAdmin)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to generate token")
+		return
+	}
+
+	// The session carries on under the new token. Only the current session
+	// still holds a usable refresh token, so this can't revive an old one.
+	if auth.SingleSession {
+		if err := db.SetCurrentSessionID(user.ID, jti); err != nil {
+			WriteError(w, http.StatusInternalServerError, ErrCodeInternal, "Database error")
+			return
+		}
+	}
+
+	WriteJSON(w, http.StatusOK, LoginResponse{
 		Token:    token,
 		Username: user.Username,
 		IsAdmin:  user.IsAdmin,
+	})
+}
+
+// LogoutHandler handles POST /api/logout
+// Revokes the access token used for this request (and the refresh token,
+// if one is sent) so neither can be used again.
+func LogoutHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	user := GetUserFromContext(r)
+	if user == nil {
+		WriteError(w, http.StatusUnauthorized, ErrCodeUnauthorized, "User not authenticated")
+		return
+	}
+
+	// The body is optional; an empty one just logs out the access token.
+	var req LogoutRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		WriteError(w, http.StatusBadRequest, ErrCodeInvalidJSON, "Invalid JSON")
+		return
+	}
+
+	if req.RefreshToken != "" {
+		if err := db.RevokeRefreshToken(auth.HashOpaqueToken(req.RefreshToken), user.UserID); err != nil {
+			WriteError(w, http.StatusInternalServerError, ErrCodeInternal, "Database error")
+			return
+		}
+	}
+
+	// Tokens issued before jti was added can't be revoked; they simply expire.
+	if user.ID != "" && user.ExpiresAt != nil {
+		auth.RevokeToken(user.ID, user.ExpiresAt.Time)
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]string{"message": "Logged out"})
+}
+
+// ChangePasswordHandler handles POST /api/password
+// Lets the logged-in user change their own password. The user always comes
+// from the token, never from the body, so nobody can change someone else's.
+func ChangePasswordHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	user := GetUserFromContext(r)
+	if user == nil {
+		WriteError(w, http.StatusUnauthorized, ErrCodeUnauthorized, "User not authenticated")
+		return
+	}
+
+	var req ChangePasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, ErrCodeInvalidJSON, "Invalid JSON")
+		return
+	}
+	if req.NewPassword == "" {
+		WriteError(w, http.StatusBadRequest, ErrCodeBadRequest, "new_password required")
+		return
+	}
+
+	existing, err := db.GetUserByID(user.UserID)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, ErrCodeInternal, "Database error")
+		return
+	}
+	if existing == nil {
+		WriteError(w, http.StatusUnauthorized, ErrCodeUnauthorized, "User not found")
+		return
+	}
+
+	// Prove it's really them before changing anything.
+	if !auth.CheckPassword(req.CurrentPassword, existing.PasswordHash) {
+		WriteError(w, http.StatusUnauthorized, ErrCodeInvalidCredentials, "Current password is incorrect")
+		return
+	}
+	if req.NewPassword == req.CurrentPassword {
+		WriteError(w, http.StatusBadRequest, ErrCodeBadRequest, "New password must be different from the current one")
+		return
 	}
 
-	json.NewEncoder(w).Encode(response)
+	if err := auth.ValidatePassword(req.NewPassword); err != nil {
+		WriteError(w, http.StatusBadRequest, ErrCodeWeakPassword, err.Error())
+		return
+	}
+
+	hash, err := auth.HashPassword(req.NewPassword)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to hash password")
+		return
+	}
+
+	updated, err := db.UpdateUserPassword(user.UserID, hash)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to update password")
+		return
+	}
+	if !updated {
+		WriteError(w, http.StatusUnauthorized, ErrCodeUnauthorized, "User not found")
+		return
+	}
+
+	// Leave a record on every session, so a change the user didn't make stands out.
+	notifyUser(user.UserID, models.NotificationPasswordChanged, nil)
+
+	WriteJSON(w, http.StatusOK, map[string]string{"message": "Password changed"})
 }
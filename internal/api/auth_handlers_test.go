@@ -0,0 +1,99 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"chatgo/internal/auth"
+	"chatgo/internal/db"
+	"chatgo/internal/dbtest"
+)
+
+// login logs username in with testPassword and returns the response.
+func login(t *testing.T, username string) LoginResponse {
+	t.Helper()
+	var resp LoginResponse
+	decode(t, serve(t, "POST /api/login", LoginHandler, "POST", "/api/login",
+		LoginRequest{Username: username, Password: testPassword}, nil), http.StatusOK, &resp)
+	if resp.RefreshToken == "" {
+		t.Fatal("login returned no refresh token")
+	}
+	return resp
+}
+
+// withRefreshIdleTTL sets auth.RefreshIdleTTL for the rest of the test.
+func withRefreshIdleTTL(t *testing.T, ttl time.Duration) {
+	saved := auth.RefreshIdleTTL
+	auth.RefreshIdleTTL = ttl
+	t.Cleanup(func() { auth.RefreshIdleTTL = saved })
+}
+
+func refresh(t *testing.T, refreshToken string) *httptest.ResponseRecorder {
+	t.Helper()
+	return serve(t, "POST /api/refresh", RefreshHandler, "POST", "/api/refresh",
+		RefreshRequest{RefreshToken: refreshToken}, nil)
+}
+
+func TestRefreshWithinIdleWindow(t *testing.T) {
+	dbtest.Open(t)
+	withRefreshIdleTTL(t, time.Hour)
+	newUser(t, "alice")
+	session := login(t, "alice")
+
+	var resp LoginResponse
+	decode(t, refresh(t, session.RefreshToken), http.StatusOK, &resp)
+	if _, err := auth.ValidateToken(resp.Token); err != nil {
+		t.Errorf("refreshed token doesn't validate: %v", err)
+	}
+}
+
+func TestRefreshPastIdleWindowIsRejected(t *testing.T) {
+	dbtest.Open(t)
+	withRefreshIdleTTL(t, time.Hour)
+	newUser(t, "alice")
+	session := login(t, "alice")
+
+	// The tab was left alone for two hours.
+	_, err := db.DB.Exec(`UPDATE refresh_tokens SET last_used_at = NOW() - INTERVAL '2 hours' WHERE token_hash = $1`,
+		auth.HashOpaqueToken(session.RefreshToken))
+	if err != nil {
+		t.Fatalf("failed to age refresh token: %v", err)
+	}
+
+	rec := refresh(t, session.RefreshToken)
+	if rec.Code != http.StatusUnauthorized || errorCode(t, rec) != ErrCodeInvalidToken {
+		t.Errorf("idle refresh: status %d %s, want 401 %s", rec.Code, rec.Body, ErrCodeInvalidToken)
+	}
+}
+
+func TestRefreshKeepsSessionActive(t *testing.T) {
+	dbtest.Open(t)
+	withRefreshIdleTTL(t, time.Hour)
+	newUser(t, "alice")
+	session := login(t, "alice")
+	hash := auth.HashOpaqueToken(session.RefreshToken)
+
+	// Used 50 minutes ago: still inside the window, and refreshing restarts it.
+	if _, err := db.DB.Exec(`UPDATE refresh_tokens SET last_used_at = NOW() - INTERVAL '50 minutes' WHERE token_hash = $1`, hash); err != nil {
+		t.Fatalf("failed to age refresh token: %v", err)
+	}
+	decode(t, refresh(t, session.RefreshToken), http.StatusOK, nil)
+
+	var idle time.Duration
+	err := db.DB.QueryRow(`SELECT (EXTRACT(EPOCH FROM NOW() - last_used_at) * 1e9)::bigint FROM refresh_tokens WHERE token_hash = $1`, hash).Scan(&idle)
+	if err != nil {
+		t.Fatalf("failed to read last_used_at: %v", err)
+	}
+	if idle > time.Minute {
+		t.Errorf("last_used_at is %v old after a refresh, want just now", idle)
+	}
+}
+
+func TestRefreshRequiresToken(t *testing.T) {
+	rec := refresh(t, "")
+	if rec.Code != http.StatusBadRequest || errorCode(t, rec) != ErrCodeBadRequest {
+		t.Errorf("status %d %s, want 400 %s", rec.Code, rec.Body, ErrCodeBadRequest)
+	}
+}
@@ -0,0 +1,83 @@
+// Package api - user block handlers
+package api
+
+import (
+	"net/http"
+
+	"chatgo/internal/db"
+)
+
+// BlockUserHandler handles POST /api/users/{id}/block
+// Blocks a user for the caller: no new 1:1 conversations between them, and
+// the caller stops receiving their messages. The blocked user isn't told.
+func BlockUserHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// Get current user from context
+	user := GetUserFromContext(r)
+	if user == nil {
+		WriteError(w, http.StatusUnauthorized, ErrCodeUnauthorized, "User not authenticated")
+		return
+	}
+
+	// User ID from the route pattern /api/users/{id}/block
+	blockedID := r.PathValue("id")
+
+	if blockedID == user.UserID {
+		WriteError(w, http.StatusBadRequest, ErrCodeBadRequest, "Cannot block yourself")
+		return
+	}
+	if blockedID == db.SystemUserID {
+		WriteError(w, http.StatusBadRequest, ErrCodeBadRequest, "Cannot block the system user")
+		return
+	}
+
+	blocked, err := db.GetUserByID(blockedID)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, ErrCodeInternal, "Database error")
+		return
+	}
+	if blocked == nil {
+		WriteError(w, http.StatusNotFound, ErrCodeNotFound, "User not found")
+		return
+	}
+
+	if err := db.BlockUser(user.UserID, blockedID); err != nil {
+		WriteError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to block user")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]string{
+		"message": "User blocked",
+	})
+}
+
+// UnblockUserHandler handles DELETE /api/users/{id}/block
+// Lifts a block the caller placed earlier.
+func UnblockUserHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// Get current user from context
+	user := GetUserFromContext(r)
+	if user == nil {
+		WriteError(w, http.StatusUnauthorized, ErrCodeUnauthorized, "User not authenticated")
+		return
+	}
+
+	// User ID from the route pattern /api/users/{id}/block
+	blockedID := r.PathValue("id")
+
+	ok, err := db.UnblockUser(user.UserID, blockedID)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to unblock user")
+		return
+	}
+	if !ok {
+		WriteError(w, http.StatusNotFound, ErrCodeNotFound, "User is not blocked")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]string{
+		"message": "User unblocked",
+	})
+}
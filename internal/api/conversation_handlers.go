@@ -4,11 +4,10 @@ package api
 import (
 	"encoding/json"
 	"net/http"
-	"strings"
+	"strconv"
 
 	"chatgo/internal/db"
 	"chatgo/internal/models"
-	"chatgo/internal/websocket"
 )
 
 // CreateConversationRequest is the request body for creating/getting a conversation.
@@ -18,22 +17,48 @@ type CreateConversationRequest struct {
 	Name           string   `json:"name,omitempty"`            // Group name (required for groups)
 }
 
+// UnknownUsersResponse is the 400 body when a request names users that don't
+// exist: an ErrorResponse plus the offending IDs.
+type UnknownUsersResponse struct {
+	Error          ErrorBody `json:"error"`
+	UnknownUserIDs []string  `json:"unknown_user_ids"`
+}
+
+// requireUsersExist writes a 400 listing any of ids that aren't real users.
+// Returns false if it wrote a response and the handler should stop.
+func requireUsersExist(w http.ResponseWriter, ids []string) bool {
+	unknown, err := db.UsersExist(ids)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, ErrCodeInternal, "Database error")
+		return false
+	}
+	if len(unknown) > 0 {
+		WriteJSON(w, http.StatusBadRequest, UnknownUsersResponse{
+			Error:          ErrorBody{Code: ErrCodeUnknownUsers, Message: "Unknown user IDs"},
+			UnknownUserIDs: unknown,
+		})
+		return false
+	}
+	return true
+}
+
 // CreateConversationHandler handles POST /api/conversations
-// Gets or creates a conversation between users (1:1 or group).
+// Gets or creates a conversation between users (1:1 or group) and returns it
+// with its participants, in the same shape as GET /api/conversations.
 func CreateConversationHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
 	// Get current user from context
 	user := GetUserFromContext(r)
 	if user == nil {
-		http.Error(w, `{"error": "User not authenticated"}`, http.StatusUnauthorized)
+		WriteError(w, http.StatusUnauthorized, ErrCodeUnauthorized, "User not authenticated")
 		return
 	}
 
 	// Parse request
 	var req CreateConversationRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, `{"error": "Invalid JSON"}`, http.StatusBadRequest)
+		WriteError(w, http.StatusBadRequest, ErrCodeInvalidJSON, "Invalid JSON")
 		return
 	}
 
@@ -41,11 +66,19 @@ func CreateConversationHandler(w http.ResponseWriter, r *http.Request) {
 	if len(req.ParticipantIDs) > 0 {
 		// Group conversation
 		if req.Name == "" {
-			http.Error(w, `{"error": "name required for group conversations"}`, http.StatusBadRequest)
+			WriteError(w, http.StatusBadRequest, ErrCodeBadRequest, "name required for group conversations")
 			return
 		}
 
-		// Ensure current user is included in participant list
+		// Check the size before building anything from the client-supplied list.
+		// (Minus one because the creator is added below.)
+		if len(req.ParticipantIDs) > db.MaxGroupSize-1 {
+			WriteError(w, http.StatusBadRequest, ErrCodeBadRequest, "too many participants")
+			return
+		}
+
+		// Ensure current user is included in participant list, and drop
+		// duplicates (including the creator listing themselves)
 		participantSet := make(map[string]bool)
 		participantSet[user.UserID] = true
 		for _, id := range req.ParticipantIDs {
@@ -58,116 +91,492 @@ func CreateConversationHandler(w http.ResponseWriter, r *http.Request) {
 			participants = append(participants, id)
 		}
 
-		if len(participants) < 2 {
-			http.Error(w, `{"error": "group requires at least 2 participants"}`, http.StatusBadRequest)
+		// A group is the creator plus at least two others; with just one
+		// other person it would be a 1:1 conversation under another name.
+		if len(participants) < db.MinGroupSize {
+			WriteError(w, http.StatusBadRequest, ErrCodeGroupTooSmall, db.ErrGroupTooFewParticipants.Error())
+			return
+		}
+
+		// Catch stale or mistyped IDs here, rather than as a foreign key error.
+		if !requireUsersExist(w, participants) {
 			return
 		}
 
-		conversation, err := db.CreateGroupConversation(req.Name, participants)
+		conversation, err := db.CreateGroupConversation(req.Name, user.UserID, participants)
+		if err == db.ErrGroupTooFewParticipants {
+			WriteError(w, http.StatusBadRequest, ErrCodeGroupTooSmall, err.Error())
+			return
+		}
+		if err == db.ErrGroupTooManyParticipants {
+			WriteError(w, http.StatusBadRequest, ErrCodeBadRequest, "too many participants")
+			return
+		}
 		if err != nil {
-			http.Error(w, `{"error": "Failed to create group conversation"}`, http.StatusInternalServerError)
+			WriteError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to create group conversation")
 			return
 		}
 
 		// Notify all participants about the new conversation
-		websocket.NotifyNewConversation(conversation.ID, participants)
+		notifier.NotifyNewConversation(conversation.ID, participants)
+
+		// Leave a durable notice for everyone who was added by someone else.
+		for _, id := range participants {
+			if id != user.UserID {
+				notifyUser(id, models.NotificationAddedToConversation, map[string]string{
+					"conversation_id": conversation.ID,
+					"name":            conversation.Name,
+					"added_by":        user.Username,
+				})
+			}
+		}
 
-		json.NewEncoder(w).Encode(conversation)
+		writeConversation(w, r, user.UserID, conversation.ID)
 		return
 	}
 
 	// 1:1 conversation
 	if req.OtherUserID == "" {
-		http.Error(w, `{"error": "other_user_id or participant_ids required"}`, http.StatusBadRequest)
+		WriteError(w, http.StatusBadRequest, ErrCodeBadRequest, "other_user_id or participant_ids required")
+		return
+	}
+
+	if req.OtherUserID == user.UserID {
+		WriteError(w, http.StatusBadRequest, ErrCodeSelfConversation, "cannot create a conversation with yourself")
+		return
+	}
+
+	if !requireUsersExist(w, []string{req.OtherUserID}) {
 		return
 	}
 
 	// Get or create the conversation
 	conversation, err := db.GetOrCreateConversation(user.UserID, req.OtherUserID)
+	if err == db.ErrBlocked {
+		WriteError(w, http.StatusForbidden, ErrCodeBlocked, "Cannot start a conversation with this user")
+		return
+	}
 	if err != nil {
-		http.Error(w, `{"error": "Failed to create conversation"}`, http.StatusInternalServerError)
+		WriteError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to create conversation")
 		return
 	}
 
 	// Notify both users about the conversation (harmless if it already existed)
-	websocket.NotifyNewConversation(conversation.ID, []string{user.UserID, req.OtherUserID})
+	notifier.NotifyNewConversation(conversation.ID, []string{user.UserID, req.OtherUserID})
+
+	writeConversation(w, r, user.UserID, conversation.ID)
+}
+
+// writeConversation responds with a conversation as userID sees it in their
+// conversation list, participants included, so a client can render a
+// conversation it just created without fetching the list again.
+func writeConversation(w http.ResponseWriter, r *http.Request, userID, conversationID string) {
+	conversation, err := db.GetUserConversationContext(r.Context(), userID, conversationID)
+	if err != nil || conversation == nil {
+		WriteError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to load conversation")
+		return
+	}
 
-	json.NewEncoder(w).Encode(conversation)
+	WriteJSON(w, http.StatusOK, conversation)
 }
 
+// MaxConversationPageSize is the largest ?limit= accepted by GET /api/conversations.
+const MaxConversationPageSize = 200
+
 // GetConversationsHandler handles GET /api/conversations
-// Returns all conversations for the current user.
+// Returns the current user's conversations, most recently active first.
+// Optional ?type=direct or ?type=group limits the list to one kind.
+// Without ?limit= every conversation is returned; with it, at most
+// MaxConversationPageSize per page, starting after ?offset=. If there may be
+// more, the X-Next-Offset header holds the offset of the next page.
+// ?envelope=true wraps the list in a Page with the total count.
 func GetConversationsHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
 	// Get current user from context
 	user := GetUserFromContext(r)
 	if user == nil {
-		http.Error(w, `{"error": "User not authenticated"}`, http.StatusUnauthorized)
+		WriteError(w, http.StatusUnauthorized, ErrCodeUnauthorized, "User not authenticated")
+		return
+	}
+
+	convType := r.URL.Query().Get("type")
+	if convType != "" && convType != models.ConversationTypeDirect && convType != models.ConversationTypeGroup {
+		WriteError(w, http.StatusBadRequest, ErrCodeBadRequest, "type must be 'direct' or 'group'")
 		return
 	}
 
+	limit := 0
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			WriteError(w, http.StatusBadRequest, ErrCodeBadRequest, "limit must be a positive integer")
+			return
+		}
+		limit = min(n, MaxConversationPageSize)
+	}
+
+	offset := 0
+	if v := r.URL.Query().Get("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			WriteError(w, http.StatusBadRequest, ErrCodeBadRequest, "offset must be a non-negative integer")
+			return
+		}
+		offset = n
+	}
+
 	// Get user's conversations
-	conversations, err := db.GetUserConversations(user.UserID)
+	conversations, err := db.GetUserConversationsContext(r.Context(), user.UserID, convType, limit, offset)
 	if err != nil {
-		http.Error(w, `{"error": "Failed to get conversations"}`, http.StatusInternalServerError)
+		WriteError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to get conversations")
 		return
 	}
 
+	// A full page means there may be more.
+	if limit > 0 && len(conversations) == limit {
+		w.Header().Set("X-Next-Offset", strconv.Itoa(offset+limit))
+	}
+
 	// Return empty array instead of null
 	if conversations == nil {
 		conversations = []models.ConversationWithParticipants{}
 	}
 
-	json.NewEncoder(w).Encode(conversations)
+	if !wantsEnvelope(r) {
+		WriteJSON(w, http.StatusOK, conversations)
+		return
+	}
+
+	total, err := db.CountUserConversations(user.UserID, convType)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to get conversations")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, Page{Data: conversations, Total: total, Limit: limit, Offset: offset})
+}
+
+// ReadAllConversationsHandler handles POST /api/conversations/read-all
+// Marks every conversation the current user is in as read up to its latest
+// message, tells the other participants, and returns how many changed.
+func ReadAllConversationsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// Get current user from context
+	user := GetUserFromContext(r)
+	if user == nil {
+		WriteError(w, http.StatusUnauthorized, ErrCodeUnauthorized, "User not authenticated")
+		return
+	}
+
+	states, err := db.MarkAllConversationsRead(user.UserID)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to mark conversations read")
+		return
+	}
+
+	for i := range states {
+		notifier.BroadcastReadReceipt(&states[i])
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]int{
+		"count": len(states),
+	})
 }
 
 // GetMessagesHandler handles GET /api/conversations/{id}/messages
+// Returns a page of messages, oldest first (?order=desc for newest first).
+// Without parameters that's the latest DefaultMessagePageSize messages. If there may be older messages, the
+// X-Next-Cursor header holds an opaque cursor; pass it back as ?before= to
+// get the previous page, optionally with ?limit= (at most MaxMessagePageSize).
+// ?offset= skips that many of the newest messages (below the cursor, if any),
+// and ?envelope=true wraps the page in a Page with the total count.
 func GetMessagesHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
 	// Get current user from context
 	user := GetUserFromContext(r)
 	if user == nil {
-		http.Error(w, `{"error": "User not authenticated"}`, http.StatusUnauthorized)
+		WriteError(w, http.StatusUnauthorized, ErrCodeUnauthorized, "User not authenticated")
 		return
 	}
 
-	// Extract conversation ID from URL
-	// URL: /api/conversations/{id}/messages
-	path := r.URL.Path
-	parts := strings.Split(path, "/")
+	// Conversation ID from the route pattern /api/conversations/{id}/messages
+	conversationID := r.PathValue("id")
+
+	limit := DefaultMessagePageSize
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			WriteError(w, http.StatusBadRequest, ErrCodeBadRequest, "limit must be a positive integer")
+			return
+		}
+		limit = min(n, MaxMessagePageSize)
+	}
 
-	// Expected: ["", "api", "conversations", "{id}", "messages"]
-	if len(parts) < 5 {
-		http.Error(w, `{"error": "Invalid URL"}`, http.StatusBadRequest)
+	offset := 0
+	if v := r.URL.Query().Get("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			WriteError(w, http.StatusBadRequest, ErrCodeBadRequest, "offset must be a non-negative integer")
+			return
+		}
+		offset = n
+	}
+
+	var newestFirst bool
+	switch r.URL.Query().Get("order") {
+	case "", "asc":
+	case "desc":
+		newestFirst = true
+	default:
+		WriteError(w, http.StatusBadRequest, ErrCodeBadRequest, "order must be 'asc' or 'desc'")
 		return
 	}
 
-	conversationID := parts[3]
+	var before *db.MessageCursor
+	if v := r.URL.Query().Get("before"); v != "" {
+		cursor, err := db.DecodeMessageCursor(v)
+		if err != nil {
+			WriteError(w, http.StatusBadRequest, ErrCodeInvalidCursor, "Invalid before cursor")
+			return
+		}
+		before = &cursor
+	}
+
+	// Anything that isn't a UUID can't name a conversation.
+	if !uuidPattern.MatchString(conversationID) {
+		WriteError(w, http.StatusNotFound, ErrCodeNotFound, "Conversation not found")
+		return
+	}
 
 	// Verify user is in this conversation
 	isParticipant, err := db.IsUserInConversation(user.UserID, conversationID)
 	if err != nil {
-		http.Error(w, `{"error": "Database error"}`, http.StatusInternalServerError)
+		WriteError(w, http.StatusInternalServerError, ErrCodeInternal, "Database error")
 		return
 	}
 	if !isParticipant {
-		http.Error(w, `{"error": "Not authorized"}`, http.StatusForbidden)
+		// Telling "doesn't exist" apart from "not yours" does reveal that a
+		// conversation ID is real. IDs are random UUIDs that only leak to
+		// people who were shown them, and existence says nothing about who is
+		// in it or what was said, so we accept that for clearer client errors.
+		exists, err := db.ConversationExists(conversationID)
+		if err != nil {
+			WriteError(w, http.StatusInternalServerError, ErrCodeInternal, "Database error")
+			return
+		}
+		if !exists {
+			WriteError(w, http.StatusNotFound, ErrCodeNotFound, "Conversation not found")
+			return
+		}
+		WriteError(w, http.StatusForbidden, ErrCodeForbidden, "Not authorized")
 		return
 	}
 
-	// Get messages (limit to 100)
-	messages, err := db.GetConversationMessages(conversationID, 100)
+	messages, err := db.GetConversationMessagesContext(r.Context(), conversationID, before, limit, offset, newestFirst)
 	if err != nil {
-		http.Error(w, `{"error": "Failed to get messages"}`, http.StatusInternalServerError)
+		WriteError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to get messages")
 		return
 	}
 
+	// A full page means there may be more; point at the oldest message we returned.
+	if len(messages) == limit {
+		oldest := &messages[0]
+		if newestFirst {
+			oldest = &messages[len(messages)-1]
+		}
+		w.Header().Set("X-Next-Cursor", db.NewMessageCursor(oldest).Encode())
+	}
+
 	// Return empty array instead of null
 	if messages == nil {
 		messages = []models.Message{}
 	}
 
-	json.NewEncoder(w).Encode(messages)
+	if !wantsEnvelope(r) {
+		WriteJSON(w, http.StatusOK, messages)
+		return
+	}
+
+	total, err := db.CountConversationMessages(conversationID)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to get messages")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, Page{Data: messages, Total: total, Limit: limit, Offset: offset})
+}
+
+// DeleteConversationHandler handles DELETE /api/conversations/{id}
+// Deletes the conversation and all its messages for everyone. Either
+// participant may delete a 1:1 conversation; a group can only be deleted by
+// its owner. Site admins may delete any conversation.
+func DeleteConversationHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// Get current user from context
+	user := GetUserFromContext(r)
+	if user == nil {
+		WriteError(w, http.StatusUnauthorized, ErrCodeUnauthorized, "User not authenticated")
+		return
+	}
+
+	// Conversation ID from the route pattern /api/conversations/{id}
+	conversationID := r.PathValue("id")
+	if !uuidPattern.MatchString(conversationID) {
+		WriteError(w, http.StatusNotFound, ErrCodeNotFound, "Conversation not found")
+		return
+	}
+
+	if !user.IsAdmin {
+		settings, err := db.GetConversationSettings(conversationID, user.UserID)
+		if err != nil {
+			WriteError(w, http.StatusInternalServerError, ErrCodeInternal, "Database error")
+			return
+		}
+		if settings == nil {
+			WriteError(w, http.StatusForbidden, ErrCodeForbidden, "Not authorized")
+			return
+		}
+		if settings.IsGroup && settings.User.Role != models.RoleOwner {
+			WriteError(w, http.StatusForbidden, ErrCodeForbidden, "Only the group owner can delete it")
+			return
+		}
+	}
+
+	participantIDs, deleted, err := db.DeleteConversation(conversationID)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to delete conversation")
+		return
+	}
+	if !deleted {
+		WriteError(w, http.StatusNotFound, ErrCodeNotFound, "Conversation not found")
+		return
+	}
+
+	notifier.NotifyConversationDeleted(conversationID, participantIDs)
+
+	WriteJSON(w, http.StatusOK, map[string]string{
+		"message": "Conversation deleted",
+	})
+}
+
+// GetConversationSettingsHandler handles GET /api/conversations/{id}/settings
+// Returns the conversation's settings plus the caller's own settings for it.
+func GetConversationSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// Get current user from context
+	user := GetUserFromContext(r)
+	if user == nil {
+		WriteError(w, http.StatusUnauthorized, ErrCodeUnauthorized, "User not authenticated")
+		return
+	}
+
+	// Conversation ID from the route pattern /api/conversations/{id}/settings
+	conversationID := r.PathValue("id")
+	if !uuidPattern.MatchString(conversationID) {
+		WriteError(w, http.StatusForbidden, ErrCodeForbidden, "Not authorized")
+		return
+	}
+
+	// Only participants get settings back; everyone else sees "not authorized".
+	settings, err := db.GetConversationSettings(conversationID, user.UserID)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, ErrCodeInternal, "Database error")
+		return
+	}
+	if settings == nil {
+		WriteError(w, http.StatusForbidden, ErrCodeForbidden, "Not authorized")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, settings)
+}
+
+// UpdateConversationSettingsRequest is the body for PUT /api/conversations/{id}/settings.
+// Only fields present in the body change.
+type UpdateConversationSettingsRequest struct {
+	Muted *bool `json:"muted,omitempty"`
+}
+
+// UpdateConversationSettingsHandler handles PUT /api/conversations/{id}/settings
+// Changes the caller's own settings for the conversation and returns the result.
+func UpdateConversationSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// Get current user from context
+	user := GetUserFromContext(r)
+	if user == nil {
+		WriteError(w, http.StatusUnauthorized, ErrCodeUnauthorized, "User not authenticated")
+		return
+	}
+
+	// Conversation ID from the route pattern /api/conversations/{id}/settings
+	conversationID := r.PathValue("id")
+	if !uuidPattern.MatchString(conversationID) {
+		WriteError(w, http.StatusForbidden, ErrCodeForbidden, "Not authorized")
+		return
+	}
+
+	var req UpdateConversationSettingsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, ErrCodeInvalidJSON, "Invalid JSON")
+		return
+	}
+
+	// Only participants have settings to change.
+	settings, err := db.GetConversationSettings(conversationID, user.UserID)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, ErrCodeInternal, "Database error")
+		return
+	}
+	if settings == nil {
+		WriteError(w, http.StatusForbidden, ErrCodeForbidden, "Not authorized")
+		return
+	}
+
+	if req.Muted != nil {
+		if err := db.SetConversationMuted(user.UserID, conversationID, *req.Muted); err != nil {
+			WriteError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to update settings")
+			return
+		}
+		settings.User.Muted = *req.Muted
+	}
+
+	WriteJSON(w, http.StatusOK, settings)
+}
+
+// GetConversationPermissionsHandler handles GET /api/conversations/{id}/permissions
+// Returns what the caller is allowed to do in the conversation.
+func GetConversationPermissionsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// Get current user from context
+	user := GetUserFromContext(r)
+	if user == nil {
+		WriteError(w, http.StatusUnauthorized, ErrCodeUnauthorized, "User not authenticated")
+		return
+	}
+
+	// Conversation ID from the route pattern /api/conversations/{id}/permissions
+	conversationID := r.PathValue("id")
+	if !uuidPattern.MatchString(conversationID) {
+		WriteError(w, http.StatusForbidden, ErrCodeForbidden, "Not authorized")
+		return
+	}
+
+	settings, err := db.GetConversationSettings(conversationID, user.UserID)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, ErrCodeInternal, "Database error")
+		return
+	}
+	if settings == nil {
+		WriteError(w, http.StatusForbidden, ErrCodeForbidden, "Not authorized")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, settings.Permissions())
 }
@@ -0,0 +1,261 @@
+package api
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"chatgo/internal/db"
+	"chatgo/internal/dbtest"
+	"chatgo/internal/models"
+)
+
+// createConversation posts req as user and decodes the created conversation.
+func createConversation(t *testing.T, user *models.User, req CreateConversationRequest) models.ConversationWithParticipants {
+	t.Helper()
+	var conv models.ConversationWithParticipants
+	decode(t, serve(t, "POST /api/conversations", CreateConversationHandler, "POST", "/api/conversations", req, user),
+		http.StatusOK, &conv)
+	return conv
+}
+
+func TestCreateConversationWithoutHub(t *testing.T) {
+	dbtest.Open(t)
+	SetNotifier(nil)
+	alice := newUser(t, "alice")
+	bob := newUser(t, "bob")
+	carol := newUser(t, "carol")
+
+	group := createConversation(t, alice, CreateConversationRequest{Name: "team", ParticipantIDs: []string{bob.ID, carol.ID}})
+	if !group.IsGroup || len(group.Participants) != 3 {
+		t.Errorf("group = %+v, want a group of 3", group)
+	}
+
+	direct := createConversation(t, alice, CreateConversationRequest{OtherUserID: bob.ID})
+	if direct.IsGroup || len(direct.Participants) != 2 {
+		t.Errorf("direct = %+v, want a 1:1 conversation", direct)
+	}
+}
+
+// getSettings fetches a conversation's settings as user.
+func getSettings(t *testing.T, user *models.User, conversationID string) models.ConversationSettings {
+	t.Helper()
+	var settings models.ConversationSettings
+	decode(t, serve(t, "GET /api/conversations/{id}/settings", GetConversationSettingsHandler,
+		"GET", "/api/conversations/"+conversationID+"/settings", nil, user), http.StatusOK, &settings)
+	return settings
+}
+
+func TestConversationSettingsCombineConversationAndUser(t *testing.T) {
+	dbtest.Open(t)
+	alice := dbtest.User(t, "alice")
+	bob := dbtest.User(t, "bob")
+	carol := dbtest.User(t, "carol")
+	dave := dbtest.User(t, "dave")
+	group := dbtest.Group(t, "team", alice, bob, carol)
+
+	if _, err := db.DB.Exec(`UPDATE conversations SET read_only = TRUE WHERE id = $1`, group.ID); err != nil {
+		t.Fatalf("failed to make group read-only: %v", err)
+	}
+	if err := db.SetConversationMuted(bob.ID, group.ID, true); err != nil {
+		t.Fatalf("SetConversationMuted: %v", err)
+	}
+
+	bobs := getSettings(t, bob, group.ID)
+	if bobs.ConversationID != group.ID || bobs.Name != "team" || !bobs.IsGroup || !bobs.ReadOnly || bobs.ParticipantCount != 3 {
+		t.Errorf("bob's conversation settings = %+v, want the read-only group of 3", bobs)
+	}
+	if bobs.User.Role != models.RoleMember || !bobs.User.Muted {
+		t.Errorf("bob's own settings = %+v, want a muted member", bobs.User)
+	}
+
+	alices := getSettings(t, alice, group.ID)
+	if !alices.ReadOnly || alices.User.Role != models.RoleOwner || alices.User.Muted {
+		t.Errorf("alice's settings = %+v, want the unmuted owner of a read-only group", alices)
+	}
+
+	rec := serve(t, "GET /api/conversations/{id}/settings", GetConversationSettingsHandler,
+		"GET", "/api/conversations/"+group.ID+"/settings", nil, dave)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("non-participant got status %d, want 403", rec.Code)
+	}
+}
+
+func TestCreateConversationRejectsOversizedGroup(t *testing.T) {
+	fake := dbtest.UseFake(t)
+	alice := &models.User{ID: "00000000-0000-0000-0000-000000000001", Username: "alice"}
+	ids := make([]string, db.MaxGroupSize)
+	for i := range ids {
+		ids[i] = fmt.Sprintf("00000000-0000-0000-0001-%012d", i)
+	}
+
+	rec := serve(t, "POST /api/conversations", CreateConversationHandler, "POST", "/api/conversations",
+		CreateConversationRequest{Name: "everyone", ParticipantIDs: ids}, alice)
+	if got := errorCode(t, rec); rec.Code != http.StatusBadRequest || got != ErrCodeBadRequest {
+		t.Errorf("status %d code %q, want 400 %s", rec.Code, got, ErrCodeBadRequest)
+	}
+	if calls := fake.Calls(""); len(calls) != 0 {
+		t.Errorf("ran %d statements for a rejected request", len(calls))
+	}
+}
+
+// listConversations returns the IDs GET /api/conversations lists for user with query.
+func listConversations(t *testing.T, user *models.User, query string) []string {
+	t.Helper()
+	var list []models.ConversationWithParticipants
+	decode(t, serve(t, "GET /api/conversations", GetConversationsHandler, "GET", "/api/conversations?"+query, nil, user),
+		http.StatusOK, &list)
+	ids := make([]string, len(list))
+	for i, c := range list {
+		ids[i] = c.ID
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+func TestListConversationsByType(t *testing.T) {
+	dbtest.Open(t)
+	alice := dbtest.User(t, "alice")
+	bob := dbtest.User(t, "bob")
+	carol := dbtest.User(t, "carol")
+	withBob := dbtest.Direct(t, alice, bob)
+	withCarol := dbtest.Direct(t, alice, carol)
+	group := dbtest.Group(t, "team", alice, bob, carol)
+
+	sorted := func(ids ...string) []string {
+		slices.Sort(ids)
+		return ids
+	}
+	if got, want := listConversations(t, alice, "type=group"), sorted(group.ID); !slices.Equal(got, want) {
+		t.Errorf("type=group listed %v, want %v", got, want)
+	}
+	if got, want := listConversations(t, alice, "type=direct"), sorted(withBob.ID, withCarol.ID); !slices.Equal(got, want) {
+		t.Errorf("type=direct listed %v, want %v", got, want)
+	}
+	if got, want := listConversations(t, alice, ""), sorted(withBob.ID, withCarol.ID, group.ID); !slices.Equal(got, want) {
+		t.Errorf("no type listed %v, want %v", got, want)
+	}
+
+	var page Page
+	decode(t, serve(t, "GET /api/conversations", GetConversationsHandler, "GET", "/api/conversations?type=direct&envelope=true", nil, alice),
+		http.StatusOK, &page)
+	if page.Total != 2 {
+		t.Errorf("type=direct total = %d, want 2", page.Total)
+	}
+}
+
+func TestListConversationsRejectsUnknownType(t *testing.T) {
+	alice := &models.User{ID: "00000000-0000-0000-0000-000000000001", Username: "alice"}
+	rec := serve(t, "GET /api/conversations", GetConversationsHandler, "GET", "/api/conversations?type=channel", nil, alice)
+	if got := errorCode(t, rec); rec.Code != http.StatusBadRequest || got != ErrCodeBadRequest {
+		t.Errorf("status %d code %q, want 400 %s", rec.Code, got, ErrCodeBadRequest)
+	}
+}
+
+// fakeConversationID is the group fakeSettings scripts.
+const fakeConversationID = "00000000-0000-0000-0000-0000000000c1"
+
+// fakeSettings scripts the settings lookup: userID has role in conversation
+// fakeConversationID, a group that is read-only if readOnly. Everyone else isn't in it.
+func fakeSettings(t *testing.T, userID, role string, readOnly bool) {
+	fake := dbtest.UseFake(t)
+	fake.On("LEFT JOIN conversation_settings", func(args []driver.Value) dbtest.Result {
+		if args[0] != fakeConversationID || args[1] != userID {
+			return dbtest.Result{}
+		}
+		return dbtest.Result{
+			Columns: []string{"id", "name", "is_group", "read_only", "created_at",
+				"count", "role", "joined_at", "muted"},
+			Rows: [][]driver.Value{{fakeConversationID, "team", true, readOnly, time.Now(), int64(3), role, time.Now(), false}},
+		}
+	})
+}
+
+func getPermissions(t *testing.T, user *models.User, conversationID string) *httptest.ResponseRecorder {
+	t.Helper()
+	return serve(t, "GET /api/conversations/{id}/permissions", GetConversationPermissionsHandler,
+		"GET", "/api/conversations/"+conversationID+"/permissions", nil, user)
+}
+
+func TestOwnerHasAllPermissions(t *testing.T) {
+	owner := &models.User{ID: "00000000-0000-0000-0000-000000000001", Username: "alice"}
+	fakeSettings(t, owner.ID, models.RoleOwner, true)
+
+	var perms models.ConversationPermissions
+	decode(t, getPermissions(t, owner, fakeConversationID), http.StatusOK, &perms)
+	want := models.ConversationPermissions{
+		CanRename: true, CanAddParticipant: true, CanRemoveParticipant: true, CanPost: true, CanPin: true,
+	}
+	if perms != want {
+		t.Errorf("owner permissions = %+v, want all true", perms)
+	}
+}
+
+func TestMemberCannotPostInReadOnlyGroup(t *testing.T) {
+	member := &models.User{ID: "00000000-0000-0000-0000-000000000002", Username: "bob"}
+	fakeSettings(t, member.ID, models.RoleMember, true)
+
+	var perms models.ConversationPermissions
+	decode(t, getPermissions(t, member, fakeConversationID), http.StatusOK, &perms)
+	if perms.CanPost || perms.CanPin || perms.CanRename || perms.CanRemoveParticipant {
+		t.Errorf("read-only group member permissions = %+v, want can_post false", perms)
+	}
+
+	outsider := &models.User{ID: "00000000-0000-0000-0000-000000000003", Username: "carol"}
+	if rec := getPermissions(t, outsider, fakeConversationID); rec.Code != http.StatusForbidden {
+		t.Errorf("non-participant got status %d, want 403", rec.Code)
+	}
+}
+
+func TestCreateGroupWithOneOtherIsRejected(t *testing.T) {
+	dbtest.UseFake(t)
+	alice := &models.User{ID: "00000000-0000-0000-0000-000000000001", Username: "alice"}
+	bob := "00000000-0000-0000-0000-000000000002"
+
+	for _, ids := range [][]string{{bob}, {bob, bob, alice.ID}} {
+		rec := serve(t, "POST /api/conversations", CreateConversationHandler, "POST", "/api/conversations",
+			CreateConversationRequest{Name: "pair", ParticipantIDs: ids}, alice)
+		if got := errorCode(t, rec); rec.Code != http.StatusBadRequest || got != ErrCodeGroupTooSmall {
+			t.Errorf("participants %v: status %d code %q, want 400 %s", ids, rec.Code, got, ErrCodeGroupTooSmall)
+		}
+	}
+}
+
+func TestNonUUIDConversationIDIsForbidden(t *testing.T) {
+	alice := &models.User{ID: "alice", Username: "alice"}
+	muted := true
+	tests := []struct {
+		pattern string
+		handler http.HandlerFunc
+		method  string
+		target  string
+		body    interface{}
+	}{
+		{"GET /api/conversations/{id}/settings", GetConversationSettingsHandler, "GET",
+			"/api/conversations/not-a-uuid/settings", nil},
+		{"PUT /api/conversations/{id}/settings", UpdateConversationSettingsHandler, "PUT",
+			"/api/conversations/not-a-uuid/settings", UpdateConversationSettingsRequest{Muted: &muted}},
+		{"GET /api/conversations/{id}/permissions", GetConversationPermissionsHandler, "GET",
+			"/api/conversations/not-a-uuid/permissions", nil},
+		{"POST /api/conversations/{id}/participants", AddParticipantHandler, "POST",
+			"/api/conversations/not-a-uuid/participants", AddParticipantRequest{UserID: "00000000-0000-0000-0000-000000000001"}},
+		{"DELETE /api/conversations/{id}/participants/{userId}", RemoveParticipantHandler, "DELETE",
+			"/api/conversations/not-a-uuid/participants/00000000-0000-0000-0000-000000000001", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			fake := dbtest.UseFake(t)
+			rec := serve(t, tt.pattern, tt.handler, tt.method, tt.target, tt.body, alice)
+			if got := errorCode(t, rec); rec.Code != http.StatusForbidden || got != ErrCodeForbidden {
+				t.Errorf("status %d code %q, want 403 %s", rec.Code, got, ErrCodeForbidden)
+			}
+			if calls := fake.Calls("conversation"); len(calls) != 0 {
+				t.Errorf("ran %d conversation queries with a non-UUID ID", len(calls))
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+// Package api - user data export handlers
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+
+	"chatgo/internal/db"
+	"chatgo/internal/models"
+)
+
+// exportFlushEvery is how many records we write between flushes to the client.
+const exportFlushEvery = 100
+
+// ExportHandler handles GET /api/me/export
+// Streams the current user's profile, conversations and sent messages as one
+// JSON document: {"user": {...}, "conversations": [...], "messages": [...]}.
+// Records are encoded one at a time straight from the database rows, so memory
+// stays bounded no matter how much data the user has.
+func ExportHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	claims := GetUserFromContext(r)
+	if claims == nil {
+		WriteError(w, http.StatusUnauthorized, ErrCodeUnauthorized, "User not authenticated")
+		return
+	}
+
+	user, err := db.GetUserByID(claims.UserID)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, ErrCodeInternal, "Database error")
+		return
+	}
+	if user == nil {
+		WriteError(w, http.StatusNotFound, ErrCodeNotFound, "User not found")
+		return
+	}
+
+	w.Header().Set("Content-Disposition", `attachment; filename="chatgo-export.json"`)
+
+	stream := newJSONStream(w)
+	stream.raw(`{"user":`)
+	stream.value(user.ToResponse())
+
+	// Once the body has started we can no longer change the status code,
+	// so errors past this point are logged and the document is cut short.
+	stream.openArray(`,"conversations":[`)
+	err = db.ForEachUserConversation(user.ID, func(conv models.Conversation) error {
+		return stream.element(conv)
+	})
+	if err != nil {
+		log.Printf("Export of user %s failed: %v", user.ID, err)
+		return
+	}
+
+	stream.openArray(`],"messages":[`)
+	err = db.ForEachUserMessage(user.ID, func(msg models.Message) error {
+		return stream.element(msg)
+	})
+	if err != nil {
+		log.Printf("Export of user %s failed: %v", user.ID, err)
+		return
+	}
+
+	stream.raw(`]}`)
+	stream.flush()
+}
+
+// jsonStream writes a JSON document incrementally, flushing as it goes.
+type jsonStream struct {
+	w       io.Writer
+	enc     *json.Encoder
+	flusher http.Flusher
+	first   bool
+	pending int
+	err     error
+}
+
+func newJSONStream(w http.ResponseWriter) *jsonStream {
+	flusher, _ := w.(http.Flusher)
+	return &jsonStream{w: w, enc: json.NewEncoder(w), flusher: flusher}
+}
+
+// raw writes literal JSON syntax (delimiters, keys).
+func (s *jsonStream) raw(text string) {
+	if s.err == nil {
+		_, s.err = io.WriteString(s.w, text)
+	}
+}
+
+// openArray writes literal JSON ending in "[" and starts a new array.
+func (s *jsonStream) openArray(text string) {
+	s.raw(text)
+	s.first = true
+}
+
+// value encodes a single value.
+func (s *jsonStream) value(v interface{}) {
+	if s.err == nil {
+		s.err = s.enc.Encode(v)
+	}
+}
+
+// element encodes an array element, adding the comma separator when needed.
+func (s *jsonStream) element(v interface{}) error {
+	if !s.first {
+		s.raw(",")
+	}
+	s.first = false
+	s.value(v)
+
+	s.pending++
+	if s.pending >= exportFlushEvery {
+		s.flush()
+	}
+	return s.err
+}
+
+// flush pushes buffered output to the client.
+func (s *jsonStream) flush() {
+	s.pending = 0
+	if s.flusher != nil && s.err == nil {
+		s.flusher.Flush()
+	}
+}
@@ -0,0 +1,88 @@
+package api
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"chatgo/internal/auth"
+	"chatgo/internal/dbtest"
+	"chatgo/internal/models"
+)
+
+// flushRecorder counts how often the handler flushes.
+type flushRecorder struct {
+	*httptest.ResponseRecorder
+	flushes int
+}
+
+func (r *flushRecorder) Flush() {
+	r.flushes++
+	r.ResponseRecorder.Flush()
+}
+
+func TestExportStreamsMessages(t *testing.T) {
+	const userID = "00000000-0000-0000-0000-000000000001"
+	const total = 5 * exportFlushEvery
+
+	fake := dbtest.UseFake(t)
+	fake.OnRows("FROM users WHERE id = $1",
+		[]string{"id", "username", "display_name", "password_hash", "is_admin",
+			"is_bot", "is_active", "avatar_url", "last_seen_at", "created_at"},
+		[]driver.Value{userID, "alice", "Alice", "!", false, false, true, "", nil, time.Now()})
+	fake.OnRows("FROM conversations c",
+		[]string{"id", "name", "created_at"},
+		[]driver.Value{"conv-1", "team", time.Now()})
+
+	rec := &flushRecorder{ResponseRecorder: httptest.NewRecorder()}
+	written, read := 0, 0
+	fake.On("FROM messages", func([]driver.Value) dbtest.Result {
+		return dbtest.Result{
+			Columns: []string{"id", "conversation_id", "sender_id", "content", "seq", "created_at"},
+			Next: func() []driver.Value {
+				// Each message must already be written out before the next row is read.
+				if read > 0 && rec.Body.Len() <= written {
+					t.Errorf("message %d was not written before reading the next row", read)
+				}
+				if read == total {
+					return nil
+				}
+				written = rec.Body.Len()
+				read++
+				return []driver.Value{fmt.Sprintf("msg-%d", read), "conv-1", userID, "hello", int64(read), time.Now()}
+			},
+		}
+	})
+
+	token, err := auth.GenerateToken(userID, "alice", false)
+	if err != nil {
+		t.Fatalf("GenerateToken: %v", err)
+	}
+	req := httptest.NewRequest("GET", "/api/me/export", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	AuthMiddleware(ExportHandler)(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d; body: %s", rec.Code, rec.Body)
+	}
+	if rec.flushes < total/exportFlushEvery {
+		t.Errorf("flushed %d times for %d messages, want at least %d", rec.flushes, total, total/exportFlushEvery)
+	}
+
+	var export struct {
+		User          models.UserResponse   `json:"user"`
+		Conversations []models.Conversation `json:"conversations"`
+		Messages      []models.Message      `json:"messages"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &export); err != nil {
+		t.Fatalf("export is not valid JSON: %v", err)
+	}
+	if export.User.Username != "alice" || len(export.Conversations) != 1 || len(export.Messages) != total {
+		t.Errorf("export has user %q, %d conversations, %d messages; want alice, 1, %d",
+			export.User.Username, len(export.Conversations), len(export.Messages), total)
+	}
+}
@@ -2,8 +2,12 @@
 package api
 
 import (
-	"encoding/json"
+	"context"
+	"log"
 	"net/http"
+	"slices"
+	"strconv"
+	"time"
 
 	"chatgo/internal/db"
 	"chatgo/internal/models"
@@ -14,37 +18,157 @@ func HomeHandler(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte("Hello from ChatGO!"))
 }
 
-// HealthHandler returns the server health status as JSON.
+// healthCheckTimeout bounds the database ping in HealthHandler, so a hung
+// database fails the check quickly instead of stalling the probe.
+const healthCheckTimeout = 2 * time.Second
+
+// HealthResponse is the body of GET /api/health.
+type HealthResponse struct {
+	Status  string `json:"status"`  // "ok" or "degraded"
+	DB      string `json:"db"`      // "up" or "down"
+	Clients int    `json:"clients"` // Users connected over WebSocket
+}
+
+// HealthHandler is the readiness check: it pings the database and reports
+// the number of connected clients. Returns 503 if the database is unreachable,
+// so load balancers stop sending traffic here.
 func HealthHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
+	ctx, cancel := context.WithTimeout(r.Context(), healthCheckTimeout)
+	defer cancel()
+
+	status := http.StatusOK
+	response := HealthResponse{
+		Status:  "ok",
+		DB:      "up",
+		Clients: notifier.ClientCount(),
+	}
+	if err := db.DB.PingContext(ctx); err != nil {
+		log.Printf("Health check: database ping failed: %v", err)
+		status = http.StatusServiceUnavailable
+		response.Status = "degraded"
+		response.DB = "down"
+	}
+
+	WriteJSON(w, status, response)
+}
+
+// LiveHandler is the liveness check: it always returns 200 while the
+// process can serve HTTP, without touching the database.
+func LiveHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
 	response := map[string]string{
 		"status":  "ok",
 		"message": "ChatGO is running",
 	}
 
-	json.NewEncoder(w).Encode(response)
+	WriteJSON(w, http.StatusOK, response)
 }
 
+// MaxUserPageSize is the largest ?limit= accepted by GET /api/users.
+const MaxUserPageSize = 200
+
 // ListUsersHandler returns all users from the database.
 // This is a real endpoint that queries the database!
+// Bot accounts are left out unless ?include_bots=true is passed.
+// Each user carries an "online" flag taken from the WebSocket hub.
+// ?limit= (at most MaxUserPageSize) and ?offset= page through the list, and
+// ?envelope=true wraps it in a Page with the total count.
 func ListUsersHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
-	// Get all users from the database.
-	users, err := db.GetAllUsers()
+	includeBots := r.URL.Query().Get("include_bots") == "true"
+
+	limit := 0
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			WriteError(w, http.StatusBadRequest, ErrCodeBadRequest, "limit must be a positive integer")
+			return
+		}
+		limit = min(n, MaxUserPageSize)
+	}
+
+	offset := 0
+	if v := r.URL.Query().Get("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			WriteError(w, http.StatusBadRequest, ErrCodeBadRequest, "offset must be a non-negative integer")
+			return
+		}
+		offset = n
+	}
+
+	// Get the page of users from the database.
+	users, err := db.GetUsers(includeBots, limit, offset)
 	if err != nil {
 		// Return an error response.
 		// http.StatusInternalServerError = 500
-		http.Error(w, `{"error": "Failed to get users"}`, http.StatusInternalServerError)
+		WriteError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to get users")
 		return
 	}
 
-	// Convert each user to a safe response (without password hash).
-	var responses []models.UserResponse
+	// Users who blocked the caller always look offline to them, with no last-seen time.
+	var blockers []string
+	if claims := GetUserFromContext(r); claims != nil {
+		blockers, err = db.GetBlockerIDs(claims.UserID)
+		if err != nil {
+			WriteError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to get users")
+			return
+		}
+	}
+
+	// Convert each user to a safe response (without password hash),
+	// marking who currently has a live WebSocket connection.
+	responses := []models.UserResponse{}
 	for _, user := range users {
-		responses = append(responses, user.ToResponse())
+		resp := user.ToResponse()
+		if slices.Contains(blockers, user.ID) {
+			resp.LastSeenAt = nil
+		} else {
+			resp.Online = notifier.IsUserOnline(user.ID)
+		}
+		responses = append(responses, resp)
+	}
+
+	if !wantsEnvelope(r) {
+		WriteJSON(w, http.StatusOK, responses)
+		return
+	}
+
+	total, err := db.CountUsers(includeBots)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to get users")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, Page{Data: responses, Total: total, Limit: limit, Offset: offset})
+}
+
+// MeHandler handles GET /api/me
+// Returns the current user's profile, fresh from the database, so clients
+// don't have to decode the JWT. Returns 401 if the account no longer exists.
+func MeHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	claims := GetUserFromContext(r)
+	if claims == nil {
+		WriteError(w, http.StatusUnauthorized, ErrCodeUnauthorized, "User not authenticated")
+		return
+	}
+
+	user, err := db.GetUserByID(claims.UserID)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, ErrCodeInternal, "Database error")
+		return
+	}
+	if user == nil {
+		// Deleted since the token was issued.
+		WriteError(w, http.StatusUnauthorized, ErrCodeUnauthorized, "User no longer exists")
+		return
 	}
 
-	json.NewEncoder(w).Encode(responses)
+	WriteJSON(w, http.StatusOK, user.ToResponse())
 }
@@ -0,0 +1,39 @@
+package api
+
+import (
+	"net/http"
+	"slices"
+	"testing"
+
+	"chatgo/internal/db"
+	"chatgo/internal/dbtest"
+	"chatgo/internal/models"
+)
+
+// listUsernames returns the usernames GET /api/users lists for target.
+func listUsernames(t *testing.T, user *models.User, target string) []string {
+	t.Helper()
+	var users []models.UserResponse
+	decode(t, serve(t, "GET /api/users", ListUsersHandler, "GET", target, nil, user), http.StatusOK, &users)
+	names := make([]string, len(users))
+	for i, u := range users {
+		names[i] = u.Username
+	}
+	return names
+}
+
+func TestListUsersHidesBotsByDefault(t *testing.T) {
+	dbtest.Open(t)
+	alice := dbtest.User(t, "alice")
+	if _, err := db.CreateUser("helper-bot", "!", false, true); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+
+	if got := listUsernames(t, alice, "/api/users"); !slices.Equal(got, []string{"alice"}) {
+		t.Errorf("default list = %v, want just alice", got)
+	}
+	got := listUsernames(t, alice, "/api/users?include_bots=true")
+	if !slices.Contains(got, "alice") || !slices.Contains(got, "helper-bot") {
+		t.Errorf("include_bots list = %v, want alice and helper-bot", got)
+	}
+}
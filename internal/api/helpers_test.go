@@ -0,0 +1,124 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"chatgo/internal/auth"
+	"chatgo/internal/db"
+	"chatgo/internal/dbtest"
+	"chatgo/internal/models"
+	"chatgo/internal/websocket"
+)
+
+// testPassword is the password of every user made with newUser.
+const testPassword = "correct horse battery"
+
+// newUser creates a user whose password is testPassword.
+func newUser(t *testing.T, username string) *models.User {
+	t.Helper()
+	user := dbtest.User(t, username)
+	hash, err := auth.HashPassword(testPassword)
+	if err != nil {
+		t.Fatalf("HashPassword: %v", err)
+	}
+	if _, err := db.UpdateUserPassword(user.ID, hash); err != nil {
+		t.Fatalf("failed to set password: %v", err)
+	}
+	return user
+}
+
+// serve sends one request to handler, routed through pattern (e.g.
+// "POST /api/notifications/{id}/ack") so path values are set, as user
+// (nil for an anonymous request). body, if not nil, is sent as JSON.
+func serve(t *testing.T, pattern string, handler http.HandlerFunc, method, target string, body interface{}, user *models.User) *httptest.ResponseRecorder {
+	t.Helper()
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			t.Fatalf("failed to encode body: %v", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req := httptest.NewRequest(method, target, reader)
+	if user != nil {
+		token, err := auth.GenerateToken(user.ID, user.Username, user.IsAdmin)
+		if err != nil {
+			t.Fatalf("GenerateToken: %v", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		handler = AuthMiddleware(handler)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(pattern, handler)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	return rec
+}
+
+// decode reads a JSON response body into v, failing unless the status is want.
+func decode(t *testing.T, rec *httptest.ResponseRecorder, want int, v interface{}) {
+	t.Helper()
+	if rec.Code != want {
+		t.Fatalf("status = %d, want %d; body: %s", rec.Code, want, rec.Body)
+	}
+	if v != nil {
+		if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+			t.Fatalf("failed to decode %s: %v", rec.Body, err)
+		}
+	}
+}
+
+// errorCode returns the code of an error response.
+func errorCode(t *testing.T, rec *httptest.ResponseRecorder) string {
+	t.Helper()
+	var body ErrorResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("not an error response: %s", rec.Body)
+	}
+	return body.Error.Code
+}
+
+// recordingNotifier is a Notifier that remembers what it was asked to push.
+// Everything it doesn't record goes to the no-op nil hub.
+type recordingNotifier struct {
+	*websocket.Hub
+
+	mutex         sync.Mutex
+	notifications map[string][]*models.Notification // By user ID
+	disconnected  []string
+}
+
+// useRecordingNotifier installs a recordingNotifier for the rest of the test.
+func useRecordingNotifier(t *testing.T) *recordingNotifier {
+	n := &recordingNotifier{notifications: make(map[string][]*models.Notification)}
+	SetNotifier(n)
+	t.Cleanup(func() { SetNotifier(nil) })
+	return n
+}
+
+func (n *recordingNotifier) SendNotification(userID string, notification *models.Notification) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	n.notifications[userID] = append(n.notifications[userID], notification)
+}
+
+func (n *recordingNotifier) DisconnectUser(userID string) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	n.disconnected = append(n.disconnected, userID)
+}
+
+func (n *recordingNotifier) sent(userID string) []*models.Notification {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	return n.notifications[userID]
+}
@@ -0,0 +1,123 @@
+// Package api - invite and self-registration handlers
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"chatgo/internal/auth"
+	"chatgo/internal/db"
+	"chatgo/internal/models"
+)
+
+// Self-registration modes. Both are off by default, so only admins can create users.
+var (
+	// InviteRegistration enables POST /api/register with an invite token.
+	InviteRegistration = false
+
+	// AllowRegistration enables POST /api/register for anyone, no invite needed.
+	AllowRegistration = false
+)
+
+// InviteResponse is returned when an admin creates an invite.
+type InviteResponse struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// RegisterRequest is the expected JSON body for self-registration.
+// InviteToken is only required when registration is invite-only.
+// There's no is_admin field: self-registered users are never admins.
+type RegisterRequest struct {
+	InviteToken string `json:"invite_token"`
+	Username    string `json:"username"`
+	Password    string `json:"password"`
+}
+
+// CreateInviteHandler handles POST /api/invites (admin only)
+// Returns a one-time invite token to hand to the new user.
+func CreateInviteHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	user := GetUserFromContext(r)
+	if user == nil {
+		WriteError(w, http.StatusUnauthorized, ErrCodeUnauthorized, "User not authenticated")
+		return
+	}
+
+	token, hash, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to generate invite")
+		return
+	}
+
+	expiresAt, err := db.CreateInvite(hash, user.UserID, auth.InviteTTL)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to create invite")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, InviteResponse{Token: token, ExpiresAt: expiresAt})
+}
+
+// RegisterHandler handles POST /api/register
+// Creates a non-admin user and signs them in, returning the same body as login.
+// With AllowRegistration anyone may register; with only InviteRegistration a
+// valid invite is required. An invite that is sent is always consumed.
+func RegisterHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if !AllowRegistration && !InviteRegistration {
+		WriteError(w, http.StatusForbidden, ErrCodeRegistrationDisabled, "Registration is disabled")
+		return
+	}
+
+	var req RegisterRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, ErrCodeInvalidJSON, "Invalid JSON")
+		return
+	}
+
+	if req.Username == "" || req.Password == "" {
+		WriteError(w, http.StatusBadRequest, ErrCodeBadRequest, "Username and password required")
+		return
+	}
+	if req.InviteToken == "" && !AllowRegistration {
+		WriteError(w, http.StatusBadRequest, ErrCodeBadRequest, "invite_token required")
+		return
+	}
+
+	if err := auth.ValidatePassword(req.Password); err != nil {
+		WriteError(w, http.StatusBadRequest, ErrCodeWeakPassword, err.Error())
+		return
+	}
+
+	passwordHash, err := auth.HashPassword(req.Password)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to hash password")
+		return
+	}
+
+	var user *models.User
+	if req.InviteToken != "" {
+		user, err = db.RegisterWithInvite(auth.HashOpaqueToken(req.InviteToken), req.Username, passwordHash)
+	} else {
+		user, err = db.CreateUser(req.Username, passwordHash, false, false)
+	}
+	if errors.Is(err, db.ErrInvalidInvite) {
+		WriteError(w, http.StatusForbidden, ErrCodeInvalidInvite, "Invalid or already used invite")
+		return
+	}
+	if errors.Is(err, db.ErrUsernameTaken) {
+		WriteError(w, http.StatusConflict, ErrCodeUsernameTaken, "Username already taken")
+		return
+	}
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to create user")
+		return
+	}
+
+	writeLoginResponse(w, user)
+}
@@ -0,0 +1,62 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"chatgo/internal/dbtest"
+)
+
+// withRegistration sets the self-registration modes for the rest of the test.
+func withRegistration(t *testing.T, invite, open bool) {
+	savedInvite, savedOpen := InviteRegistration, AllowRegistration
+	InviteRegistration, AllowRegistration = invite, open
+	t.Cleanup(func() { InviteRegistration, AllowRegistration = savedInvite, savedOpen })
+}
+
+func register(t *testing.T, req RegisterRequest) *httptest.ResponseRecorder {
+	t.Helper()
+	return serve(t, "POST /api/register", RegisterHandler, "POST", "/api/register", req, nil)
+}
+
+func TestRegisterWithInvite(t *testing.T) {
+	dbtest.Open(t)
+	withRegistration(t, true, false)
+	admin := newUser(t, "admin")
+	admin.IsAdmin = true
+
+	var invite InviteResponse
+	decode(t, serve(t, "POST /api/invites", CreateInviteHandler, "POST", "/api/invites", nil, admin),
+		http.StatusOK, &invite)
+
+	var resp LoginResponse
+	decode(t, register(t, RegisterRequest{InviteToken: invite.Token, Username: "newcomer", Password: testPassword}),
+		http.StatusOK, &resp)
+	if resp.Username != "newcomer" || resp.Token == "" || resp.IsAdmin {
+		t.Errorf("register response = %+v, want a signed-in non-admin newcomer", resp)
+	}
+	login(t, "newcomer")
+
+	// The invite is spent now.
+	rec := register(t, RegisterRequest{InviteToken: invite.Token, Username: "second", Password: testPassword})
+	if got := errorCode(t, rec); rec.Code != http.StatusForbidden || got != ErrCodeInvalidInvite {
+		t.Errorf("reusing invite: status %d code %q, want 403 %s", rec.Code, got, ErrCodeInvalidInvite)
+	}
+}
+
+func TestRegisterRequiresInviteWhenInviteOnly(t *testing.T) {
+	withRegistration(t, true, false)
+	rec := register(t, RegisterRequest{Username: "newcomer", Password: testPassword})
+	if got := errorCode(t, rec); rec.Code != http.StatusBadRequest || got != ErrCodeBadRequest {
+		t.Errorf("status %d code %q, want 400 %s", rec.Code, got, ErrCodeBadRequest)
+	}
+}
+
+func TestRegisterDisabledByDefault(t *testing.T) {
+	withRegistration(t, false, false)
+	rec := register(t, RegisterRequest{InviteToken: "anything", Username: "newcomer", Password: testPassword})
+	if got := errorCode(t, rec); rec.Code != http.StatusForbidden || got != ErrCodeRegistrationDisabled {
+		t.Errorf("status %d code %q, want 403 %s", rec.Code, got, ErrCodeRegistrationDisabled)
+	}
+}
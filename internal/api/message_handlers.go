@@ -0,0 +1,118 @@
+// Package api - message handlers
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+
+	"chatgo/internal/db"
+	"chatgo/internal/models"
+)
+
+// MaxBatchMessages is the most message IDs accepted by one batch request.
+const MaxBatchMessages = 100
+
+// Page sizes for GET /api/conversations/{id}/messages.
+const (
+	DefaultMessagePageSize = 100
+	MaxMessagePageSize     = 200
+)
+
+// uuidPattern matches the canonical textual form of a UUID.
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// BatchMessagesRequest is the request body for fetching messages by ID.
+type BatchMessagesRequest struct {
+	IDs []string `json:"ids"`
+}
+
+// BatchMessagesHandler handles POST /api/messages/batch
+// Returns the requested messages the current user is allowed to see.
+func BatchMessagesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// Get current user from context
+	user := GetUserFromContext(r)
+	if user == nil {
+		WriteError(w, http.StatusUnauthorized, ErrCodeUnauthorized, "User not authenticated")
+		return
+	}
+
+	// Parse request
+	var req BatchMessagesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, ErrCodeInvalidJSON, "Invalid JSON")
+		return
+	}
+
+	if len(req.IDs) == 0 {
+		WriteError(w, http.StatusBadRequest, ErrCodeBadRequest, "ids required")
+		return
+	}
+	if len(req.IDs) > MaxBatchMessages {
+		WriteError(w, http.StatusBadRequest, ErrCodeBadRequest, "too many ids (max 100)")
+		return
+	}
+	for _, id := range req.IDs {
+		if !uuidPattern.MatchString(id) {
+			WriteError(w, http.StatusBadRequest, ErrCodeBadRequest, "invalid message id")
+			return
+		}
+	}
+
+	// Messages from conversations the user isn't in are filtered out by the query.
+	messages, err := db.GetMessagesByIDsContext(r.Context(), req.IDs, user.UserID)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to get messages")
+		return
+	}
+
+	// Return empty array instead of null
+	if messages == nil {
+		messages = []models.Message{}
+	}
+
+	WriteJSON(w, http.StatusOK, messages)
+}
+
+// GetMessageHandler handles GET /api/messages/{id}
+// Returns a single message if the current user is in its conversation.
+func GetMessageHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// Get current user from context
+	user := GetUserFromContext(r)
+	if user == nil {
+		WriteError(w, http.StatusUnauthorized, ErrCodeUnauthorized, "User not authenticated")
+		return
+	}
+
+	messageID := r.PathValue("id")
+	if !uuidPattern.MatchString(messageID) {
+		WriteError(w, http.StatusBadRequest, ErrCodeBadRequest, "invalid message id")
+		return
+	}
+
+	msg, err := db.GetMessageByIDContext(r.Context(), messageID)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to get message")
+		return
+	}
+	if msg == nil {
+		WriteError(w, http.StatusNotFound, ErrCodeNotFound, "Message not found")
+		return
+	}
+
+	isParticipant, err := db.IsUserInConversation(user.UserID, msg.ConversationID)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to check participation")
+		return
+	}
+	if !isParticipant {
+		WriteError(w, http.StatusForbidden, ErrCodeForbidden, "Not authorized")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, msg)
+}
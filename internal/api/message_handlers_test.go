@@ -0,0 +1,35 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"chatgo/internal/models"
+)
+
+func TestBatchMessagesValidatesIDs(t *testing.T) {
+	user := &models.User{ID: "00000000-0000-0000-0000-000000000001", Username: "alice"}
+	tooMany := make([]string, MaxBatchMessages+1)
+	for i := range tooMany {
+		tooMany[i] = fmt.Sprintf("00000000-0000-0000-0000-%012d", i)
+	}
+
+	tests := []struct {
+		name string
+		ids  []string
+	}{
+		{"empty", nil},
+		{"too many", tooMany},
+		{"not a uuid", []string{"1; DROP TABLE messages"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(t, "POST /api/messages/batch", BatchMessagesHandler, "POST", "/api/messages/batch",
+				BatchMessagesRequest{IDs: tt.ids}, user)
+			if got := errorCode(t, rec); rec.Code != http.StatusBadRequest || got != ErrCodeBadRequest {
+				t.Errorf("status %d code %q, want 400 %s", rec.Code, got, ErrCodeBadRequest)
+			}
+		})
+	}
+}
@@ -28,14 +28,14 @@ func AuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
 		// Format: "Bearer <token>"
 		authHeader := r.Header.Get("Authorization")
 		if authHeader == "" {
-			http.Error(w, `{"error": "Authorization header required"}`, http.StatusUnauthorized)
+			WriteError(w, http.StatusUnauthorized, ErrCodeUnauthorized, "Authorization header required")
 			return
 		}
 
 		// Split "Bearer <token>" into parts.
 		parts := strings.Split(authHeader, " ")
 		if len(parts) != 2 || parts[0] != "Bearer" {
-			http.Error(w, `{"error": "Invalid authorization format. Use: Bearer <token>"}`, http.StatusUnauthorized)
+			WriteError(w, http.StatusUnauthorized, ErrCodeInvalidToken, "Invalid authorization format. Use: Bearer <token>")
 			return
 		}
 
@@ -44,7 +44,7 @@ func AuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
 		// Validate the token.
 		claims, err := auth.ValidateToken(tokenString)
 		if err != nil {
-			http.Error(w, `{"error": "Invalid or expired token"}`, http.StatusUnauthorized)
+			WriteError(w, http.StatusUnauthorized, ErrCodeInvalidToken, "Invalid or expired token")
 			return
 		}
 
@@ -66,13 +66,13 @@ func AdminMiddleware(next http.HandlerFunc) http.HandlerFunc {
 		// Get user claims from context (set by AuthMiddleware).
 		claims, ok := r.Context().Value(UserContextKey).(*auth.Claims)
 		if !ok {
-			http.Error(w, `{"error": "User not authenticated"}`, http.StatusUnauthorized)
+			WriteError(w, http.StatusUnauthorized, ErrCodeUnauthorized, "User not authenticated")
 			return
 		}
 
 		// Check if user is admin.
 		if !claims.IsAdmin {
-			http.Error(w, `{"error": "Admin access required"}`, http.StatusForbidden)
+			WriteError(w, http.StatusForbidden, ErrCodeForbidden, "Admin access required")
 			return
 		}
 
@@ -81,6 +81,53 @@ func AdminMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	}
 }
 
+// CORSAllowedOrigins lists the browser origins allowed to call the API from
+// another site, e.g. "https://chat.example.com". "*" allows any origin.
+var CORSAllowedOrigins = []string{"*"}
+
+// CORSMiddleware adds CORS headers to /api/ requests so a frontend hosted on
+// another origin can use the API, and answers OPTIONS preflight requests with
+// 204. It must wrap the whole mux: preflights use OPTIONS, which the
+// method-specific routes would otherwise reject.
+func CORSMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" || !strings.HasPrefix(r.URL.Path, "/api/") {
+			// Not a cross-origin API request.
+			next(w, r)
+			return
+		}
+
+		allowed := ""
+		for _, o := range CORSAllowedOrigins {
+			if o == "*" || o == origin {
+				allowed = o
+				break
+			}
+		}
+
+		if allowed != "" {
+			w.Header().Set("Access-Control-Allow-Origin", allowed)
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+			w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
+			w.Header().Set("Access-Control-Expose-Headers", "Retry-After, X-Next-Cursor, X-Next-Offset")
+			w.Header().Set("Access-Control-Max-Age", "600")
+		}
+		if allowed != "*" {
+			// The answer depends on the Origin header; don't let caches mix them up.
+			w.Header().Add("Vary", "Origin")
+		}
+
+		// Preflight: the browser only wants the headers above.
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		next(w, r)
+	}
+}
+
 // GetUserFromContext retrieves the user claims from the request context.
 // Returns nil if no user is in the context.
 func GetUserFromContext(r *http.Request) *auth.Claims {
@@ -0,0 +1,81 @@
+// Package api - notification handlers
+package api
+
+import (
+	"log"
+	"net/http"
+
+	"chatgo/internal/db"
+	"chatgo/internal/models"
+)
+
+// notifyUser stores a notification and pushes it live if the user is online.
+// Failures are logged rather than returned: a missed notification should
+// never fail the request that triggered it.
+func notifyUser(userID, notificationType string, payload interface{}) {
+	n, err := db.CreateNotification(userID, notificationType, payload)
+	if err != nil {
+		log.Printf("Failed to create %s notification for %s: %v", notificationType, userID, err)
+		return
+	}
+	notifier.SendNotification(userID, n)
+}
+
+// ListNotificationsHandler handles GET /api/notifications
+// Returns the user's unacknowledged notifications (all of them with ?all=true).
+func ListNotificationsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	user := GetUserFromContext(r)
+	if user == nil {
+		WriteError(w, http.StatusUnauthorized, ErrCodeUnauthorized, "User not authenticated")
+		return
+	}
+
+	includeAcked := r.URL.Query().Get("all") == "true"
+
+	notifications, err := db.GetUserNotifications(user.UserID, includeAcked)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to get notifications")
+		return
+	}
+
+	// Return empty array instead of null
+	if notifications == nil {
+		notifications = []models.Notification{}
+	}
+
+	WriteJSON(w, http.StatusOK, notifications)
+}
+
+// AckNotificationHandler handles POST /api/notifications/{id}/ack
+func AckNotificationHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	user := GetUserFromContext(r)
+	if user == nil {
+		WriteError(w, http.StatusUnauthorized, ErrCodeUnauthorized, "User not authenticated")
+		return
+	}
+
+	// Notification ID from the route pattern /api/notifications/{id}/ack
+	notificationID := r.PathValue("id")
+	if !uuidPattern.MatchString(notificationID) {
+		WriteError(w, http.StatusNotFound, ErrCodeNotFound, "Notification not found")
+		return
+	}
+
+	acked, err := db.AckNotification(notificationID, user.UserID)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to ack notification")
+		return
+	}
+	if !acked {
+		WriteError(w, http.StatusNotFound, ErrCodeNotFound, "Notification not found")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]string{
+		"message": "Notification acknowledged",
+	})
+}
@@ -0,0 +1,63 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+
+	"chatgo/internal/dbtest"
+	"chatgo/internal/models"
+)
+
+func TestChangePasswordCreatesNotification(t *testing.T) {
+	dbtest.Open(t)
+	notifier := useRecordingNotifier(t)
+	alice := newUser(t, "alice")
+
+	rec := serve(t, "POST /api/password", ChangePasswordHandler, "POST", "/api/password",
+		ChangePasswordRequest{CurrentPassword: testPassword, NewPassword: "a different passphrase"}, alice)
+	decode(t, rec, http.StatusOK, nil)
+
+	var list []models.Notification
+	decode(t, serve(t, "GET /api/notifications", ListNotificationsHandler, "GET", "/api/notifications", nil, alice),
+		http.StatusOK, &list)
+	if len(list) != 1 || list[0].Type != models.NotificationPasswordChanged {
+		t.Fatalf("notifications = %+v, want one %s", list, models.NotificationPasswordChanged)
+	}
+	if sent := notifier.sent(alice.ID); len(sent) != 1 || sent[0].ID != list[0].ID {
+		t.Errorf("pushed %+v, want the stored notification", sent)
+	}
+}
+
+func TestListAndAckNotifications(t *testing.T) {
+	dbtest.Open(t)
+	alice := newUser(t, "alice")
+	bob := newUser(t, "bob")
+
+	notifyUser(alice.ID, models.NotificationPasswordReset, nil)
+	var list []models.Notification
+	decode(t, serve(t, "GET /api/notifications", ListNotificationsHandler, "GET", "/api/notifications", nil, alice),
+		http.StatusOK, &list)
+	if len(list) != 1 {
+		t.Fatalf("got %d notifications, want 1", len(list))
+	}
+	id := list[0].ID
+
+	const pattern = "POST /api/notifications/{id}/ack"
+	rec := serve(t, pattern, AckNotificationHandler, "POST", "/api/notifications/"+id+"/ack", nil, bob)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("bob acking alice's notification: status %d, want 404", rec.Code)
+	}
+	decode(t, serve(t, pattern, AckNotificationHandler, "POST", "/api/notifications/"+id+"/ack", nil, alice),
+		http.StatusOK, nil)
+
+	decode(t, serve(t, "GET /api/notifications", ListNotificationsHandler, "GET", "/api/notifications", nil, alice),
+		http.StatusOK, &list)
+	if len(list) != 0 {
+		t.Errorf("acked notification still listed: %+v", list)
+	}
+	decode(t, serve(t, "GET /api/notifications", ListNotificationsHandler, "GET", "/api/notifications?all=true", nil, alice),
+		http.StatusOK, &list)
+	if len(list) != 1 || list[0].AckedAt == nil {
+		t.Errorf("?all=true got %+v, want the acked notification", list)
+	}
+}
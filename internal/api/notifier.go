@@ -0,0 +1,47 @@
+// Package api - real-time notifier used by the handlers
+package api
+
+import (
+	"chatgo/internal/models"
+	"chatgo/internal/websocket"
+)
+
+// Notifier is everything the handlers need from the real-time layer.
+// *websocket.Hub implements it; tests can swap in a fake with SetNotifier.
+type Notifier interface {
+	// Presence
+	IsUserOnline(userID string) bool
+	ClientCount() int
+	DisconnectUser(userID string)
+
+	// Conversation events
+	NotifyNewConversation(conversationID string, participantIDs []string)
+	NotifyConversationDeleted(conversationID string, participantIDs []string)
+	NotifyParticipantAdded(conversationID, userID, username string)
+	NotifyParticipantRemoved(conversationID, userID, username string)
+	NotifyParticipantLeft(conversationID, userID, username string)
+	PostSystemMessage(conversationID, content string) error
+	BroadcastReadReceipt(state *models.ReadState)
+
+	// Durable notifications
+	SendNotification(userID string, n *models.Notification)
+}
+
+// notifier is the Notifier handlers push real-time events through.
+// It defaults to a nil *websocket.Hub, whose methods are all safe no-ops
+// (messages are still stored, just not pushed), so handlers never need a nil check.
+var notifier Notifier = (*websocket.Hub)(nil)
+
+// SetNotifier sets the Notifier used by the handlers. nil restores the no-op default.
+func SetNotifier(n Notifier) {
+	if n == nil {
+		n = (*websocket.Hub)(nil)
+	}
+	notifier = n
+}
+
+// SetHub sets the WebSocket hub used by the handlers.
+// Shorthand for SetNotifier(h).
+func SetHub(h *websocket.Hub) {
+	SetNotifier(h)
+}
@@ -0,0 +1,33 @@
+package api
+
+import (
+	"database/sql/driver"
+	"testing"
+
+	"chatgo/internal/dbtest"
+	"chatgo/internal/models"
+)
+
+func TestDefaultNotifierIsNoOp(t *testing.T) {
+	fake := dbtest.UseFake(t)
+	SetNotifier(nil)
+
+	if notifier.IsUserOnline("alice") || notifier.ClientCount() != 0 {
+		t.Error("the default notifier reports connected users")
+	}
+	notifier.DisconnectUser("alice")
+	notifier.NotifyNewConversation("conv", []string{"alice", "bob"})
+	notifier.NotifyConversationDeleted("conv", []string{"alice", "bob"})
+	notifier.NotifyParticipantAdded("conv", "bob", "bob")
+	notifier.NotifyParticipantRemoved("conv", "bob", "bob")
+	notifier.NotifyParticipantLeft("conv", "bob", "bob")
+	notifier.BroadcastReadReceipt(&models.ReadState{UserID: "alice", ConversationID: "conv"})
+	notifier.SendNotification("alice", &models.Notification{ID: "n"})
+
+	// With no hub the system message is still stored, just not pushed.
+	fake.OnRows("UPDATE conversations SET last_seq", []string{"last_seq"}, []driver.Value{int64(1)})
+	notifier.PostSystemMessage("conv", "hello")
+	if calls := fake.Calls("INSERT INTO messages"); len(calls) != 1 {
+		t.Errorf("PostSystemMessage stored %d messages, want 1", len(calls))
+	}
+}
@@ -0,0 +1,233 @@
+// Package api - conversation participant handlers
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"chatgo/internal/db"
+	"chatgo/internal/models"
+)
+
+// AddParticipantRequest is the request body for adding someone to a group.
+type AddParticipantRequest struct {
+	UserID string `json:"user_id"`
+}
+
+// AddParticipantHandler handles POST /api/conversations/{id}/participants
+// Adds a user to a group. Any participant of the group may add people.
+func AddParticipantHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// Get current user from context
+	user := GetUserFromContext(r)
+	if user == nil {
+		WriteError(w, http.StatusUnauthorized, ErrCodeUnauthorized, "User not authenticated")
+		return
+	}
+
+	conversationID := r.PathValue("id")
+	if !uuidPattern.MatchString(conversationID) {
+		WriteError(w, http.StatusForbidden, ErrCodeForbidden, "Not authorized")
+		return
+	}
+
+	var req AddParticipantRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, ErrCodeInvalidJSON, "Invalid JSON")
+		return
+	}
+	if !uuidPattern.MatchString(req.UserID) {
+		WriteError(w, http.StatusBadRequest, ErrCodeBadRequest, "user_id required")
+		return
+	}
+
+	// Only existing participants can add people.
+	settings, err := db.GetConversationSettings(conversationID, user.UserID)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, ErrCodeInternal, "Database error")
+		return
+	}
+	if settings == nil {
+		WriteError(w, http.StatusForbidden, ErrCodeForbidden, "Not authorized")
+		return
+	}
+	if !settings.Permissions().CanAddParticipant {
+		WriteError(w, http.StatusBadRequest, ErrCodeBadRequest, "Participants can only be added to groups")
+		return
+	}
+
+	added, err := db.GetUserByID(req.UserID)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, ErrCodeInternal, "Database error")
+		return
+	}
+	if added == nil {
+		WriteError(w, http.StatusNotFound, ErrCodeNotFound, "User not found")
+		return
+	}
+
+	ok, err := db.AddParticipant(conversationID, added.ID)
+	if errors.Is(err, db.ErrGroupFull) {
+		WriteError(w, http.StatusBadRequest, ErrCodeGroupFull, "Group is full")
+		return
+	}
+	if errors.Is(err, db.ErrNotGroup) {
+		WriteError(w, http.StatusBadRequest, ErrCodeBadRequest, "Participants can only be added to groups")
+		return
+	}
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to add participant")
+		return
+	}
+	if !ok {
+		WriteError(w, http.StatusConflict, ErrCodeAlreadyParticipant, "User is already a participant")
+		return
+	}
+
+	// Tell everyone: the group sees a notice, the new member gets the conversation.
+	postSystemMessage(conversationID, fmt.Sprintf("%s added %s", user.Username, added.Username))
+	notifier.NotifyParticipantAdded(conversationID, added.ID, added.Username)
+	notifyUser(added.ID, models.NotificationAddedToConversation, map[string]string{
+		"conversation_id": conversationID,
+		"name":            settings.Name,
+		"added_by":        user.Username,
+	})
+
+	WriteJSON(w, http.StatusCreated, models.Participant{
+		ID:          added.ID,
+		Username:    added.Username,
+		DisplayName: added.DisplayName,
+		AvatarURL:   added.AvatarURL,
+	})
+}
+
+// RemoveParticipantHandler handles DELETE /api/conversations/{id}/participants/{userId}
+// Removes a member from a group. Only the group owner may remove people.
+// A group can't drop below two members this way; delete it instead.
+func RemoveParticipantHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// Get current user from context
+	user := GetUserFromContext(r)
+	if user == nil {
+		WriteError(w, http.StatusUnauthorized, ErrCodeUnauthorized, "User not authenticated")
+		return
+	}
+
+	conversationID := r.PathValue("id")
+	userID := r.PathValue("userId")
+	if !uuidPattern.MatchString(conversationID) {
+		WriteError(w, http.StatusForbidden, ErrCodeForbidden, "Not authorized")
+		return
+	}
+
+	settings, err := db.GetConversationSettings(conversationID, user.UserID)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, ErrCodeInternal, "Database error")
+		return
+	}
+	if settings == nil {
+		WriteError(w, http.StatusForbidden, ErrCodeForbidden, "Not authorized")
+		return
+	}
+	if !settings.Permissions().CanRemoveParticipant {
+		WriteError(w, http.StatusForbidden, ErrCodeForbidden, "Only the group owner can remove participants")
+		return
+	}
+	if userID == user.UserID {
+		WriteError(w, http.StatusBadRequest, ErrCodeBadRequest, "Cannot remove yourself")
+		return
+	}
+
+	// Anything that isn't a UUID can't name a participant.
+	if !uuidPattern.MatchString(userID) {
+		WriteError(w, http.StatusNotFound, ErrCodeNotParticipant, "User is not a participant")
+		return
+	}
+
+	removed, err := db.GetUserByID(userID)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, ErrCodeInternal, "Database error")
+		return
+	}
+	if removed == nil {
+		WriteError(w, http.StatusNotFound, ErrCodeNotParticipant, "User is not a participant")
+		return
+	}
+
+	ok, err := db.RemoveParticipant(conversationID, removed.ID)
+	if errors.Is(err, db.ErrGroupTooSmall) {
+		WriteError(w, http.StatusBadRequest, ErrCodeBadRequest, "A group needs at least 2 participants; delete the conversation instead")
+		return
+	}
+	if errors.Is(err, db.ErrNotGroup) {
+		WriteError(w, http.StatusBadRequest, ErrCodeBadRequest, "Participants can only be removed from groups")
+		return
+	}
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to remove participant")
+		return
+	}
+	if !ok {
+		WriteError(w, http.StatusNotFound, ErrCodeNotParticipant, "User is not a participant")
+		return
+	}
+
+	notifier.NotifyParticipantRemoved(conversationID, removed.ID, removed.Username)
+	postSystemMessage(conversationID, fmt.Sprintf("%s removed %s", user.Username, removed.Username))
+
+	WriteJSON(w, http.StatusOK, map[string]string{
+		"message": "Participant removed",
+	})
+}
+
+// LeaveConversationHandler handles POST /api/conversations/{id}/leave
+// Removes the caller from the conversation. When the last participant leaves,
+// the conversation is deleted (see db.LeaveConversation).
+func LeaveConversationHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// Get current user from context
+	user := GetUserFromContext(r)
+	if user == nil {
+		WriteError(w, http.StatusUnauthorized, ErrCodeUnauthorized, "User not authenticated")
+		return
+	}
+
+	conversationID := r.PathValue("id")
+	if !uuidPattern.MatchString(conversationID) {
+		WriteError(w, http.StatusForbidden, ErrCodeForbidden, "Not authorized")
+		return
+	}
+
+	left, deleted, err := db.LeaveConversation(conversationID, user.UserID)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to leave conversation")
+		return
+	}
+	if !left {
+		WriteError(w, http.StatusForbidden, ErrCodeForbidden, "Not authorized")
+		return
+	}
+
+	notifier.NotifyParticipantLeft(conversationID, user.UserID, user.Username)
+	if !deleted {
+		postSystemMessage(conversationID, fmt.Sprintf("%s left", user.Username))
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"message": "Left conversation",
+		"deleted": deleted,
+	})
+}
+
+// postSystemMessage posts a membership notice, logging (not failing) on error.
+func postSystemMessage(conversationID, content string) {
+	if err := notifier.PostSystemMessage(conversationID, content); err != nil {
+		log.Printf("Failed to post system message to %s: %v", conversationID, err)
+	}
+}
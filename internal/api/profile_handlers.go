@@ -0,0 +1,149 @@
+// Package api - profile handlers for the current user
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+
+	"chatgo/internal/auth"
+	"chatgo/internal/db"
+	"chatgo/internal/models"
+)
+
+// maxDisplayNameLength is the longest display name, in characters.
+const maxDisplayNameLength = 64
+
+// maxUsernameLength is the longest username, in bytes (the column's size).
+const maxUsernameLength = 50
+
+// maxAvatarURLLength caps stored avatar URLs; real image URLs are far shorter.
+const maxAvatarURLLength = 2048
+
+// validateAvatarURL accepts "" (no avatar) or an absolute http(s) URL.
+func validateAvatarURL(raw string) error {
+	if raw == "" {
+		return nil
+	}
+	if len(raw) > maxAvatarURLLength {
+		return errors.New("avatar URL too long")
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("avatar URL must be http or https")
+	}
+	return nil
+}
+
+// UpdateMeHandler handles PATCH /api/me
+// Lets users change their own profile. Only fields present in the body change.
+func UpdateMeHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	claims := GetUserFromContext(r)
+	if claims == nil {
+		WriteError(w, http.StatusUnauthorized, ErrCodeUnauthorized, "User not authenticated")
+		return
+	}
+
+	var req models.ProfileUpdateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, ErrCodeInvalidJSON, "Invalid JSON")
+		return
+	}
+
+	if req.DisplayName != nil {
+		name := strings.TrimSpace(*req.DisplayName)
+		if name == "" || utf8.RuneCountInString(name) > maxDisplayNameLength {
+			WriteError(w, http.StatusBadRequest, ErrCodeBadRequest, "display_name must be 1-64 characters")
+			return
+		}
+		req.DisplayName = &name
+	}
+
+	if req.AvatarURL != nil {
+		if err := validateAvatarURL(*req.AvatarURL); err != nil {
+			WriteError(w, http.StatusBadRequest, ErrCodeBadRequest, "avatar_url must be an http(s) URL")
+			return
+		}
+	}
+
+	user, err := db.UpdateUserProfile(claims.UserID, req.DisplayName, req.AvatarURL)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to update profile")
+		return
+	}
+	if user == nil {
+		// Deleted since the token was issued.
+		WriteError(w, http.StatusUnauthorized, ErrCodeUnauthorized, "User no longer exists")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, user.ToResponse())
+}
+
+// UpdateMyUsernameHandler handles PATCH /api/me/username
+// Lets users rename themselves. Usernames are unique ignoring case. The
+// username is baked into the access token, so the response carries a new
+// one; older tokens keep working, since they're authorized by user ID.
+func UpdateMyUsernameHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	claims := GetUserFromContext(r)
+	if claims == nil {
+		WriteError(w, http.StatusUnauthorized, ErrCodeUnauthorized, "User not authenticated")
+		return
+	}
+
+	var req models.UsernameUpdateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, ErrCodeInvalidJSON, "Invalid JSON")
+		return
+	}
+
+	username := strings.TrimSpace(req.Username)
+	if username == "" || len(username) > maxUsernameLength {
+		WriteError(w, http.StatusBadRequest, ErrCodeBadRequest, "username must be 1-50 characters")
+		return
+	}
+
+	user, err := db.UpdateUsername(claims.UserID, username)
+	if errors.Is(err, db.ErrUsernameTaken) {
+		WriteError(w, http.StatusConflict, ErrCodeUsernameTaken, "Username already taken")
+		return
+	}
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to update username")
+		return
+	}
+	if user == nil {
+		// Deleted since the token was issued.
+		WriteError(w, http.StatusUnauthorized, ErrCodeUnauthorized, "User no longer exists")
+		return
+	}
+
+	token, jti, err := auth.IssueToken(user.ID, user.Username, user.IsAdmin)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to generate token")
+		return
+	}
+	if auth.SingleSession {
+		if err := db.SetCurrentSessionID(user.ID, jti); err != nil {
+			WriteError(w, http.StatusInternalServerError, ErrCodeInternal, "Database error")
+			return
+		}
+	}
+
+	WriteJSON(w, http.StatusOK, LoginResponse{
+		Token:    token,
+		Username: user.Username,
+		IsAdmin:  user.IsAdmin,
+	})
+}
@@ -0,0 +1,137 @@
+// Package api - login rate limiting
+package api
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Login brute-force protection: after LoginMaxFailures failed attempts within
+// LoginFailureWindow, further attempts for that username or IP get 429 until
+// the window is over.
+const (
+	LoginMaxFailures   = 5
+	LoginFailureWindow = 15 * time.Minute
+)
+
+// LoginLimiter tracks failed login attempts per key (a username or an IP).
+// It's an interface so the in-memory store can later be swapped for a
+// shared one (e.g. Redis) when running several servers.
+type LoginLimiter interface {
+	// Allow reports whether another attempt is allowed for key and,
+	// if not, how long until it is.
+	Allow(key string) (bool, time.Duration)
+	// Fail records a failed attempt for key.
+	Fail(key string)
+	// Reset forgets all failures for key.
+	Reset(key string)
+}
+
+// loginLimiter is the limiter LoginHandler uses.
+var loginLimiter LoginLimiter = NewMemoryLoginLimiter(LoginMaxFailures, LoginFailureWindow)
+
+// SetLoginLimiter replaces the limiter used by LoginHandler.
+func SetLoginLimiter(l LoginLimiter) {
+	loginLimiter = l
+}
+
+// MemoryLoginLimiter is a fixed-window LoginLimiter kept in process memory.
+type MemoryLoginLimiter struct {
+	maxFailures int
+	window      time.Duration
+
+	mutex     sync.Mutex
+	windows   map[string]*failureWindow
+	lastSweep time.Time
+}
+
+// failureWindow counts failures since start.
+type failureWindow struct {
+	start    time.Time
+	failures int
+}
+
+// NewMemoryLoginLimiter creates a limiter allowing maxFailures failures per window.
+func NewMemoryLoginLimiter(maxFailures int, window time.Duration) *MemoryLoginLimiter {
+	return &MemoryLoginLimiter{
+		maxFailures: maxFailures,
+		window:      window,
+		windows:     make(map[string]*failureWindow),
+		lastSweep:   time.Now(),
+	}
+}
+
+// Allow implements LoginLimiter.
+func (l *MemoryLoginLimiter) Allow(key string) (bool, time.Duration) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	fw, exists := l.windows[key]
+	if !exists || fw.failures < l.maxFailures {
+		return true, 0
+	}
+
+	retryAfter := time.Until(fw.start.Add(l.window))
+	if retryAfter <= 0 {
+		delete(l.windows, key)
+		return true, 0
+	}
+	return false, retryAfter
+}
+
+// Fail implements LoginLimiter.
+func (l *MemoryLoginLimiter) Fail(key string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := time.Now()
+	l.sweep(now)
+
+	fw, exists := l.windows[key]
+	if !exists || now.Sub(fw.start) >= l.window {
+		fw = &failureWindow{start: now}
+		l.windows[key] = fw
+	}
+	fw.failures++
+}
+
+// Reset implements LoginLimiter.
+func (l *MemoryLoginLimiter) Reset(key string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	delete(l.windows, key)
+}
+
+// sweep drops expired windows, at most once per window, so keys that are
+// never tried again don't pile up. Caller must hold l.mutex.
+func (l *MemoryLoginLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < l.window {
+		return
+	}
+	for key, fw := range l.windows {
+		if now.Sub(fw.start) >= l.window {
+			delete(l.windows, key)
+		}
+	}
+	l.lastSweep = now
+}
+
+// clientIP returns the IP address of the client that sent r.
+// Proxy headers aren't trusted, since anyone can set them.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// loginLimiterKeys returns the limiter keys for a login attempt:
+// one for the username and one for the client's IP.
+func loginLimiterKeys(r *http.Request, username string) (userKey, ipKey string) {
+	return "user:" + strings.ToLower(username), "ip:" + clientIP(r)
+}
@@ -0,0 +1,86 @@
+// Package api - JSON response helpers
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+// Error codes sent in ErrorResponse. Clients should switch on these rather
+// than on the human-readable message, which may change.
+const (
+	// Generic codes, one per HTTP status.
+	ErrCodeBadRequest   = "bad_request"
+	ErrCodeUnauthorized = "unauthorized"
+	ErrCodeForbidden    = "forbidden"
+	ErrCodeNotFound     = "not_found"
+	ErrCodeConflict     = "conflict"
+	ErrCodeTooLarge     = "too_large"
+	ErrCodeRateLimited  = "rate_limited"
+	ErrCodeInternal     = "internal_error"
+	ErrCodeUnavailable  = "unavailable"
+
+	// Specific codes for errors clients commonly need to tell apart.
+	ErrCodeInvalidJSON          = "invalid_json"
+	ErrCodeInvalidToken         = "invalid_token"
+	ErrCodeInvalidCredentials   = "invalid_credentials"
+	ErrCodeAccountDisabled      = "account_disabled"
+	ErrCodeRegistrationDisabled = "registration_disabled"
+	ErrCodeInvalidInvite        = "invalid_invite"
+	ErrCodeUsernameTaken        = "username_taken"
+	ErrCodeWeakPassword         = "weak_password"
+	ErrCodeLastAdmin            = "last_admin"
+	ErrCodeUnknownUsers         = "unknown_users"
+	ErrCodeSelfConversation     = "self_conversation"
+	ErrCodeBlocked              = "blocked"
+	ErrCodeInvalidCursor        = "invalid_cursor"
+	ErrCodeGroupFull            = "group_full"
+	ErrCodeGroupTooSmall        = "group_too_small"
+	ErrCodeAlreadyParticipant   = "already_participant"
+	ErrCodeNotParticipant       = "not_participant"
+)
+
+// ErrorBody describes what went wrong.
+type ErrorBody struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// ErrorResponse is the body of every error response:
+// {"error": {"code": "...", "message": "..."}}
+type ErrorResponse struct {
+	Error ErrorBody `json:"error"`
+}
+
+// WriteJSON writes v as a JSON response with the given status code.
+func WriteJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		// Headers are already sent; all we can do is note it.
+		log.Printf("Failed to write JSON response: %v", err)
+	}
+}
+
+// WriteError writes an ErrorResponse with the given status code.
+func WriteError(w http.ResponseWriter, status int, code, message string) {
+	WriteJSON(w, status, ErrorResponse{Error: ErrorBody{Code: code, Message: message}})
+}
+
+// Page is the body of a list endpoint called with ?envelope=true:
+// {"data": [...], "total": N, "limit": L, "offset": O}.
+// Total counts every item the list could page through, and Limit 0 means the
+// request had no limit. Without ?envelope=true these endpoints return the
+// bare array, as they always have.
+type Page struct {
+	Data   interface{} `json:"data"`
+	Total  int         `json:"total"`
+	Limit  int         `json:"limit"`
+	Offset int         `json:"offset"`
+}
+
+// wantsEnvelope reports whether the client asked for a Page instead of a bare array.
+func wantsEnvelope(r *http.Request) bool {
+	return r.URL.Query().Get("envelope") == "true"
+}
@@ -0,0 +1,38 @@
+// Package api - static frontend files with single-page app fallback
+package api
+
+import (
+	"errors"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// SPAHandler serves the frontend's static files from dir. Paths that don't
+// name a file get dir/index.html instead, so client-side routes such as
+// /chat/123 load the app and let it route. Unknown /api/ and /ws paths still
+// 404, since a client calling them expects JSON, not a page.
+func SPAHandler(dir string) http.Handler {
+	files := http.FileServer(http.Dir(dir))
+	index := filepath.Join(dir, "index.html")
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/api/") || r.URL.Path == "/ws" {
+			w.Header().Set("Content-Type", "application/json")
+			WriteError(w, http.StatusNotFound, ErrCodeNotFound, "Not found")
+			return
+		}
+
+		// Clean the path the same way http.FileServer does before looking it up.
+		name := filepath.Join(dir, filepath.FromSlash(path.Clean("/"+r.URL.Path)))
+		if _, err := os.Stat(name); errors.Is(err, fs.ErrNotExist) {
+			http.ServeFile(w, r, index)
+			return
+		}
+
+		files.ServeHTTP(w, r)
+	})
+}
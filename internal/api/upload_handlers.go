@@ -0,0 +1,63 @@
+// Package api - file upload handlers
+package api
+
+import (
+	"io"
+	"net/http"
+
+	"chatgo/internal/storage"
+)
+
+// MaxUploadSize is the largest file we accept (10 MB).
+const MaxUploadSize = 10 << 20
+
+// fileStorage is where uploads are written. Set with SetStorage at startup.
+var fileStorage storage.Storage
+
+// SetStorage sets the storage backend used for uploads.
+func SetStorage(s storage.Storage) {
+	fileStorage = s
+}
+
+// UploadHandler handles POST /api/uploads
+// Expects a multipart form with a "file" field and returns the attachment metadata.
+func UploadHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if fileStorage == nil {
+		WriteError(w, http.StatusServiceUnavailable, ErrCodeUnavailable, "Uploads are not configured")
+		return
+	}
+
+	// Limit the body so a huge upload can't exhaust memory.
+	r.Body = http.MaxBytesReader(w, r.Body, MaxUploadSize+1024)
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, ErrCodeBadRequest, "file field required")
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, MaxUploadSize+1))
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, ErrCodeBadRequest, "Failed to read upload")
+		return
+	}
+	if len(data) > MaxUploadSize {
+		WriteError(w, http.StatusRequestEntityTooLarge, ErrCodeTooLarge, "File too large")
+		return
+	}
+
+	attachment, err := storage.SaveUpload(fileStorage, header.Filename, data)
+	if err == storage.ErrImageTooLarge {
+		WriteError(w, http.StatusRequestEntityTooLarge, ErrCodeTooLarge, "Image dimensions too large")
+		return
+	}
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to store upload")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, attachment)
+}
@@ -4,7 +4,6 @@ package api
 import (
 	"encoding/json"
 	"net/http"
-	"strings"
 
 	"chatgo/internal/auth"
 	"chatgo/internal/db"
@@ -19,107 +18,208 @@ func CreateUserHandler(w http.ResponseWriter, r *http.Request) {
 	var req models.UserCreateRequest
 	err := json.NewDecoder(r.Body).Decode(&req)
 	if err != nil {
-		http.Error(w, `{"error": "Invalid JSON"}`, http.StatusBadRequest)
+		WriteError(w, http.StatusBadRequest, ErrCodeInvalidJSON, "Invalid JSON")
 		return
 	}
 
 	// Validate input.
 	if req.Username == "" || req.Password == "" {
-		http.Error(w, `{"error": "Username and password required"}`, http.StatusBadRequest)
+		WriteError(w, http.StatusBadRequest, ErrCodeBadRequest, "Username and password required")
 		return
 	}
 
-	// Check if username already exists.
-	existingUser, err := db.GetUserByUsername(req.Username)
-	if err != nil {
-		http.Error(w, `{"error": "Database error"}`, http.StatusInternalServerError)
-		return
-	}
-	if existingUser != nil {
-		http.Error(w, `{"error": "Username already taken"}`, http.StatusConflict)
+	if err := auth.ValidatePassword(req.Password); err != nil {
+		WriteError(w, http.StatusBadRequest, ErrCodeWeakPassword, err.Error())
 		return
 	}
 
 	// Hash the password.
 	passwordHash, err := auth.HashPassword(req.Password)
 	if err != nil {
-		http.Error(w, `{"error": "Failed to hash password"}`, http.StatusInternalServerError)
+		WriteError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to hash password")
 		return
 	}
 
-	// Create the user.
-	user, err := db.CreateUser(req.Username, passwordHash, req.IsAdmin)
+	// Create the user. The unique constraint catches taken usernames,
+	// even when two requests race for the same one.
+	user, err := db.CreateUser(req.Username, passwordHash, req.IsAdmin, req.IsBot)
+	if err == db.ErrUsernameTaken {
+		WriteError(w, http.StatusConflict, ErrCodeUsernameTaken, "Username already taken")
+		return
+	}
 	if err != nil {
-		http.Error(w, `{"error": "Failed to create user"}`, http.StatusInternalServerError)
+		WriteError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to create user")
 		return
 	}
 
 	// Return the created user (without password hash).
-	json.NewEncoder(w).Encode(user.ToResponse())
+	WriteJSON(w, http.StatusOK, user.ToResponse())
 }
 
 // DeleteUserHandler handles DELETE /api/users/{id} (admin only)
 func DeleteUserHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
-	// Extract user ID from URL path.
-	// URL format: /api/users/{id}
-	path := r.URL.Path
-	parts := strings.Split(path, "/")
-
-	// Expected: ["", "api", "users", "{id}"]
-	if len(parts) != 4 {
-		http.Error(w, `{"error": "Invalid URL format"}`, http.StatusBadRequest)
-		return
-	}
-
-	userID := parts[3]
-	if userID == "" {
-		http.Error(w, `{"error": "User ID required"}`, http.StatusBadRequest)
-		return
-	}
+	// User ID from the route pattern /api/users/{id}
+	userID := r.PathValue("id")
 
 	// Get current user from context (set by middleware).
 	currentUser := GetUserFromContext(r)
 	if currentUser != nil && currentUser.UserID == userID {
-		http.Error(w, `{"error": "Cannot delete yourself"}`, http.StatusBadRequest)
+		WriteError(w, http.StatusBadRequest, ErrCodeBadRequest, "Cannot delete yourself")
+		return
+	}
+
+	// The system user sends automated messages and must always exist.
+	if userID == db.SystemUserID {
+		WriteError(w, http.StatusBadRequest, ErrCodeBadRequest, "Cannot modify the system user")
 		return
 	}
 
 	// Delete the user.
 	deleted, err := db.DeleteUser(userID)
+	if err == db.ErrLastAdmin {
+		WriteError(w, http.StatusBadRequest, ErrCodeLastAdmin, "cannot remove the last admin")
+		return
+	}
 	if err != nil {
-		http.Error(w, `{"error": "Failed to delete user"}`, http.StatusInternalServerError)
+		WriteError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to delete user")
 		return
 	}
 
 	if !deleted {
-		http.Error(w, `{"error": "User not found"}`, http.StatusNotFound)
+		WriteError(w, http.StatusNotFound, ErrCodeNotFound, "User not found")
 		return
 	}
 
+	// Their open WebSocket would otherwise stay authenticated until the token expires.
+	notifier.DisconnectUser(userID)
+
 	// Return success message.
-	json.NewEncoder(w).Encode(map[string]string{
+	WriteJSON(w, http.StatusOK, map[string]string{
 		"message": "User deleted successfully",
 	})
 }
 
-// UpdateUserHandler handles PUT /api/users/{id} (admin only)
-func UpdateUserHandler(w http.ResponseWriter, r *http.Request) {
+// SetUserActiveHandler handles PUT /api/users/{id}/active (admin only)
+// Deactivates or reactivates a user. A deactivated user can't log in and is
+// disconnected from WebSocket right away; their messages stay as they are.
+func SetUserActiveHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
-	// Extract user ID from URL path.
-	path := r.URL.Path
-	parts := strings.Split(path, "/")
+	// User ID from the route pattern /api/users/{id}/active
+	userID := r.PathValue("id")
+
+	currentUser := GetUserFromContext(r)
+	if currentUser != nil && currentUser.UserID == userID {
+		WriteError(w, http.StatusBadRequest, ErrCodeBadRequest, "Cannot deactivate yourself")
+		return
+	}
+
+	if userID == db.SystemUserID {
+		WriteError(w, http.StatusBadRequest, ErrCodeBadRequest, "Cannot modify the system user")
+		return
+	}
 
-	if len(parts) != 4 {
-		http.Error(w, `{"error": "Invalid URL format"}`, http.StatusBadRequest)
+	var req models.UserActiveRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, ErrCodeInvalidJSON, "Invalid JSON")
+		return
+	}
+	if req.Active == nil {
+		WriteError(w, http.StatusBadRequest, ErrCodeBadRequest, "active required")
 		return
 	}
 
-	userID := parts[3]
-	if userID == "" {
-		http.Error(w, `{"error": "User ID required"}`, http.StatusBadRequest)
+	user, err := db.SetUserActive(userID, *req.Active)
+	if err == db.ErrLastAdmin {
+		WriteError(w, http.StatusBadRequest, ErrCodeLastAdmin, "cannot remove the last admin")
+		return
+	}
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to update user")
+		return
+	}
+	if user == nil {
+		WriteError(w, http.StatusNotFound, ErrCodeNotFound, "User not found")
+		return
+	}
+
+	// Don't let a deactivated user keep chatting on an open connection.
+	if !user.IsActive {
+		notifier.DisconnectUser(user.ID)
+	}
+
+	WriteJSON(w, http.StatusOK, user.ToResponse())
+}
+
+// SetUserAdminHandler handles PATCH /api/users/{id}/admin (admin only)
+// Grants or revokes admin rights without touching anything else on the user.
+// The last active admin can't be demoted.
+func SetUserAdminHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// User ID from the route pattern /api/users/{id}/admin
+	userID := r.PathValue("id")
+
+	if userID == db.SystemUserID {
+		WriteError(w, http.StatusBadRequest, ErrCodeBadRequest, "Cannot modify the system user")
+		return
+	}
+
+	var req models.UserAdminRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, ErrCodeInvalidJSON, "Invalid JSON")
+		return
+	}
+	if req.IsAdmin == nil {
+		WriteError(w, http.StatusBadRequest, ErrCodeBadRequest, "is_admin required")
+		return
+	}
+
+	// Loaded to tell whether the admin flag changes.
+	before, err := db.GetUserByID(userID)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, ErrCodeInternal, "Database error")
+		return
+	}
+	if before == nil {
+		WriteError(w, http.StatusNotFound, ErrCodeNotFound, "User not found")
+		return
+	}
+
+	user, err := db.SetUserAdmin(userID, *req.IsAdmin)
+	if err == db.ErrLastAdmin {
+		WriteError(w, http.StatusBadRequest, ErrCodeLastAdmin, "cannot remove the last admin")
+		return
+	}
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to update user")
+		return
+	}
+	if user == nil {
+		WriteError(w, http.StatusNotFound, ErrCodeNotFound, "User not found")
+		return
+	}
+
+	// Like UpdateUserHandler: nothing keeps running on a connection
+	// opened under the old role.
+	if user.IsAdmin != before.IsAdmin {
+		notifier.DisconnectUser(user.ID)
+	}
+
+	WriteJSON(w, http.StatusOK, user.ToResponse())
+}
+
+// UpdateUserHandler handles PUT /api/users/{id} (admin only)
+func UpdateUserHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// User ID from the route pattern /api/users/{id}
+	userID := r.PathValue("id")
+
+	if userID == db.SystemUserID {
+		WriteError(w, http.StatusBadRequest, ErrCodeBadRequest, "Cannot modify the system user")
 		return
 	}
 
@@ -127,49 +227,79 @@ func UpdateUserHandler(w http.ResponseWriter, r *http.Request) {
 	var req models.UserUpdateRequest
 	err := json.NewDecoder(r.Body).Decode(&req)
 	if err != nil {
-		http.Error(w, `{"error": "Invalid JSON"}`, http.StatusBadRequest)
+		WriteError(w, http.StatusBadRequest, ErrCodeInvalidJSON, "Invalid JSON")
 		return
 	}
 
 	// Validate username is not empty.
 	if req.Username == "" {
-		http.Error(w, `{"error": "Username required"}`, http.StatusBadRequest)
+		WriteError(w, http.StatusBadRequest, ErrCodeBadRequest, "Username required")
 		return
 	}
 
-	// Check if username is taken by another user.
-	existingUser, err := db.GetUserByUsername(req.Username)
+	if req.AvatarURL != nil {
+		if err := validateAvatarURL(*req.AvatarURL); err != nil {
+			WriteError(w, http.StatusBadRequest, ErrCodeBadRequest, "avatar_url must be an http(s) URL")
+			return
+		}
+	}
+
+	// Loaded to tell whether the admin flag changes.
+	before, err := db.GetUserByID(userID)
 	if err != nil {
-		http.Error(w, `{"error": "Database error"}`, http.StatusInternalServerError)
+		WriteError(w, http.StatusInternalServerError, ErrCodeInternal, "Database error")
 		return
 	}
-	if existingUser != nil && existingUser.ID != userID {
-		http.Error(w, `{"error": "Username already taken"}`, http.StatusConflict)
+	if before == nil {
+		WriteError(w, http.StatusNotFound, ErrCodeNotFound, "User not found")
 		return
 	}
 
 	// Hash new password if provided.
 	var passwordHash string
 	if req.Password != "" {
+		if err := auth.ValidatePassword(req.Password); err != nil {
+			WriteError(w, http.StatusBadRequest, ErrCodeWeakPassword, err.Error())
+			return
+		}
 		passwordHash, err = auth.HashPassword(req.Password)
 		if err != nil {
-			http.Error(w, `{"error": "Failed to hash password"}`, http.StatusInternalServerError)
+			WriteError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to hash password")
 			return
 		}
 	}
 
 	// Update the user.
-	user, err := db.UpdateUser(userID, req.Username, passwordHash, req.IsAdmin)
+	user, err := db.UpdateUser(userID, req.Username, passwordHash, req.IsAdmin, req.AvatarURL)
+	if err == db.ErrUsernameTaken {
+		WriteError(w, http.StatusConflict, ErrCodeUsernameTaken, "Username already taken")
+		return
+	}
+	if err == db.ErrLastAdmin {
+		WriteError(w, http.StatusBadRequest, ErrCodeLastAdmin, "cannot remove the last admin")
+		return
+	}
 	if err != nil {
-		http.Error(w, `{"error": "Failed to update user"}`, http.StatusInternalServerError)
+		WriteError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to update user")
 		return
 	}
 
 	if user == nil {
-		http.Error(w, `{"error": "User not found"}`, http.StatusNotFound)
+		WriteError(w, http.StatusNotFound, ErrCodeNotFound, "User not found")
 		return
 	}
 
+	// A promoted or demoted user reconnects, so nothing keeps running
+	// on a connection opened under their old role.
+	if user.IsAdmin != before.IsAdmin {
+		notifier.DisconnectUser(user.ID)
+	}
+
+	// Let the user know an admin changed their password.
+	if passwordHash != "" {
+		notifyUser(user.ID, models.NotificationPasswordReset, nil)
+	}
+
 	// Return the updated user.
-	json.NewEncoder(w).Encode(user.ToResponse())
+	WriteJSON(w, http.StatusOK, user.ToResponse())
 }
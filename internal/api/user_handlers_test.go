@@ -0,0 +1,84 @@
+package api
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+
+	"chatgo/internal/dbtest"
+	"chatgo/internal/models"
+)
+
+func TestLastAdminCannotBeRemoved(t *testing.T) {
+	// The handlers trust the admin middleware in front of them, so the
+	// caller needn't be an admin here; root is the only one.
+	caller := &models.User{ID: "caller", Username: "caller"}
+	demote := false
+	tests := []struct {
+		name    string
+		pattern string
+		handler http.HandlerFunc
+		method  string
+		target  string
+		body    interface{}
+	}{
+		{"delete", "DELETE /api/users/{id}", DeleteUserHandler, "DELETE", "/api/users/root", nil},
+		{"PUT demotion", "PUT /api/users/{id}", UpdateUserHandler, "PUT", "/api/users/root",
+			models.UserUpdateRequest{Username: "root"}},
+		{"PATCH demotion", "PATCH /api/users/{id}/admin", SetUserAdminHandler, "PATCH", "/api/users/root/admin",
+			models.UserAdminRequest{IsAdmin: &demote}},
+		{"deactivation", "PUT /api/users/{id}/active", SetUserActiveHandler, "PUT", "/api/users/root/active",
+			models.UserActiveRequest{Active: &demote}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := dbtest.UseFake(t)
+			fake.OnRows("FROM users WHERE id = $1", []string{"id", "username", "display_name", "password_hash",
+				"is_admin", "is_bot", "is_active", "avatar_url", "last_seen_at", "created_at"},
+				[]driver.Value{"root", "root", "root", "!", true, false, true, "", nil, time.Now()})
+			fake.OnRows("WHERE is_admin AND is_active FOR UPDATE", []string{"id"}, []driver.Value{"root"})
+
+			rec := serve(t, tt.pattern, tt.handler, tt.method, tt.target, tt.body, caller)
+			if got := errorCode(t, rec); rec.Code != http.StatusBadRequest || got != ErrCodeLastAdmin {
+				t.Errorf("status %d code %q, want 400 %s", rec.Code, got, ErrCodeLastAdmin)
+			}
+			if n := len(fake.Calls("UPDATE users")) + len(fake.Calls("DELETE FROM users")); n != 0 {
+				t.Errorf("ran %d changes to users, want none", n)
+			}
+		})
+	}
+}
+
+func TestRoleChangeDisconnectsUser(t *testing.T) {
+	caller := &models.User{ID: "caller", Username: "caller"}
+	for _, isAdmin := range []bool{false, true} {
+		t.Run(fmt.Sprintf("is_admin=%v", isAdmin), func(t *testing.T) {
+			fake := dbtest.UseFake(t)
+			columns := []string{"id", "username", "display_name", "password_hash",
+				"is_admin", "is_bot", "is_active", "avatar_url", "last_seen_at", "created_at"}
+			fake.OnRows("UPDATE users SET is_admin", columns,
+				[]driver.Value{"root", "root", "root", "!", isAdmin, false, true, "", nil, time.Now()})
+			fake.OnRows("FROM users WHERE id = $1", columns,
+				[]driver.Value{"root", "root", "root", "!", true, false, true, "", nil, time.Now()})
+			fake.OnRows("WHERE is_admin AND is_active FOR UPDATE", []string{"id"},
+				[]driver.Value{"root"}, []driver.Value{"other"})
+			notifications := useRecordingNotifier(t)
+
+			rec := serve(t, "PATCH /api/users/{id}/admin", SetUserAdminHandler, "PATCH", "/api/users/root/admin",
+				models.UserAdminRequest{IsAdmin: &isAdmin}, caller)
+			decode(t, rec, http.StatusOK, nil)
+
+			// root starts as an admin, so only a demotion changes the role.
+			want := []string(nil)
+			if !isAdmin {
+				want = []string{"root"}
+			}
+			if !slices.Equal(notifications.disconnected, want) {
+				t.Errorf("disconnected %v, want %v", notifications.disconnected, want)
+			}
+		})
+	}
+}
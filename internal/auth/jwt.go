@@ -2,15 +2,57 @@
 package auth
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
+	"log"
+	"os"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
+// defaultJWTSecret is only for local development. Anyone who knows it
+// can forge tokens, so real deployments must set CHATGO_JWT_SECRET.
+const defaultJWTSecret = "your-secret-key-change-in-production"
+
 // JWTSecret is the key used to sign tokens.
-// In production, this should come from an environment variable!
-var JWTSecret = []byte("your-secret-key-change-in-production")
+// Call InitJWTSecret at startup to load it from the environment.
+var JWTSecret = []byte(defaultJWTSecret)
+
+// InitJWTSecret loads JWTSecret from the CHATGO_JWT_SECRET environment variable.
+// Returns false (and logs a warning) if the variable is unset and the
+// insecure default is still in use.
+func InitJWTSecret() bool {
+	secret := os.Getenv("CHATGO_JWT_SECRET")
+	if secret == "" {
+		log.Println("WARNING: CHATGO_JWT_SECRET is not set; using the insecure default JWT secret. Do not run like this in production!")
+		JWTSecret = []byte(defaultJWTSecret)
+		return false
+	}
+
+	JWTSecret = []byte(secret)
+	return true
+}
+
+// TokenTTL is how long a newly issued access token stays valid.
+// Override at startup (e.g. from CHATGO_TOKEN_TTL); tokens already issued
+// keep the expiry they were signed with.
+var TokenTTL = 24 * time.Hour
+
+// TokenIssuer and TokenAudience are stamped into every token as "iss" and
+// "aud", and ValidateToken rejects tokens that don't carry both. Give each
+// deployment its own (e.g. from CHATGO_JWT_ISSUER and CHATGO_JWT_AUDIENCE) so
+// a token from one instance isn't accepted by another that shares the secret.
+var (
+	TokenIssuer   = "chatgo"
+	TokenAudience = "chatgo"
+)
+
+// TokenLeeway is how far ValidateToken lets the expiry, issued-at and
+// not-before times be off, so small clock skew between servers doesn't cause
+// spurious 401s. Set from CHATGO_TOKEN_LEEWAY; zero checks them exactly.
+var TokenLeeway = 30 * time.Second
 
 // Claims contains the data we store in the JWT token.
 // jwt.RegisteredClaims includes standard fields like expiration time.
@@ -22,10 +64,24 @@ type Claims struct {
 }
 
 // GenerateToken creates a new JWT token for a user.
-// The token expires after 24 hours.
+// The token expires after TokenTTL.
 func GenerateToken(userID, username string, isAdmin bool) (string, error) {
-	// Set expiration time to 24 hours from now.
-	expirationTime := time.Now().Add(24 * time.Hour)
+	token, _, err := IssueToken(userID, username, isAdmin)
+	return token, err
+}
+
+// IssueToken is like GenerateToken, but also returns the token's jti, e.g.
+// to record it as the user's current session.
+func IssueToken(userID, username string, isAdmin bool) (token, jti string, err error) {
+	// Set expiration time TokenTTL from now.
+	expirationTime := time.Now().Add(TokenTTL)
+
+	// Give every token a random ID (jti) so it can be revoked on logout.
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", "", fmt.Errorf("failed to generate token id: %w", err)
+	}
+	jti = hex.EncodeToString(id)
 
 	// Create the claims (the data inside the token).
 	claims := &Claims{
@@ -33,6 +89,9 @@ func GenerateToken(userID, username string, isAdmin bool) (string, error) {
 		Username: username,
 		IsAdmin:  isAdmin,
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
+			Issuer:    TokenIssuer,
+			Audience:  jwt.ClaimStrings{TokenAudience},
 			ExpiresAt: jwt.NewNumericDate(expirationTime),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
@@ -40,19 +99,20 @@ func GenerateToken(userID, username string, isAdmin bool) (string, error) {
 
 	// Create the token with HS256 signing method.
 	// HS256 = HMAC with SHA-256 (symmetric encryption).
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	unsigned := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 
 	// Sign the token with our secret key.
-	tokenString, err := token.SignedString(JWTSecret)
+	token, err = unsigned.SignedString(JWTSecret)
 	if err != nil {
-		return "", fmt.Errorf("failed to sign token: %w", err)
+		return "", "", fmt.Errorf("failed to sign token: %w", err)
 	}
 
-	return tokenString, nil
+	return token, jti, nil
 }
 
 // ValidateToken checks if a token is valid and returns the claims.
-// Returns nil and error if the token is invalid or expired.
+// Returns nil and error if the token is invalid, expired or revoked, or (in
+// SingleSession mode) from a session that has since been replaced.
 func ValidateToken(tokenString string) (*Claims, error) {
 	claims := &Claims{}
 
@@ -63,7 +123,7 @@ func ValidateToken(tokenString string) (*Claims, error) {
 			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 		}
 		return JWTSecret, nil
-	})
+	}, parserOptions()...)
 
 	if err != nil {
 		return nil, fmt.Errorf("invalid token: %w", err)
@@ -73,5 +133,24 @@ func ValidateToken(tokenString string) (*Claims, error) {
 		return nil, fmt.Errorf("token is not valid")
 	}
 
+	if claims.ID != "" && IsTokenRevoked(claims.ID) {
+		return nil, fmt.Errorf("token has been revoked")
+	}
+
+	if err := checkSession(claims); err != nil {
+		return nil, err
+	}
+
 	return claims, nil
 }
+
+// parserOptions are the checks ValidateToken asks the JWT parser for, on top
+// of the signature and expiry.
+func parserOptions() []jwt.ParserOption {
+	return []jwt.ParserOption{
+		jwt.WithIssuer(TokenIssuer),
+		jwt.WithAudience(TokenAudience),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(TokenLeeway),
+	}
+}
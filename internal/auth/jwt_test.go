@@ -0,0 +1,86 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+// issueWithTTL issues a token for a test user that expires ttl from now;
+// a negative ttl gives a token that has already expired.
+func issueWithTTL(t *testing.T, ttl time.Duration) (token, jti string) {
+	t.Helper()
+	saved := TokenTTL
+	TokenTTL = ttl
+	defer func() { TokenTTL = saved }()
+
+	token, jti, err := IssueToken("user-1", "alice", false)
+	if err != nil {
+		t.Fatalf("IssueToken: %v", err)
+	}
+	return token, jti
+}
+
+// withLeeway sets TokenLeeway for the rest of the test.
+func withLeeway(t *testing.T, leeway time.Duration) {
+	t.Helper()
+	saved := TokenLeeway
+	TokenLeeway = leeway
+	t.Cleanup(func() { TokenLeeway = saved })
+}
+
+func TestValidateTokenAcceptsRecentExpiryWithinLeeway(t *testing.T) {
+	withLeeway(t, 30*time.Second)
+	token, _ := issueWithTTL(t, -10*time.Second)
+
+	claims, err := ValidateToken(token)
+	if err != nil {
+		t.Fatalf("token expired 10s ago was rejected: %v", err)
+	}
+	if claims.UserID != "user-1" {
+		t.Errorf("UserID = %q, want user-1", claims.UserID)
+	}
+}
+
+func TestValidateTokenRejectsExpiryBeyondLeeway(t *testing.T) {
+	withLeeway(t, 30*time.Second)
+	token, _ := issueWithTTL(t, -5*time.Minute)
+
+	if _, err := ValidateToken(token); err == nil {
+		t.Fatal("token expired 5min ago was accepted")
+	}
+}
+
+func TestValidateTokenWithoutLeewayRejectsAnyExpiry(t *testing.T) {
+	withLeeway(t, 0)
+	token, _ := issueWithTTL(t, -10*time.Second)
+
+	if _, err := ValidateToken(token); err == nil {
+		t.Fatal("expired token was accepted with no leeway")
+	}
+}
+
+func TestRevokedTokenStaysRevokedWithinLeeway(t *testing.T) {
+	withLeeway(t, 30*time.Second)
+	token, jti := issueWithTTL(t, -10*time.Second)
+
+	RevokeToken(jti, time.Now().Add(-10*time.Second))
+	// Another revocation sweeps expired entries; this one must survive it,
+	// since ValidateToken would still accept the token.
+	RevokeToken("other", time.Now().Add(time.Hour))
+
+	if _, err := ValidateToken(token); err == nil {
+		t.Fatal("revoked token was accepted again inside the leeway window")
+	}
+}
+
+func TestValidateTokenRejectsOtherAudience(t *testing.T) {
+	token, _ := issueWithTTL(t, time.Hour)
+
+	saved := TokenAudience
+	TokenAudience = "other-instance"
+	defer func() { TokenAudience = saved }()
+
+	if _, err := ValidateToken(token); err == nil {
+		t.Fatal("token for another audience was accepted")
+	}
+}
@@ -2,16 +2,62 @@
 package auth
 
 import (
+	"errors"
+	"fmt"
+	"strings"
+
 	"golang.org/x/crypto/bcrypt"
 )
 
+// BcryptCost is the bcrypt work factor for new password hashes.
+// Override at startup (e.g. from CHATGO_BCRYPT_COST); it must be between
+// bcrypt.MinCost and bcrypt.MaxCost. Existing hashes keep the cost they were
+// made with until NeedsRehash says to upgrade them.
+var BcryptCost = bcrypt.DefaultCost
+
+// MinPasswordLength is the shortest password ValidatePassword accepts.
+// Override at startup (e.g. from CHATGO_MIN_PASSWORD_LENGTH).
+var MinPasswordLength = 8
+
+// MaxPasswordLength is the longest password ValidatePassword accepts.
+// bcrypt ignores everything past 72 bytes, so longer passwords would be
+// silently truncated.
+const MaxPasswordLength = 72
+
+// commonPasswords are rejected outright: they're the first guesses of any
+// password-spraying attack. Compared case-insensitively.
+var commonPasswords = map[string]bool{
+	"password": true, "password1": true, "password123": true,
+	"12345678": true, "123456789": true, "1234567890": true,
+	"qwerty123": true, "qwertyuiop": true, "iloveyou": true,
+	"admin123": true, "letmein1": true, "welcome1": true,
+	"changeme": true, "11111111": true, "00000000": true,
+	"abc12345": true, "sunshine": true, "football": true,
+}
+
+// ValidatePassword checks a new password against the password policy.
+// The returned error describes the requirement that wasn't met and is
+// suitable to show to the user.
+func ValidatePassword(password string) error {
+	if len(password) < MinPasswordLength {
+		return fmt.Errorf("password must be at least %d characters", MinPasswordLength)
+	}
+	if len(password) > MaxPasswordLength {
+		return fmt.Errorf("password must be at most %d bytes", MaxPasswordLength)
+	}
+	if commonPasswords[strings.ToLower(password)] {
+		return errors.New("password is too common, choose another")
+	}
+	return nil
+}
+
 // HashPassword takes a plain text password and returns a bcrypt hash.
 // The hash is safe to store in the database.
 // bcrypt automatically includes a random "salt" to prevent rainbow table attacks.
 func HashPassword(password string) (string, error) {
-	// bcrypt.DefaultCost = 10 - this controls how slow the hashing is.
+	// BcryptCost (10 by default) controls how slow the hashing is.
 	// Slower = more secure against brute force, but uses more CPU.
-	bytes, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	bytes, err := bcrypt.GenerateFromPassword([]byte(password), BcryptCost)
 	if err != nil {
 		return "", err
 	}
@@ -25,3 +71,14 @@ func CheckPassword(password, hash string) bool {
 	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
 	return err == nil
 }
+
+// NeedsRehash reports whether a stored hash was made with a lower cost than
+// BcryptCost, so it should be replaced the next time we see the plaintext
+// (i.e. on a successful login). Unparseable hashes are left alone.
+func NeedsRehash(hash string) bool {
+	cost, err := bcrypt.Cost([]byte(hash))
+	if err != nil {
+		return false
+	}
+	return cost < BcryptCost
+}
@@ -0,0 +1,40 @@
+// Package auth - refresh and invite token helpers
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+// RefreshTokenTTL is the absolute lifetime of a refresh token.
+var RefreshTokenTTL = 30 * 24 * time.Hour
+
+// RefreshIdleTTL is how long a refresh token may go unused before it stops
+// working. Zero disables the idle check, so only RefreshTokenTTL applies.
+// Security-conscious deployments set this so a forgotten tab expires sooner.
+var RefreshIdleTTL time.Duration
+
+// InviteTTL is how long a signup invite stays valid.
+var InviteTTL = 7 * 24 * time.Hour
+
+// GenerateOpaqueToken creates a new random token (used for refresh tokens and invites).
+// Returns the token to hand to the client and the hash to store in the database.
+func GenerateOpaqueToken() (token, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", fmt.Errorf("failed to generate token: %w", err)
+	}
+	token = base64.RawURLEncoding.EncodeToString(b)
+	return token, HashOpaqueToken(token), nil
+}
+
+// HashOpaqueToken returns the hash we store for an opaque token.
+// SHA-256 is enough here (unlike passwords) because the token is random.
+func HashOpaqueToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
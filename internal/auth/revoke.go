@@ -0,0 +1,47 @@
+// Package auth - access token revocation
+package auth
+
+import (
+	"sync"
+	"time"
+)
+
+// revokedTokens holds the jti of every access token revoked before it expired,
+// mapped to that expiry. Once a token is more than TokenLeeway past its expiry
+// ValidateToken rejects it anyway, so the entry can be dropped.
+//
+// The list is in memory and per-process: it is lost on restart and not shared
+// between servers. That's acceptable for a single instance because access
+// tokens are short-lived; a multi-server deployment needs a shared store.
+var (
+	revokedMutex  sync.Mutex
+	revokedTokens = make(map[string]time.Time)
+)
+
+// RevokeToken marks the token with the given jti as revoked until expiresAt.
+func RevokeToken(jti string, expiresAt time.Time) {
+	revokedMutex.Lock()
+	defer revokedMutex.Unlock()
+
+	// Clean up entries for tokens that have expired by now.
+	// Revocations are rare (logout), so a full sweep here is cheap enough.
+	// ValidateToken still accepts a token up to TokenLeeway past its expiry,
+	// so keep the entry until then.
+	now := time.Now()
+	for id, exp := range revokedTokens {
+		if now.After(exp.Add(TokenLeeway)) {
+			delete(revokedTokens, id)
+		}
+	}
+
+	revokedTokens[jti] = expiresAt
+}
+
+// IsTokenRevoked reports whether the token with the given jti was revoked.
+func IsTokenRevoked(jti string) bool {
+	revokedMutex.Lock()
+	defer revokedMutex.Unlock()
+
+	_, revoked := revokedTokens[jti]
+	return revoked
+}
@@ -0,0 +1,41 @@
+// Package auth - single-session mode
+package auth
+
+import (
+	"errors"
+	"fmt"
+)
+
+// SingleSession allows each user one signed-in session at a time: signing in
+// again invalidates every token issued before. Off by default, since it rules
+// out using several devices at once and costs a database lookup per request.
+var SingleSession bool
+
+// CurrentSessionID returns the jti of the user's current session, or "" if
+// none is recorded. Used by ValidateToken when SingleSession is on; main sets
+// it to db.GetCurrentSessionID (auth can't import db).
+var CurrentSessionID func(userID string) (string, error)
+
+// ErrSessionReplaced means the token belongs to a session that was replaced
+// by a newer sign-in.
+var ErrSessionReplaced = errors.New("session replaced by a newer sign-in")
+
+// checkSession rejects tokens that don't belong to the user's current session.
+// Does nothing unless SingleSession is on.
+func checkSession(claims *Claims) error {
+	if !SingleSession {
+		return nil
+	}
+	if CurrentSessionID == nil {
+		return errors.New("single-session mode has no session lookup")
+	}
+
+	current, err := CurrentSessionID(claims.UserID)
+	if err != nil {
+		return fmt.Errorf("failed to check session: %w", err)
+	}
+	if claims.ID == "" || claims.ID != current {
+		return ErrSessionReplaced
+	}
+	return nil
+}
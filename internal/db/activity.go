@@ -0,0 +1,43 @@
+// Package db - aggregate activity queries
+package db
+
+import (
+	"fmt"
+	"time"
+
+	"chatgo/internal/models"
+)
+
+// GetMessageActivity counts messages per time bucket between from (inclusive)
+// and to (exclusive). bucket must be a date_trunc unit: "hour" or "day".
+// Buckets without messages are left out.
+func GetMessageActivity(from, to time.Time, bucket string) ([]models.ActivityBucket, error) {
+	if bucket != "hour" && bucket != "day" {
+		return nil, fmt.Errorf("invalid bucket: %q", bucket)
+	}
+
+	query := `
+		SELECT date_trunc($1, created_at) AS bucket, COUNT(*)
+		FROM messages
+		WHERE created_at >= $2 AND created_at < $3
+		GROUP BY bucket
+		ORDER BY bucket
+	`
+
+	rows, err := DB.Query(query, bucket, from.UTC(), to.UTC())
+	if err != nil {
+		return nil, fmt.Errorf("failed to query activity: %w", err)
+	}
+	defer rows.Close()
+
+	var buckets []models.ActivityBucket
+	for rows.Next() {
+		var b models.ActivityBucket
+		if err := rows.Scan(&b.Start, &b.MessageCount); err != nil {
+			return nil, fmt.Errorf("failed to scan activity: %w", err)
+		}
+		buckets = append(buckets, b)
+	}
+
+	return buckets, nil
+}
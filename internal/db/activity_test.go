@@ -0,0 +1,49 @@
+package db_test
+
+import (
+	"testing"
+	"time"
+
+	"chatgo/internal/db"
+	"chatgo/internal/dbtest"
+)
+
+func TestGetMessageActivityBucketsByHour(t *testing.T) {
+	dbtest.Open(t)
+	alice := dbtest.User(t, "alice")
+	bob := dbtest.User(t, "bob")
+	conv := dbtest.Direct(t, alice, bob)
+
+	ten := time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC)
+	sentAt := []time.Time{
+		ten.Add(5 * time.Minute),
+		ten.Add(40 * time.Minute),
+		ten.Add(59*time.Minute + 59*time.Second),
+		ten.Add(75 * time.Minute),
+		ten.Add(-time.Minute), // Before the range
+	}
+	for _, at := range sentAt {
+		msg := dbtest.Message(t, conv, alice, "hi")
+		if _, err := db.DB.Exec(`UPDATE messages SET created_at = $1 WHERE id = $2`, at, msg.ID); err != nil {
+			t.Fatalf("failed to backdate message: %v", err)
+		}
+	}
+
+	buckets, err := db.GetMessageActivity(ten, ten.Add(2*time.Hour), "hour")
+	if err != nil {
+		t.Fatalf("GetMessageActivity: %v", err)
+	}
+	if len(buckets) != 2 {
+		t.Fatalf("got %d buckets, want 2: %+v", len(buckets), buckets)
+	}
+	if !buckets[0].Start.Equal(ten) || buckets[0].MessageCount != 3 {
+		t.Errorf("first bucket = %+v, want 3 messages from %v", buckets[0], ten)
+	}
+	if !buckets[1].Start.Equal(ten.Add(time.Hour)) || buckets[1].MessageCount != 1 {
+		t.Errorf("second bucket = %+v, want 1 message from %v", buckets[1], ten.Add(time.Hour))
+	}
+
+	if _, err := db.GetMessageActivity(ten, ten.Add(time.Hour), "minute"); err == nil {
+		t.Error("a minute bucket was accepted")
+	}
+}
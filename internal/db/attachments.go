@@ -0,0 +1,78 @@
+// Package db - message attachment database operations
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/lib/pq"
+
+	"chatgo/internal/models"
+)
+
+// execer is implemented by both *sql.DB and *sql.Tx.
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// AddAttachment stores the metadata of a file attached to a message.
+func AddAttachment(messageID string, a models.Attachment) error {
+	ctx, cancel := withTimeout(context.Background())
+	defer cancel()
+	return addAttachment(ctx, DB, messageID, a)
+}
+
+// addAttachment implements AddAttachment, inside a transaction if given one.
+func addAttachment(ctx context.Context, db execer, messageID string, a models.Attachment) error {
+	query := `INSERT INTO attachments
+	          (message_id, url, filename, mime_type, size, width, height, thumbnail_url)
+	          VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
+
+	_, err := db.ExecContext(ctx, query, messageID, a.URL, a.Filename, a.MimeType, a.Size, a.Width, a.Height, a.ThumbnailURL)
+	if err != nil {
+		return fmt.Errorf("failed to add attachment: %w", err)
+	}
+	return nil
+}
+
+// loadAttachments fills in the Attachments of each message with one query.
+func loadAttachments(ctx context.Context, messages []models.Message) error {
+	if len(messages) == 0 {
+		return nil
+	}
+
+	ids := make([]string, len(messages))
+	for i := range messages {
+		ids[i] = messages[i].ID
+	}
+
+	query := `
+		SELECT message_id, url, filename, mime_type, size, width, height, thumbnail_url
+		FROM attachments
+		WHERE message_id = ANY($1::uuid[])
+		ORDER BY created_at, id
+	`
+
+	rows, err := DB.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return fmt.Errorf("failed to query attachments: %w", err)
+	}
+	defer rows.Close()
+
+	byMessage := make(map[string][]models.Attachment)
+	for rows.Next() {
+		var messageID string
+		var a models.Attachment
+		err := rows.Scan(&messageID, &a.URL, &a.Filename, &a.MimeType, &a.Size, &a.Width, &a.Height, &a.ThumbnailURL)
+		if err != nil {
+			return fmt.Errorf("failed to scan attachment: %w", err)
+		}
+		byMessage[messageID] = append(byMessage[messageID], a)
+	}
+
+	for i := range messages {
+		messages[i].Attachments = byMessage[messages[i].ID]
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+// Package db - user block database operations
+package db
+
+import (
+	"fmt"
+)
+
+// BlockUser records that blockerID has blocked blockedID.
+// Blocking someone who is already blocked is not an error.
+func BlockUser(blockerID, blockedID string) error {
+	_, err := DB.Exec(
+		`INSERT INTO blocks (blocker_id, blocked_id) VALUES ($1, $2) ON CONFLICT DO NOTHING`,
+		blockerID, blockedID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to block user: %w", err)
+	}
+	return nil
+}
+
+// UnblockUser removes blockerID's block on blockedID.
+// Returns false if there was no such block.
+func UnblockUser(blockerID, blockedID string) (bool, error) {
+	result, err := DB.Exec(
+		`DELETE FROM blocks WHERE blocker_id = $1 AND blocked_id = $2`,
+		blockerID, blockedID,
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to unblock user: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to check unblock result: %w", err)
+	}
+	return rows > 0, nil
+}
+
+// IsBlocked reports whether blockerID has blocked blockedID.
+func IsBlocked(blockerID, blockedID string) (bool, error) {
+	var blocked bool
+	err := DB.QueryRow(
+		`SELECT EXISTS(SELECT 1 FROM blocks WHERE blocker_id = $1 AND blocked_id = $2)`,
+		blockerID, blockedID,
+	).Scan(&blocked)
+	if err != nil {
+		return false, fmt.Errorf("failed to check block: %w", err)
+	}
+	return blocked, nil
+}
+
+// IsBlockedEitherWay reports whether either user has blocked the other.
+func IsBlockedEitherWay(userID1, userID2 string) (bool, error) {
+	var blocked bool
+	err := DB.QueryRow(
+		`SELECT EXISTS(
+			SELECT 1 FROM blocks
+			WHERE (blocker_id = $1 AND blocked_id = $2) OR (blocker_id = $2 AND blocked_id = $1)
+		)`,
+		userID1, userID2,
+	).Scan(&blocked)
+	if err != nil {
+		return false, fmt.Errorf("failed to check block: %w", err)
+	}
+	return blocked, nil
+}
+
+// GetBlockedIDs returns the IDs of the users blockerID has blocked.
+func GetBlockedIDs(blockerID string) ([]string, error) {
+	return queryIDs(`SELECT blocked_id FROM blocks WHERE blocker_id = $1`, blockerID)
+}
+
+// GetBlockerIDs returns the IDs of the users who have blocked blockedID.
+func GetBlockerIDs(blockedID string) ([]string, error) {
+	return queryIDs(`SELECT blocker_id FROM blocks WHERE blocked_id = $1`, blockedID)
+}
+
+// queryIDs runs a query selecting a single ID column and collects the results.
+func queryIDs(query string, args ...interface{}) ([]string, error) {
+	rows, err := DB.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query blocks: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan blocked user id: %w", err)
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
@@ -0,0 +1,55 @@
+package db_test
+
+import (
+	"testing"
+
+	"chatgo/internal/db"
+	"chatgo/internal/dbtest"
+	"chatgo/internal/models"
+)
+
+// senders lists who sent each message.
+func senders(messages []models.Message) []string {
+	names := make([]string, len(messages))
+	for i, m := range messages {
+		names[i] = m.SenderUsername
+	}
+	return names
+}
+
+func TestReplayLeavesOutBlockedSenders(t *testing.T) {
+	dbtest.Open(t)
+	alice := dbtest.User(t, "alice")
+	bob := dbtest.User(t, "bob")
+	carol := dbtest.User(t, "carol")
+	group := dbtest.Group(t, "team", alice, bob, carol)
+
+	first := dbtest.Message(t, group, carol, "before")
+	dbtest.Message(t, group, alice, "from alice")
+	dbtest.Message(t, group, carol, "from carol")
+
+	if err := db.BlockUser(bob.ID, alice.ID); err != nil {
+		t.Fatalf("BlockUser: %v", err)
+	}
+
+	since, err := db.GetMessagesSince(bob.ID, first.ID, 50)
+	if err != nil {
+		t.Fatalf("GetMessagesSince: %v", err)
+	}
+	if got := senders(since); len(got) != 1 || got[0] != "carol" {
+		t.Errorf("bob's replay since = %v, want just carol's", got)
+	}
+
+	afterSeqs, err := db.GetMessagesAfterSeqs(bob.ID, map[string]int64{group.ID: first.Seq}, 50)
+	if err != nil {
+		t.Fatalf("GetMessagesAfterSeqs: %v", err)
+	}
+	if got := senders(afterSeqs); len(got) != 1 || got[0] != "carol" {
+		t.Errorf("bob's replay after seqs = %v, want just carol's", got)
+	}
+
+	// Only the blocker is affected.
+	if since, _ := db.GetMessagesSince(carol.ID, first.ID, 50); len(since) != 2 {
+		t.Errorf("carol's replay has %d messages, want 2", len(since))
+	}
+}
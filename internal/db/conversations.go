@@ -2,25 +2,62 @@
 package db
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"strings"
 
+	"github.com/lib/pq"
+
 	"chatgo/internal/models"
 )
 
+const (
+	// MinGroupSize is the fewest distinct participants a new group may have,
+	// creator included. Two people talk in a 1:1 conversation instead.
+	MinGroupSize = 3
+
+	// MaxGroupSize is the largest number of participants a group may have.
+	MaxGroupSize = 1000
+
+	// participantInsertChunk is how many participants go in one INSERT,
+	// so large groups don't produce one huge statement.
+	participantInsertChunk = 500
+)
+
+// ErrSelfConversation is returned when a user tries to open a 1:1
+// conversation with themselves.
+var ErrSelfConversation = errors.New("cannot create a conversation with yourself")
+
+// ErrBlocked is returned when a new 1:1 conversation is refused because one
+// of the two users has blocked the other.
+var ErrBlocked = errors.New("cannot create a conversation with this user")
+
+// Errors returned when a new group has the wrong number of participants.
+var (
+	ErrGroupTooFewParticipants  = fmt.Errorf("group conversation requires at least %d distinct participants", MinGroupSize)
+	ErrGroupTooManyParticipants = fmt.Errorf("group conversation allows at most %d participants", MaxGroupSize)
+)
+
 // GetOrCreateConversation finds an existing 1:1 conversation between two users,
 // or creates a new one if it doesn't exist.
+// Returns ErrSelfConversation if both IDs are the same user, and ErrBlocked
+// if there's no conversation yet and either user has blocked the other.
 func GetOrCreateConversation(userID1, userID2 string) (*models.Conversation, error) {
+	if userID1 == userID2 {
+		return nil, ErrSelfConversation
+	}
+
 	// First, try to find an existing 1:1 conversation between these two users.
-	// A 1:1 conversation has exactly 2 participants and no name.
+	// A 1:1 conversation has exactly 2 participants and isn't a group.
 	query := `
 		SELECT c.id, c.created_at
 		FROM conversations c
 		JOIN conversation_participants cp1 ON c.id = cp1.conversation_id
 		JOIN conversation_participants cp2 ON c.id = cp2.conversation_id
 		WHERE cp1.user_id = $1 AND cp2.user_id = $2
-		AND c.name IS NULL
+		AND NOT c.is_group
 		AND (SELECT COUNT(*) FROM conversation_participants WHERE conversation_id = c.id) = 2
 		LIMIT 1
 	`
@@ -37,6 +74,15 @@ func GetOrCreateConversation(userID1, userID2 string) (*models.Conversation, err
 		return nil, fmt.Errorf("failed to find conversation: %w", err)
 	}
 
+	// Blocked users keep any conversation they already had, but can't start one.
+	blocked, err := IsBlockedEitherWay(userID1, userID2)
+	if err != nil {
+		return nil, err
+	}
+	if blocked {
+		return nil, ErrBlocked
+	}
+
 	// No existing conversation - create a new one.
 	// Use a transaction to ensure both inserts succeed or fail together.
 	tx, err := DB.Begin()
@@ -71,9 +117,16 @@ func GetOrCreateConversation(userID1, userID2 string) (*models.Conversation, err
 }
 
 // CreateGroupConversation creates a new group conversation with the given name and participants.
-func CreateGroupConversation(name string, userIDs []string) (*models.Conversation, error) {
-	if len(userIDs) < 2 {
-		return nil, fmt.Errorf("group conversation requires at least 2 participants")
+// The creator is added to userIDs if missing and becomes the group's owner.
+// Duplicate IDs are dropped before the size is checked against MinGroupSize
+// and MaxGroupSize (ErrGroupTooFewParticipants, ErrGroupTooManyParticipants).
+func CreateGroupConversation(name, creatorID string, userIDs []string) (*models.Conversation, error) {
+	userIDs = dedupeIDs(append([]string{creatorID}, userIDs...))
+	if len(userIDs) < MinGroupSize {
+		return nil, ErrGroupTooFewParticipants
+	}
+	if len(userIDs) > MaxGroupSize {
+		return nil, ErrGroupTooManyParticipants
 	}
 
 	tx, err := DB.Begin()
@@ -84,7 +137,7 @@ func CreateGroupConversation(name string, userIDs []string) (*models.Conversatio
 
 	var conv models.Conversation
 	err = tx.QueryRow(
-		`INSERT INTO conversations (name) VALUES ($1) RETURNING id, created_at`,
+		`INSERT INTO conversations (name, is_group) VALUES ($1, TRUE) RETURNING id, created_at`,
 		name,
 	).Scan(&conv.ID, &conv.CreatedAt)
 	if err != nil {
@@ -92,10 +145,48 @@ func CreateGroupConversation(name string, userIDs []string) (*models.Conversatio
 	}
 	conv.Name = name
 
-	// Build the insert statement for all participants
+	// Insert participants in chunks to keep each statement a reasonable size
+	for start := 0; start < len(userIDs); start += participantInsertChunk {
+		end := min(start+participantInsertChunk, len(userIDs))
+		if err := insertParticipants(tx, conv.ID, userIDs[start:end]); err != nil {
+			return nil, err
+		}
+	}
+
+	_, err = tx.Exec(
+		`UPDATE conversation_participants SET role = $1 WHERE conversation_id = $2 AND user_id = $3`,
+		models.RoleOwner, conv.ID, creatorID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set group owner: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return &conv, nil
+}
+
+// dedupeIDs returns ids without repeats, keeping the first occurrence of each.
+func dedupeIDs(ids []string) []string {
+	seen := make(map[string]bool, len(ids))
+	unique := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	return unique
+}
+
+// insertParticipants adds users to a conversation with a single INSERT.
+func insertParticipants(tx *sql.Tx, conversationID string, userIDs []string) error {
+	// Build the insert statement for these participants
 	valueStrings := make([]string, len(userIDs))
 	valueArgs := make([]interface{}, len(userIDs)+1)
-	valueArgs[0] = conv.ID
+	valueArgs[0] = conversationID
 	for i, userID := range userIDs {
 		valueStrings[i] = fmt.Sprintf("($1, $%d)", i+2)
 		valueArgs[i+1] = userID
@@ -105,28 +196,142 @@ func CreateGroupConversation(name string, userIDs []string) (*models.Conversatio
 		`INSERT INTO conversation_participants (conversation_id, user_id) VALUES %s`,
 		strings.Join(valueStrings, ", "),
 	)
-	_, err = tx.Exec(insertQuery, valueArgs...)
+	_, err := tx.Exec(insertQuery, valueArgs...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to add participants: %w", err)
+		return fmt.Errorf("failed to add participants: %w", err)
+	}
+	return nil
+}
+
+// GetConversationSettings returns a conversation's settings together with
+// the given user's own settings for it.
+// Returns nil if the conversation doesn't exist or the user isn't a participant.
+func GetConversationSettings(conversationID, userID string) (*models.ConversationSettings, error) {
+	query := `
+		SELECT c.id, COALESCE(c.name, ''), c.is_group, c.read_only, c.created_at,
+			(SELECT COUNT(*) FROM conversation_participants WHERE conversation_id = c.id),
+			cp.role, cp.joined_at, COALESCE(cs.muted, FALSE)
+		FROM conversations c
+		JOIN conversation_participants cp ON cp.conversation_id = c.id AND cp.user_id = $2
+		LEFT JOIN conversation_settings cs ON cs.conversation_id = c.id AND cs.user_id = $2
+		WHERE c.id = $1
+	`
+
+	var settings models.ConversationSettings
+	err := DB.QueryRow(query, conversationID, userID).Scan(
+		&settings.ConversationID,
+		&settings.Name,
+		&settings.IsGroup,
+		&settings.ReadOnly,
+		&settings.CreatedAt,
+		&settings.ParticipantCount,
+		&settings.User.Role,
+		&settings.User.JoinedAt,
+		&settings.User.Muted,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get conversation settings: %w", err)
+	}
+
+	return &settings, nil
+}
+
+// SetConversationMuted mutes or unmutes a conversation for one user.
+// Muting only changes the notification hints clients get; messages are
+// still delivered.
+func SetConversationMuted(userID, conversationID string, muted bool) error {
+	query := `
+		INSERT INTO conversation_settings (user_id, conversation_id, muted)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id, conversation_id)
+		DO UPDATE SET muted = EXCLUDED.muted, updated_at = NOW()
+	`
+
+	if _, err := DB.Exec(query, userID, conversationID, muted); err != nil {
+		return fmt.Errorf("failed to update conversation settings: %w", err)
+	}
+	return nil
+}
+
+// DeleteConversation removes a conversation with its participants and
+// messages in one transaction. Everything hanging off the messages
+// (attachments, deliveries, read markers) goes with them by cascade.
+// Returns the IDs of the users who were in it, and deleted=false if no
+// conversation with that ID exists.
+func DeleteConversation(id string) (participantIDs []string, deleted bool, err error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Lock the conversation so nobody joins or posts while it's going away.
+	var locked string
+	err = tx.QueryRow(`SELECT id FROM conversations WHERE id = $1 FOR UPDATE`, id).Scan(&locked)
+	if err == sql.ErrNoRows {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to lock conversation: %w", err)
+	}
+
+	rows, err := tx.Query(
+		`DELETE FROM conversation_participants WHERE conversation_id = $1 RETURNING user_id`,
+		id,
+	)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to delete participants: %w", err)
+	}
+	for rows.Next() {
+		var userID string
+		if err := rows.Scan(&userID); err != nil {
+			rows.Close()
+			return nil, false, fmt.Errorf("failed to scan participant: %w", err)
+		}
+		participantIDs = append(participantIDs, userID)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, false, fmt.Errorf("failed to delete participants: %w", err)
+	}
+
+	// Messages go before the conversation row: read markers reference both,
+	// and deleting them all at once leaves no reply pointing outside the set.
+	if _, err = tx.Exec(`DELETE FROM messages WHERE conversation_id = $1`, id); err != nil {
+		return nil, false, fmt.Errorf("failed to delete messages: %w", err)
+	}
+	if _, err = tx.Exec(`DELETE FROM conversations WHERE id = $1`, id); err != nil {
+		return nil, false, fmt.Errorf("failed to delete conversation: %w", err)
 	}
 
 	if err = tx.Commit(); err != nil {
-		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+		return nil, false, fmt.Errorf("failed to commit transaction: %w", err)
 	}
 
-	return &conv, nil
+	return participantIDs, true, nil
 }
 
 // GetConversationParticipants returns all participants in a conversation.
 func GetConversationParticipants(conversationID string) ([]models.Participant, error) {
+	return GetConversationParticipantsContext(context.Background(), conversationID)
+}
+
+// GetConversationParticipantsContext is like GetConversationParticipants, but runs under ctx and is cut off after QueryTimeout.
+func GetConversationParticipantsContext(ctx context.Context, conversationID string) ([]models.Participant, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
 	query := `
-		SELECT u.id, u.username
+		SELECT u.id, u.username, u.display_name, u.avatar_url, u.last_seen_at
 		FROM users u
 		JOIN conversation_participants cp ON u.id = cp.user_id
 		WHERE cp.conversation_id = $1
 	`
 
-	rows, err := DB.Query(query, conversationID)
+	rows, err := DB.QueryContext(ctx, query, conversationID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query participants: %w", err)
 	}
@@ -135,58 +340,292 @@ func GetConversationParticipants(conversationID string) ([]models.Participant, e
 	var participants []models.Participant
 	for rows.Next() {
 		var p models.Participant
-		if err := rows.Scan(&p.ID, &p.Username); err != nil {
+		if err := rows.Scan(&p.ID, &p.Username, &p.DisplayName, &p.AvatarURL, &p.LastSeenAt); err != nil {
 			return nil, fmt.Errorf("failed to scan participant: %w", err)
 		}
+		p.LastSeenAt = utcPtr(p.LastSeenAt)
 		participants = append(participants, p)
 	}
 
 	return participants, nil
 }
 
-// GetUserConversations returns all conversations for a user with full participant lists.
-func GetUserConversations(userID string) ([]models.ConversationWithParticipants, error) {
-	// First, get all conversations the user is part of
-	convQuery := `
-		SELECT c.id, COALESCE(c.name, ''), c.created_at,
-			(SELECT COUNT(*) FROM conversation_participants WHERE conversation_id = c.id) as participant_count
+// GetConversationParticipantIDs returns the user IDs of everyone in a
+// conversation. It's the cheap lookup for message fan-out: one query on
+// conversation_participants, no user details.
+func GetConversationParticipantIDs(conversationID string) ([]string, error) {
+	rows, err := DB.Query(
+		`SELECT user_id FROM conversation_participants WHERE conversation_id = $1`,
+		conversationID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query participant ids: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan participant id: %w", err)
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
+
+// GetUserConversations returns a user's conversations with full participant
+// lists and a preview of the latest message, most recently active first.
+// convType restricts the result to models.ConversationTypeDirect or
+// models.ConversationTypeGroup; an empty string returns every conversation.
+// At most limit conversations are returned, skipping the first offset;
+// limit 0 means no limit. Ties in activity are broken by ID, so pages
+// don't overlap.
+func GetUserConversations(userID, convType string, limit, offset int) ([]models.ConversationWithParticipants, error) {
+	return GetUserConversationsContext(context.Background(), userID, convType, limit, offset)
+}
+
+// GetUserConversationsContext is like GetUserConversations, but runs under ctx and is cut off after QueryTimeout.
+func GetUserConversationsContext(ctx context.Context, userID, convType string, limit, offset int) ([]models.ConversationWithParticipants, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	isGroup, err := conversationTypeFilter(convType)
+	if err != nil {
+		return nil, err
+	}
+
+	// NULL means no limit
+	var pageLimit sql.NullInt64
+	if limit > 0 {
+		pageLimit = sql.NullInt64{Int64: int64(limit), Valid: true}
+	}
+
+	return queryUserConversations(ctx, userID, isGroup, sql.NullString{}, pageLimit, offset)
+}
+
+// CountUserConversations returns how many conversations of convType
+// userID is in, matching what GetUserConversations would list without a limit.
+func CountUserConversations(userID, convType string) (int, error) {
+	isGroup, err := conversationTypeFilter(convType)
+	if err != nil {
+		return 0, err
+	}
+
+	query := `
+		SELECT COUNT(*)
 		FROM conversations c
 		JOIN conversation_participants cp ON c.id = cp.conversation_id
 		WHERE cp.user_id = $1
-		ORDER BY c.created_at DESC
+		AND ($2::boolean IS NULL OR c.is_group = $2)
+	`
+
+	var count int
+	if err := DB.QueryRow(query, userID, isGroup).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count conversations: %w", err)
+	}
+	return count, nil
+}
+
+// conversationTypeFilter turns a models.ConversationType* value into the
+// is_group value to match. NULL means "any type".
+func conversationTypeFilter(convType string) (sql.NullBool, error) {
+	switch convType {
+	case "":
+		return sql.NullBool{}, nil
+	case models.ConversationTypeDirect:
+		return sql.NullBool{Bool: false, Valid: true}, nil
+	case models.ConversationTypeGroup:
+		return sql.NullBool{Bool: true, Valid: true}, nil
+	default:
+		return sql.NullBool{}, fmt.Errorf("unknown conversation type %q", convType)
+	}
+}
+
+// GetUserConversation returns one of a user's conversations, filled in the
+// same way as by GetUserConversations. Returns nil if the user isn't in it.
+func GetUserConversation(userID, conversationID string) (*models.ConversationWithParticipants, error) {
+	return GetUserConversationContext(context.Background(), userID, conversationID)
+}
+
+// GetUserConversationContext is like GetUserConversation, but runs under ctx and is cut off after QueryTimeout.
+func GetUserConversationContext(ctx context.Context, userID, conversationID string) (*models.ConversationWithParticipants, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	conversations, err := queryUserConversations(ctx, userID, sql.NullBool{}, sql.NullString{String: conversationID, Valid: true}, sql.NullInt64{}, 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(conversations) == 0 {
+		return nil, nil
+	}
+	return &conversations[0], nil
+}
+
+// queryUserConversations implements GetUserConversations and GetUserConversation.
+// NULL filters match everything, and a NULL limit returns every row.
+func queryUserConversations(ctx context.Context, userID string, isGroup sql.NullBool, conversationID sql.NullString, limit sql.NullInt64, offset int) ([]models.ConversationWithParticipants, error) {
+	// First, get the page of conversations the user is part of, most recently
+	// active first. last_message_at is set on every message insert, so the
+	// sort is on a column that idx_conversations_last_message covers; the ID
+	// breaks ties so the order is the same on every call. The lateral join
+	// then finds the preview message for just the conversations on the page.
+	convQuery := `
+		SELECT c.id, COALESCE(c.name, ''), c.is_group, c.created_at, lm.id, c.muted
+		FROM (
+			SELECT c.id, c.name, c.is_group, c.created_at, c.last_message_at, COALESCE(cs.muted, FALSE) AS muted
+			FROM conversations c
+			JOIN conversation_participants cp ON c.id = cp.conversation_id
+			LEFT JOIN conversation_settings cs ON cs.conversation_id = c.id AND cs.user_id = cp.user_id
+			WHERE cp.user_id = $1
+			AND ($2::boolean IS NULL OR c.is_group = $2)
+			AND ($3::uuid IS NULL OR c.id = $3)
+			ORDER BY c.last_message_at DESC, c.id DESC
+			LIMIT $4 OFFSET $5
+		) c
+		LEFT JOIN LATERAL (
+			SELECT m.id
+			FROM messages m
+			WHERE m.conversation_id = c.id AND m.deleted_at IS NULL
+			ORDER BY m.seq DESC
+			LIMIT 1
+		) lm ON TRUE
+		ORDER BY c.last_message_at DESC, c.id DESC
 	`
 
-	rows, err := DB.Query(convQuery, userID)
+	rows, err := DB.QueryContext(ctx, convQuery, userID, isGroup, conversationID, limit, offset)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query conversations: %w", err)
 	}
 	defer rows.Close()
 
 	var conversations []models.ConversationWithParticipants
+	var conversationIDs []string
+	var lastMessageIDs []string
 	for rows.Next() {
 		var conv models.ConversationWithParticipants
-		var participantCount int
-		err := rows.Scan(&conv.ID, &conv.Name, &conv.CreatedAt, &participantCount)
+		var lastMessageID sql.NullString
+		err := rows.Scan(&conv.ID, &conv.Name, &conv.IsGroup, &conv.CreatedAt, &lastMessageID, &conv.Muted)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan conversation: %w", err)
 		}
-		// A group has more than 2 participants OR has a name
-		conv.IsGroup = participantCount > 2 || conv.Name != ""
 		conversations = append(conversations, conv)
+		conversationIDs = append(conversationIDs, conv.ID)
+		if lastMessageID.Valid {
+			lastMessageIDs = append(lastMessageIDs, lastMessageID.String)
+		}
+	}
+	if len(conversations) == 0 {
+		return nil, nil
+	}
+
+	// Load the previews, participants and read markers in one batch each.
+	lastMessages, err := GetMessagesByIDsContext(ctx, lastMessageIDs, userID)
+	if err != nil {
+		return nil, err
+	}
+	lastByConv := make(map[string]*models.Message, len(lastMessages))
+	for i := range lastMessages {
+		lastByConv[lastMessages[i].ConversationID] = &lastMessages[i]
+	}
+
+	participants, err := getParticipantsByConversation(ctx, conversationIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	lastReads, err := getLastReads(ctx, userID, conversationIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	unreadCounts, err := getUnreadCounts(ctx, userID, conversationIDs)
+	if err != nil {
+		return nil, err
 	}
 
-	// For each conversation, get participants
 	for i := range conversations {
-		participants, err := GetConversationParticipants(conversations[i].ID)
-		if err != nil {
-			return nil, fmt.Errorf("failed to get participants for conversation %s: %w", conversations[i].ID, err)
-		}
-		conversations[i].Participants = participants
+		id := conversations[i].ID
+		conversations[i].UnreadCount = unreadCounts[id]
+		conversations[i].LastMessage = lastByConv[id]
+		conversations[i].Participants = participants[id]
+		conversations[i].LastRead = lastReads[id]
 	}
 
 	return conversations, nil
 }
 
+// getParticipantsByConversation returns the participants of each of the
+// given conversations, keyed by conversation ID, with one query.
+func getParticipantsByConversation(ctx context.Context, conversationIDs []string) (map[string][]models.Participant, error) {
+	query := `
+		SELECT cp.conversation_id, u.id, u.username, u.display_name, u.avatar_url, u.last_seen_at
+		FROM users u
+		JOIN conversation_participants cp ON u.id = cp.user_id
+		WHERE cp.conversation_id = ANY($1::uuid[])
+	`
+
+	rows, err := DB.QueryContext(ctx, query, pq.Array(conversationIDs))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query participants: %w", err)
+	}
+	defer rows.Close()
+
+	byConv := make(map[string][]models.Participant, len(conversationIDs))
+	for rows.Next() {
+		var conversationID string
+		var p models.Participant
+		if err := rows.Scan(&conversationID, &p.ID, &p.Username, &p.DisplayName, &p.AvatarURL, &p.LastSeenAt); err != nil {
+			return nil, fmt.Errorf("failed to scan participant: %w", err)
+		}
+		p.LastSeenAt = utcPtr(p.LastSeenAt)
+		byConv[conversationID] = append(byConv[conversationID], p)
+	}
+
+	return byConv, nil
+}
+
+// GetContactUserIDs returns the distinct IDs of everyone who shares at least
+// one conversation with userID, not including userID itself.
+func GetContactUserIDs(userID string) ([]string, error) {
+	query := `
+		SELECT DISTINCT other.user_id
+		FROM conversation_participants me
+		JOIN conversation_participants other
+			ON other.conversation_id = me.conversation_id AND other.user_id <> me.user_id
+		WHERE me.user_id = $1
+	`
+
+	rows, err := DB.Query(query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query contacts: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan contact: %w", err)
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
+
+// ConversationExists reports whether a conversation with this ID exists.
+func ConversationExists(id string) (bool, error) {
+	var exists bool
+	err := DB.QueryRow(`SELECT EXISTS(SELECT 1 FROM conversations WHERE id = $1)`, id).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("failed to check conversation: %w", err)
+	}
+	return exists, nil
+}
+
 // IsUserInConversation checks if a user is a participant in a conversation.
 func IsUserInConversation(userID, conversationID string) (bool, error) {
 	query := `SELECT 1 FROM conversation_participants WHERE user_id = $1 AND conversation_id = $2`
@@ -0,0 +1,140 @@
+package db_test
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"chatgo/internal/db"
+	"chatgo/internal/dbtest"
+)
+
+func TestCreateGroupConversationChunksParticipantInsert(t *testing.T) {
+	fake := dbtest.UseFake(t)
+	fake.OnRows("INSERT INTO conversations", []string{"id", "created_at"},
+		[]driver.Value{"conv-1", time.Now()})
+
+	members := make([]string, db.MaxGroupSize-1)
+	for i := range members {
+		members[i] = fmt.Sprintf("user-%d", i)
+	}
+	if _, err := db.CreateGroupConversation("everyone", "creator", members); err != nil {
+		t.Fatalf("CreateGroupConversation: %v", err)
+	}
+
+	calls := fake.Calls("INSERT INTO conversation_participants")
+	if len(calls) < 2 {
+		t.Fatalf("participants went in %d statement(s), want several", len(calls))
+	}
+	var inserted []string
+	for _, c := range calls {
+		if c.Args[0] != "conv-1" {
+			t.Errorf("chunk inserted into %v, want conv-1", c.Args[0])
+		}
+		if n := len(c.Args) - 1; n > 500 {
+			t.Errorf("one statement inserted %d participants, want at most 500", n)
+		}
+		for _, id := range c.Args[1:] {
+			inserted = append(inserted, id.(string))
+		}
+	}
+
+	want := append([]string{"creator"}, members...)
+	slices.Sort(inserted)
+	slices.Sort(want)
+	if !slices.Equal(inserted, want) {
+		t.Errorf("inserted %d participants, want each of the %d exactly once", len(inserted), len(want))
+	}
+}
+
+func TestCreateLargeGroupConversation(t *testing.T) {
+	dbtest.Open(t)
+	creator := dbtest.User(t, "creator")
+	var members []string
+	for i := range 600 {
+		members = append(members, dbtest.User(t, fmt.Sprintf("member-%d", i)).ID)
+	}
+
+	conv, err := db.CreateGroupConversation("everyone", creator.ID, members)
+	if err != nil {
+		t.Fatalf("CreateGroupConversation: %v", err)
+	}
+	ids, err := db.GetConversationParticipantIDs(conv.ID)
+	if err != nil {
+		t.Fatalf("GetConversationParticipantIDs: %v", err)
+	}
+	if len(ids) != len(members)+1 {
+		t.Errorf("group has %d participants, want %d", len(ids), len(members)+1)
+	}
+}
+
+func TestCreateGroupConversationNeedsThreeDistinctMembers(t *testing.T) {
+	fake := dbtest.UseFake(t)
+	for _, members := range [][]string{
+		{"other"},
+		{"other", "other"},
+		{"other", "creator", "other"},
+	} {
+		if _, err := db.CreateGroupConversation("pair", "creator", members); !errors.Is(err, db.ErrGroupTooFewParticipants) {
+			t.Errorf("creator + %v: error = %v, want ErrGroupTooFewParticipants", members, err)
+		}
+	}
+	if calls := fake.Calls("INSERT"); len(calls) != 0 {
+		t.Errorf("too-small groups ran %d inserts", len(calls))
+	}
+}
+
+func TestUserConversationsSortByLastMessage(t *testing.T) {
+	dbtest.Open(t)
+	alice, bob := dbtest.User(t, "alice"), dbtest.User(t, "bob")
+	withBob := dbtest.Direct(t, alice, bob)
+	withCarol := dbtest.Direct(t, alice, dbtest.User(t, "carol"))
+	withDave := dbtest.Direct(t, alice, dbtest.User(t, "dave"))
+	dbtest.Message(t, withBob, bob, "hi alice")
+
+	convs, err := db.GetUserConversations(alice.ID, "", 0, 0)
+	if err != nil {
+		t.Fatalf("GetUserConversations: %v", err)
+	}
+	var got []string
+	for _, c := range convs {
+		got = append(got, c.ID)
+	}
+	want := []string{withBob.ID, withDave.ID, withCarol.ID}
+	if !slices.Equal(got, want) {
+		t.Fatalf("order = %v, want %v (messaged first, then newest)", got, want)
+	}
+	if convs[0].UnreadCount != 1 || convs[0].LastMessage == nil || convs[0].LastMessage.Content != "hi alice" {
+		t.Errorf("conversation with bob = %+v, want 1 unread and bob's message as preview", convs[0])
+	}
+
+	page, err := db.GetUserConversations(alice.ID, "", 1, 1)
+	if err != nil {
+		t.Fatalf("GetUserConversations page: %v", err)
+	}
+	if len(page) != 1 || page[0].ID != withDave.ID {
+		t.Errorf("second page of one = %v, want only the conversation with dave", page)
+	}
+}
+
+func TestUserConversationsCountUnreadOnlyForPage(t *testing.T) {
+	fake := dbtest.UseFake(t)
+	fake.OnRows("ORDER BY c.last_message_at DESC", []string{"id", "name", "is_group", "created_at", "last_message_id", "muted"},
+		[]driver.Value{"conv-1", "", false, time.Now(), nil, false},
+		[]driver.Value{"conv-2", "", false, time.Now(), nil, false})
+
+	if _, err := db.GetUserConversations("alice", "", 2, 0); err != nil {
+		t.Fatalf("GetUserConversations: %v", err)
+	}
+
+	calls := fake.Calls("m.seq > COALESCE(cr.last_read_seq, 0)")
+	if len(calls) != 1 {
+		t.Fatalf("ran %d unread count queries, want 1", len(calls))
+	}
+	if ids := calls[0].Args[1]; ids != `{"conv-1","conv-2"}` {
+		t.Errorf("unread counts asked for %v, want just the page's conversations", ids)
+	}
+}
@@ -0,0 +1,54 @@
+// Package db - opaque pagination cursors
+package db
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"chatgo/internal/models"
+)
+
+// ErrInvalidCursor is returned when a client sends a cursor we didn't issue.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// MessageCursor marks a position in a conversation's message history.
+// Messages are ordered by seq, which is unique and strictly increasing within
+// a conversation, so paging by it never skips or repeats a message - even
+// when two messages share a created_at timestamp.
+type MessageCursor struct {
+	Seq int64
+	ID  string
+}
+
+// NewMessageCursor returns the cursor for a message.
+func NewMessageCursor(m *models.Message) MessageCursor {
+	return MessageCursor{Seq: m.Seq, ID: m.ID}
+}
+
+// Encode returns the cursor as an opaque string for clients.
+// Clients should treat it as a token and not parse it.
+func (c MessageCursor) Encode() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%d:%s", c.Seq, c.ID)))
+}
+
+// DecodeMessageCursor parses a string made by MessageCursor.Encode.
+func DecodeMessageCursor(s string) (MessageCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return MessageCursor{}, ErrInvalidCursor
+	}
+
+	seqPart, id, ok := strings.Cut(string(raw), ":")
+	if !ok || id == "" {
+		return MessageCursor{}, ErrInvalidCursor
+	}
+	seq, err := strconv.ParseInt(seqPart, 10, 64)
+	if err != nil || seq < 1 {
+		return MessageCursor{}, ErrInvalidCursor
+	}
+
+	return MessageCursor{Seq: seq, ID: id}, nil
+}
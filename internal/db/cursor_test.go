@@ -0,0 +1,71 @@
+package db_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"chatgo/internal/db"
+	"chatgo/internal/dbtest"
+	"chatgo/internal/models"
+)
+
+func TestMessageCursorRoundTrip(t *testing.T) {
+	c := db.NewMessageCursor(&models.Message{ID: "3f0c2a9e-0000-4000-8000-000000000001", Seq: 42})
+	got, err := db.DecodeMessageCursor(c.Encode())
+	if err != nil || got != c {
+		t.Errorf("DecodeMessageCursor(Encode()) = %+v, %v; want %+v", got, err, c)
+	}
+
+	for _, bad := range []string{"", "not base64!", "MTI", "YWJjOmlk", "MDppZA"} {
+		if _, err := db.DecodeMessageCursor(bad); !errors.Is(err, db.ErrInvalidCursor) {
+			t.Errorf("DecodeMessageCursor(%q) error = %v, want ErrInvalidCursor", bad, err)
+		}
+	}
+}
+
+func TestPagingMessagesWithSameTimestamp(t *testing.T) {
+	dbtest.Open(t)
+	alice := dbtest.User(t, "alice")
+	bob := dbtest.User(t, "bob")
+	conv := dbtest.Direct(t, alice, bob)
+
+	var sent []string
+	for _, content := range []string{"one", "two", "three", "four"} {
+		sent = append(sent, dbtest.Message(t, conv, alice, content).ID)
+	}
+	// Put every message in the same microsecond.
+	sameTime := time.Date(2026, 3, 2, 10, 0, 0, 123456000, time.UTC)
+	if _, err := db.DB.Exec(`UPDATE messages SET created_at = $1 WHERE conversation_id = $2`, sameTime, conv.ID); err != nil {
+		t.Fatalf("failed to set timestamps: %v", err)
+	}
+
+	// Walk back one message per page, newest first.
+	var seen []string
+	var before *db.MessageCursor
+	for range len(sent) + 1 {
+		page, err := db.GetConversationMessages(conv.ID, before, 1, 0, false)
+		if err != nil {
+			t.Fatalf("GetConversationMessages: %v", err)
+		}
+		if len(page) == 0 {
+			break
+		}
+		seen = append([]string{page[0].ID}, seen...)
+		cursor, err := db.DecodeMessageCursor(db.NewMessageCursor(&page[0]).Encode())
+		if err != nil {
+			t.Fatalf("DecodeMessageCursor: %v", err)
+		}
+		before = &cursor
+	}
+
+	if len(seen) != len(sent) {
+		t.Fatalf("paged through %d messages, want %d", len(seen), len(sent))
+	}
+	for i := range sent {
+		if seen[i] != sent[i] {
+			t.Errorf("page order = %v, want %v", seen, sent)
+			break
+		}
+	}
+}
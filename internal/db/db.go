@@ -2,8 +2,10 @@
 package db
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"time"
 
 	// The underscore import means: import for side effects only.
 	// The pq package registers itself as a PostgreSQL driver when imported.
@@ -15,6 +17,16 @@ import (
 // In a larger app, you might pass this around instead of using a global.
 var DB *sql.DB
 
+// QueryTimeout bounds every ...Context database call, so a hung query
+// gives its connection back to the pool instead of holding it forever.
+var QueryTimeout = 5 * time.Second
+
+// withTimeout returns ctx cut off after QueryTimeout.
+// A caller's own earlier deadline or cancellation still applies.
+func withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, QueryTimeout)
+}
+
 // Connect establishes a connection to the PostgreSQL database.
 // It takes the connection string and returns an error if connection fails.
 func Connect(connectionString string) error {
@@ -0,0 +1,109 @@
+// Package db - message delivery tracking
+package db
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/lib/pq"
+
+	"chatgo/internal/models"
+)
+
+// Delivery statuses recorded by the hub.
+const (
+	DeliveryDelivered = "delivered"
+	DeliveryOffline   = "offline"
+	DeliveryDropped   = "dropped"
+)
+
+// Delivery is the outcome of pushing one message to one recipient.
+type Delivery struct {
+	MessageID string
+	UserID    string
+	Status    string
+}
+
+// RecordDeliveries stores many delivery outcomes in one statement. If the
+// same message and recipient appear more than once, the last outcome wins.
+// Outcomes for messages or users deleted in the meantime are skipped.
+func RecordDeliveries(deliveries []Delivery) error {
+	// ON CONFLICT can't touch the same row twice in one statement.
+	latest := make(map[[2]string]int, len(deliveries))
+	var messageIDs, userIDs, statuses []string
+	for _, d := range deliveries {
+		key := [2]string{d.MessageID, d.UserID}
+		if i, seen := latest[key]; seen {
+			statuses[i] = d.Status
+			continue
+		}
+		latest[key] = len(statuses)
+		messageIDs = append(messageIDs, d.MessageID)
+		userIDs = append(userIDs, d.UserID)
+		statuses = append(statuses, d.Status)
+	}
+	if len(statuses) == 0 {
+		return nil
+	}
+
+	query := `INSERT INTO message_deliveries (message_id, user_id, status)
+	          SELECT d.message_id, d.user_id, d.status
+	          FROM unnest($1::uuid[], $2::uuid[], $3::text[]) AS d(message_id, user_id, status)
+	          WHERE EXISTS (SELECT 1 FROM messages WHERE id = d.message_id)
+	            AND EXISTS (SELECT 1 FROM users WHERE id = d.user_id)
+	          ON CONFLICT (message_id, user_id)
+	          DO UPDATE SET status = EXCLUDED.status, recorded_at = NOW()`
+
+	_, err := DB.Exec(query, pq.Array(messageIDs), pq.Array(userIDs), pq.Array(statuses))
+	if err != nil {
+		return fmt.Errorf("failed to record deliveries: %w", err)
+	}
+	return nil
+}
+
+// GetDeliveryTrace returns the recorded delivery state of a message for every
+// participant of its conversation. Participants with no record get an empty Status.
+// Returns nil if the message doesn't exist.
+func GetDeliveryTrace(messageID string) (*models.DeliveryTrace, error) {
+	trace := models.DeliveryTrace{MessageID: messageID}
+
+	var seq int64
+	err := DB.QueryRow(
+		`SELECT conversation_id, sender_id, seq FROM messages WHERE id = $1`,
+		messageID,
+	).Scan(&trace.ConversationID, &trace.SenderID, &seq)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get message: %w", err)
+	}
+
+	query := `
+		SELECT u.id, u.username, COALESCE(md.status, ''), md.recorded_at,
+			cr.user_id IS NOT NULL, cr.read_at
+		FROM conversation_participants cp
+		JOIN users u ON u.id = cp.user_id
+		LEFT JOIN message_deliveries md ON md.message_id = $1 AND md.user_id = cp.user_id
+		LEFT JOIN conversation_reads cr ON cr.conversation_id = cp.conversation_id
+			AND cr.user_id = cp.user_id AND cr.last_read_seq >= $3
+		WHERE cp.conversation_id = $2
+		ORDER BY u.username
+	`
+
+	rows, err := DB.Query(query, messageID, trace.ConversationID, seq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var d models.DeliveryStatus
+		if err := rows.Scan(&d.UserID, &d.Username, &d.Status, &d.RecordedAt, &d.Read, &d.ReadAt); err != nil {
+			return nil, fmt.Errorf("failed to scan delivery: %w", err)
+		}
+		trace.Recipients = append(trace.Recipients, d)
+	}
+
+	return &trace, nil
+}
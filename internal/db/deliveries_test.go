@@ -0,0 +1,77 @@
+package db_test
+
+import (
+	"testing"
+
+	"chatgo/internal/db"
+	"chatgo/internal/dbtest"
+)
+
+func TestDeliveryTraceReportsEachRecipient(t *testing.T) {
+	dbtest.Open(t)
+	alice := dbtest.User(t, "alice")
+	bob := dbtest.User(t, "bob")
+	carol := dbtest.User(t, "carol")
+	dave := dbtest.User(t, "dave")
+	group := dbtest.Group(t, "team", alice, bob, carol, dave)
+	msg := dbtest.Message(t, group, alice, "hello")
+
+	err := db.RecordDeliveries([]db.Delivery{
+		{MessageID: msg.ID, UserID: alice.ID, Status: db.DeliveryDelivered},
+		{MessageID: msg.ID, UserID: bob.ID, Status: db.DeliveryOffline},
+		{MessageID: msg.ID, UserID: carol.ID, Status: db.DeliveryDelivered},
+		// A later outcome in the same batch replaces the earlier one.
+		{MessageID: msg.ID, UserID: carol.ID, Status: db.DeliveryDropped},
+	})
+	if err != nil {
+		t.Fatalf("RecordDeliveries: %v", err)
+	}
+
+	trace, err := db.GetDeliveryTrace(msg.ID)
+	if err != nil || trace == nil {
+		t.Fatalf("GetDeliveryTrace = %v, %v", trace, err)
+	}
+	want := map[string]string{
+		"alice": db.DeliveryDelivered,
+		"bob":   db.DeliveryOffline,
+		"carol": db.DeliveryDropped,
+		"dave":  "", // Nothing recorded
+	}
+	if len(trace.Recipients) != len(want) {
+		t.Fatalf("got %d recipients, want %d", len(trace.Recipients), len(want))
+	}
+	for _, r := range trace.Recipients {
+		if r.Status != want[r.Username] {
+			t.Errorf("%s: status %q, want %q", r.Username, r.Status, want[r.Username])
+		}
+		if (r.Status != "") != (r.RecordedAt != nil) {
+			t.Errorf("%s: status %q but recorded_at %v", r.Username, r.Status, r.RecordedAt)
+		}
+	}
+}
+
+func TestRecordDeliveriesSkipsDeletedMessages(t *testing.T) {
+	dbtest.Open(t)
+	alice := dbtest.User(t, "alice")
+	bob := dbtest.User(t, "bob")
+	msg := dbtest.Message(t, dbtest.Direct(t, alice, bob), alice, "hi")
+
+	// One outcome is for a message that no longer exists; the rest still land.
+	err := db.RecordDeliveries([]db.Delivery{
+		{MessageID: "00000000-0000-0000-0000-00000000dead", UserID: bob.ID, Status: db.DeliveryDelivered},
+		{MessageID: msg.ID, UserID: bob.ID, Status: db.DeliveryDelivered},
+	})
+	if err != nil {
+		t.Fatalf("RecordDeliveries: %v", err)
+	}
+
+	trace, err := db.GetDeliveryTrace(msg.ID)
+	if err != nil {
+		t.Fatalf("GetDeliveryTrace: %v", err)
+	}
+	for _, r := range trace.Recipients {
+		if r.UserID == bob.ID && r.Status != db.DeliveryDelivered {
+			t.Errorf("bob: status %q, want delivered", r.Status)
+		}
+	}
+}
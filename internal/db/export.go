@@ -0,0 +1,76 @@
+// Package db - streaming queries for user data export
+package db
+
+import (
+	"fmt"
+
+	"chatgo/internal/models"
+)
+
+// ForEachUserConversation calls fn for every conversation the user is part of.
+// Rows are streamed one at a time, so memory use doesn't grow with the result.
+// If fn returns an error, iteration stops and that error is returned.
+func ForEachUserConversation(userID string, fn func(models.Conversation) error) error {
+	query := `
+		SELECT c.id, COALESCE(c.name, ''), c.created_at
+		FROM conversations c
+		JOIN conversation_participants cp ON c.id = cp.conversation_id
+		WHERE cp.user_id = $1
+		ORDER BY c.created_at ASC
+	`
+
+	rows, err := DB.Query(query, userID)
+	if err != nil {
+		return fmt.Errorf("failed to query conversations: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var conv models.Conversation
+		if err := rows.Scan(&conv.ID, &conv.Name, &conv.CreatedAt); err != nil {
+			return fmt.Errorf("failed to scan conversation: %w", err)
+		}
+		if err := fn(conv); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// ForEachUserMessage calls fn for every message the user has sent, oldest first.
+// Like ForEachUserConversation, rows are streamed rather than collected.
+func ForEachUserMessage(userID string, fn func(models.Message) error) error {
+	query := `
+		SELECT id, conversation_id, sender_id, content, seq, created_at
+		FROM messages
+		WHERE sender_id = $1 AND deleted_at IS NULL
+		ORDER BY created_at ASC
+	`
+
+	rows, err := DB.Query(query, userID)
+	if err != nil {
+		return fmt.Errorf("failed to query messages: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var msg models.Message
+		err := rows.Scan(
+			&msg.ID,
+			&msg.ConversationID,
+			&msg.SenderID,
+			&msg.Content,
+			&msg.Seq,
+			&msg.CreatedAt,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to scan message: %w", err)
+		}
+		if err := fn(msg); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
@@ -0,0 +1,81 @@
+// Package db - invite database operations
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"chatgo/internal/models"
+)
+
+// ErrInvalidInvite is returned when an invite doesn't exist, has expired or was already used.
+var ErrInvalidInvite = errors.New("invalid or already used invite")
+
+// CreateInvite stores a new invite token hash, valid for ttl.
+// Returns the invite's expiry time.
+func CreateInvite(tokenHash, createdBy string, ttl time.Duration) (time.Time, error) {
+	query := `INSERT INTO invites (token_hash, created_by, expires_at)
+	          VALUES ($1, $2, NOW() + $3::float8 * INTERVAL '1 second')
+	          RETURNING expires_at`
+
+	var expiresAt time.Time
+	err := DB.QueryRow(query, tokenHash, createdBy, ttl.Seconds()).Scan(&expiresAt)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to create invite: %w", err)
+	}
+	return expiresAt, nil
+}
+
+// RegisterWithInvite consumes an invite and creates a non-admin user in one transaction.
+// Returns ErrInvalidInvite if the invite can't be used.
+func RegisterWithInvite(tokenHash, username, passwordHash string) (*models.User, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Lock the invite row so two registrations can't consume it concurrently.
+	var inviteID string
+	err = tx.QueryRow(
+		`SELECT id FROM invites
+		 WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+		 FOR UPDATE`,
+		tokenHash,
+	).Scan(&inviteID)
+	if err == sql.ErrNoRows {
+		return nil, ErrInvalidInvite
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get invite: %w", err)
+	}
+
+	user, err := scanUser(tx.QueryRow(
+		`INSERT INTO users (username, display_name, password_hash, is_admin)
+		 VALUES ($1, $1, $2, FALSE)
+		 RETURNING `+userColumns,
+		username, passwordHash,
+	))
+	if isUniqueViolation(err) {
+		return nil, ErrUsernameTaken
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create user: %w", err)
+	}
+
+	_, err = tx.Exec(
+		`UPDATE invites SET used_by = $1, used_at = NOW() WHERE id = $2`,
+		user.ID, inviteID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to consume invite: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return user, nil
+}
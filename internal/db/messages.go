@@ -2,47 +2,306 @@
 package db
 
 import (
+	"context"
+	"database/sql"
+	"errors"
 	"fmt"
+	"slices"
+	"time"
+
+	"github.com/lib/pq"
 
 	"chatgo/internal/models"
 )
 
-// CreateMessage inserts a new message into the database.
-func CreateMessage(conversationID, senderID, content string) (*models.Message, error) {
-	query := `
-		INSERT INTO messages (conversation_id, sender_id, content)
-		VALUES ($1, $2, $3)
-		RETURNING id, conversation_id, sender_id, content, created_at
-	`
+// SystemUserID is the reserved user that sends automated messages.
+// It is created by migration 012 and cannot log in.
+const SystemUserID = "00000000-0000-0000-0000-000000000001"
+
+// ErrMessageNotFound is returned when a message ID given as a position
+// (e.g. the last message a client has seen) doesn't exist.
+var ErrMessageNotFound = errors.New("message not found")
 
+// messageColumns is the column list message queries select, in scanMessage order.
+// Queries alias messages as "m" and join the sender as "u".
+const messageColumns = `m.id, m.conversation_id, m.sender_id, u.username, u.display_name, u.avatar_url, m.content, m.seq,
+	m.is_system, m.expires_at, m.edited_at, m.reply_to_message_id, m.created_at`
+
+// scanMessage scans a row selected with messageColumns into a Message.
+func scanMessage(row rowScanner) (*models.Message, error) {
 	var msg models.Message
-	err := DB.QueryRow(query, conversationID, senderID, content).Scan(
+	err := row.Scan(
 		&msg.ID,
 		&msg.ConversationID,
 		&msg.SenderID,
+		&msg.SenderUsername,
+		&msg.SenderDisplayName,
+		&msg.SenderAvatarURL,
 		&msg.Content,
+		&msg.Seq,
+		&msg.IsSystem,
+		&msg.ExpiresAt,
+		&msg.EditedAt,
+		&msg.ReplyToID,
 		&msg.CreatedAt,
 	)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create message: %w", err)
+		return nil, err
 	}
 
+	// Report times in UTC whatever zone the driver handed them back in.
+	msg.CreatedAt = msg.CreatedAt.UTC()
+	msg.ExpiresAt = utcPtr(msg.ExpiresAt)
+	msg.EditedAt = utcPtr(msg.EditedAt)
 	return &msg, nil
 }
 
-// GetConversationMessages returns all messages in a conversation.
-// Includes the sender's username for display purposes.
-func GetConversationMessages(conversationID string, limit int) ([]models.Message, error) {
+// utcPtr returns t converted to UTC, or nil if t is nil.
+func utcPtr(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	u := t.UTC()
+	return &u
+}
+
+// CreateMessage inserts a new message into the database.
+// The message gets the next sequence number in its conversation, assigned in
+// the same transaction as the insert so concurrent sends never share a seq.
+// If expiresAt is set, the retention worker deletes the message at that time.
+// Attachment metadata is stored in the same transaction.
+// If replyToID is set, it must name a live message in the same conversation,
+// otherwise ErrInvalidReplyTo is returned.
+func CreateMessage(conversationID, senderID, content string, expiresAt *time.Time, attachments []models.Attachment, replyToID *string) (*models.Message, error) {
+	return CreateMessageContext(context.Background(), conversationID, senderID, content, expiresAt, attachments, replyToID)
+}
+
+// CreateMessageContext is like CreateMessage, but runs under ctx and is cut off after QueryTimeout.
+func CreateMessageContext(ctx context.Context, conversationID, senderID, content string, expiresAt *time.Time, attachments []models.Attachment, replyToID *string) (*models.Message, error) {
+	return createMessage(ctx, conversationID, senderID, content, expiresAt, attachments, replyToID, false)
+}
+
+// CreateSystemMessage stores an automated message from the system user.
+func CreateSystemMessage(conversationID, content string) (*models.Message, error) {
+	return createMessage(context.Background(), conversationID, SystemUserID, content, nil, nil, nil, true)
+}
+
+// createMessage implements CreateMessage and CreateSystemMessage.
+func createMessage(ctx context.Context, conversationID, senderID, content string, expiresAt *time.Time, attachments []models.Attachment, replyToID *string, isSystem bool) (*models.Message, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	tx, err := DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// A reply must point at a message that is still there, in this conversation.
+	if replyToID != nil {
+		var exists bool
+		err = tx.QueryRowContext(ctx,
+			`SELECT EXISTS(SELECT 1 FROM messages WHERE id = $1 AND conversation_id = $2 AND deleted_at IS NULL)`,
+			*replyToID, conversationID,
+		).Scan(&exists)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check reply target: %w", err)
+		}
+		if !exists {
+			return nil, ErrInvalidReplyTo
+		}
+	}
+
+	// Bumping last_seq row-locks the conversation until we commit,
+	// so other inserts into this conversation wait their turn. NOW() is the
+	// transaction's start time, so last_message_at matches the message's created_at.
+	var seq int64
+	err = tx.QueryRowContext(ctx,
+		`UPDATE conversations SET last_seq = last_seq + 1, last_message_at = NOW() WHERE id = $1 RETURNING last_seq`,
+		conversationID,
+	).Scan(&seq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to assign message seq: %w", err)
+	}
+
+	// The expiry is passed as seconds from now so it is computed by
+	// the database clock, like every other timestamp we store.
+	var expiresIn *float64
+	if expiresAt != nil {
+		seconds := time.Until(*expiresAt).Seconds()
+		expiresIn = &seconds
+	}
+
+	query := `
+		WITH m AS (
+			INSERT INTO messages (conversation_id, sender_id, content, seq, expires_at, is_system, reply_to_message_id)
+			VALUES ($1, $2, $3, $4, NOW() + $5::float8 * INTERVAL '1 second', $6, $7)
+			RETURNING *
+		)
+		SELECT ` + messageColumns + `
+		FROM m
+		JOIN users u ON m.sender_id = u.id
+	`
+
+	msg, err := scanMessage(tx.QueryRowContext(ctx, query, conversationID, senderID, content, seq, expiresIn, isSystem, replyToID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create message: %w", err)
+	}
+
+	for _, a := range attachments {
+		if err := addAttachment(ctx, tx, msg.ID, a); err != nil {
+			return nil, err
+		}
+	}
+	msg.Attachments = attachments
+
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	messages := []models.Message{*msg}
+	if err := loadReplyPreviews(ctx, messages); err != nil {
+		return nil, err
+	}
+
+	return &messages[0], nil
+}
+
+// GetConversationMessages returns one page of messages in a conversation,
+// oldest first, or newest first if newestFirst is set. Includes the sender's
+// username for display purposes. Either way, with before nil the page is the
+// newest limit messages; otherwise the limit messages just before the cursor.
+// offset skips that many of the newest matching messages first.
+func GetConversationMessages(conversationID string, before *MessageCursor, limit, offset int, newestFirst bool) ([]models.Message, error) {
+	return GetConversationMessagesContext(context.Background(), conversationID, before, limit, offset, newestFirst)
+}
+
+// GetConversationMessagesContext is like GetConversationMessages, but runs under ctx and is cut off after QueryTimeout.
+func GetConversationMessagesContext(ctx context.Context, conversationID string, before *MessageCursor, limit, offset int, newestFirst bool) ([]models.Message, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	// Take the newest page below the cursor, then flip it to oldest-first
+	// below unless the caller wants it newest first.
 	query := `
-		SELECT m.id, m.conversation_id, m.sender_id, u.username, m.content, m.created_at
+		SELECT ` + messageColumns + `
 		FROM messages m
 		JOIN users u ON m.sender_id = u.id
-		WHERE m.conversation_id = $1
-		ORDER BY m.created_at ASC
-		LIMIT $2
+		WHERE m.conversation_id = $1 AND m.deleted_at IS NULL
+		AND ($2::bigint IS NULL OR m.seq < $2)
+		ORDER BY m.seq DESC
+		LIMIT $3 OFFSET $4
 	`
 
-	rows, err := DB.Query(query, conversationID, limit)
+	var beforeSeq sql.NullInt64
+	if before != nil {
+		beforeSeq = sql.NullInt64{Int64: before.Seq, Valid: true}
+	}
+	messages, err := queryMessages(ctx, query, conversationID, beforeSeq, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	if !newestFirst {
+		slices.Reverse(messages)
+	}
+
+	return messages, nil
+}
+
+// CountConversationMessages returns how many messages GetConversationMessages
+// can page through in a conversation; deleted messages don't count.
+func CountConversationMessages(conversationID string) (int, error) {
+	var count int
+	err := DB.QueryRow(
+		`SELECT COUNT(*) FROM messages WHERE conversation_id = $1 AND deleted_at IS NULL`,
+		conversationID,
+	).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count messages: %w", err)
+	}
+	return count, nil
+}
+
+// GetMessagesSince returns up to limit messages, across all of userID's
+// conversations, that are newer than the message lastSeenID, oldest first.
+// In the conversation of lastSeenID "newer" means a higher seq; elsewhere it
+// means created at or after it. Messages from users userID has blocked are
+// left out, as they are from live delivery. Returns ErrMessageNotFound if
+// lastSeenID doesn't exist.
+func GetMessagesSince(userID, lastSeenID string, limit int) ([]models.Message, error) {
+	ctx, cancel := withTimeout(context.Background())
+	defer cancel()
+
+	var seenConversationID string
+	var seenSeq int64
+	var seenAt time.Time
+	err := DB.QueryRowContext(ctx,
+		`SELECT conversation_id, seq, created_at FROM messages WHERE id = $1`,
+		lastSeenID,
+	).Scan(&seenConversationID, &seenSeq, &seenAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrMessageNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get last seen message: %w", err)
+	}
+
+	query := `
+		SELECT ` + messageColumns + `
+		FROM messages m
+		JOIN users u ON m.sender_id = u.id
+		JOIN conversation_participants cp
+			ON cp.conversation_id = m.conversation_id AND cp.user_id = $1
+		WHERE m.deleted_at IS NULL
+		AND CASE WHEN m.conversation_id = $2 THEN m.seq > $3 ELSE m.created_at >= $4 END
+		AND NOT EXISTS (SELECT 1 FROM blocks b WHERE b.blocker_id = $1 AND b.blocked_id = m.sender_id)
+		ORDER BY m.created_at, m.seq
+		LIMIT $5
+	`
+
+	return queryMessages(ctx, query, userID, seenConversationID, seenSeq, seenAt, limit)
+}
+
+// GetMessagesAfterSeqs returns up to limit messages that are newer than the
+// client's last seen seq in each conversation of lastSeen (conversation ID
+// to seq), oldest first within a conversation. Conversations userID isn't in
+// are ignored, and so are userID's conversations missing from lastSeen.
+// Messages from users userID has blocked are left out.
+func GetMessagesAfterSeqs(userID string, lastSeen map[string]int64, limit int) ([]models.Message, error) {
+	ctx, cancel := withTimeout(context.Background())
+	defer cancel()
+
+	conversationIDs := make([]string, 0, len(lastSeen))
+	seqs := make([]int64, 0, len(lastSeen))
+	for id, seq := range lastSeen {
+		conversationIDs = append(conversationIDs, id)
+		seqs = append(seqs, seq)
+	}
+
+	query := `
+		WITH seen (conversation_id, seq) AS (
+			SELECT * FROM unnest($2::uuid[], $3::bigint[])
+		)
+		SELECT ` + messageColumns + `
+		FROM messages m
+		JOIN seen s ON s.conversation_id = m.conversation_id
+		JOIN users u ON m.sender_id = u.id
+		JOIN conversation_participants cp
+			ON cp.conversation_id = m.conversation_id AND cp.user_id = $1
+		WHERE m.deleted_at IS NULL AND m.seq > s.seq
+		AND NOT EXISTS (SELECT 1 FROM blocks b WHERE b.blocker_id = $1 AND b.blocked_id = m.sender_id)
+		ORDER BY m.conversation_id, m.seq
+		LIMIT $4
+	`
+
+	return queryMessages(ctx, query, userID, pq.Array(conversationIDs), pq.Array(seqs), limit)
+}
+
+// queryMessages runs a query selecting messageColumns and returns the
+// messages with their attachments and reply previews filled in.
+func queryMessages(ctx context.Context, query string, args ...interface{}) ([]models.Message, error) {
+	rows, err := DB.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query messages: %w", err)
 	}
@@ -50,20 +309,133 @@ func GetConversationMessages(conversationID string, limit int) ([]models.Message
 
 	var messages []models.Message
 	for rows.Next() {
-		var msg models.Message
-		err := rows.Scan(
-			&msg.ID,
-			&msg.ConversationID,
-			&msg.SenderID,
-			&msg.SenderUsername,
-			&msg.Content,
-			&msg.CreatedAt,
-		)
+		msg, err := scanMessage(rows)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan message: %w", err)
 		}
-		messages = append(messages, msg)
+		messages = append(messages, *msg)
+	}
+
+	if err := loadAttachments(ctx, messages); err != nil {
+		return nil, err
+	}
+	if err := loadReplyPreviews(ctx, messages); err != nil {
+		return nil, err
 	}
 
 	return messages, nil
 }
+
+// UpdateMessage replaces the content of a message and sets its edited_at.
+// Only the sender can edit, and only while still a participant of the
+// conversation; deleted and system messages can't be edited.
+// Returns nil if there's no such message that senderID may edit.
+func UpdateMessage(messageID, senderID, newContent string) (*models.Message, error) {
+	query := `
+		WITH m AS (
+			UPDATE messages SET content = $3, edited_at = NOW()
+			WHERE id = $1 AND sender_id = $2
+			AND deleted_at IS NULL AND NOT is_system
+			AND EXISTS (
+				SELECT 1 FROM conversation_participants cp
+				WHERE cp.conversation_id = messages.conversation_id AND cp.user_id = $2
+			)
+			RETURNING *
+		)
+		SELECT ` + messageColumns + `
+		FROM m
+		JOIN users u ON m.sender_id = u.id
+	`
+
+	msg, err := scanMessage(DB.QueryRow(query, messageID, senderID, newContent))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to update message: %w", err)
+	}
+
+	return msg, nil
+}
+
+// GetMessageByID returns a single message with its sender's details.
+// Returns nil if the message doesn't exist or has been deleted.
+func GetMessageByID(id string) (*models.Message, error) {
+	return GetMessageByIDContext(context.Background(), id)
+}
+
+// GetMessageByIDContext is GetMessageByID with a caller-supplied context.
+func GetMessageByIDContext(ctx context.Context, id string) (*models.Message, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		SELECT ` + messageColumns + `
+		FROM messages m
+		JOIN users u ON m.sender_id = u.id
+		WHERE m.id = $1 AND m.deleted_at IS NULL
+	`
+
+	messages, err := queryMessages(ctx, query, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(messages) == 0 {
+		return nil, nil
+	}
+
+	return &messages[0], nil
+}
+
+// GetMessagesByIDs returns the messages with the given IDs, skipping any that
+// belong to conversations the requesting user is not a participant in.
+// IDs that don't exist are silently left out of the result.
+func GetMessagesByIDs(ids []string, requestingUserID string) ([]models.Message, error) {
+	return GetMessagesByIDsContext(context.Background(), ids, requestingUserID)
+}
+
+// GetMessagesByIDsContext is like GetMessagesByIDs, but runs under ctx and is cut off after QueryTimeout.
+func GetMessagesByIDsContext(ctx context.Context, ids []string, requestingUserID string) ([]models.Message, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		SELECT ` + messageColumns + `
+		FROM messages m
+		JOIN users u ON m.sender_id = u.id
+		JOIN conversation_participants cp
+			ON cp.conversation_id = m.conversation_id AND cp.user_id = $2
+		WHERE m.id = ANY($1::uuid[]) AND m.deleted_at IS NULL
+		ORDER BY m.conversation_id, m.seq ASC
+	`
+
+	return queryMessages(ctx, query, pq.Array(ids), requestingUserID)
+}
+
+// DeleteExpiredMessages soft-deletes every message whose expiry has passed.
+// The content is cleared so expired messages really are gone.
+// Returns the deleted messages (ID and conversation ID only) so clients can be told.
+func DeleteExpiredMessages() ([]models.Message, error) {
+	query := `
+		UPDATE messages SET deleted_at = NOW(), content = ''
+		WHERE expires_at <= NOW() AND deleted_at IS NULL
+		RETURNING id, conversation_id
+	`
+
+	rows, err := DB.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete expired messages: %w", err)
+	}
+	defer rows.Close()
+
+	var deleted []models.Message
+	for rows.Next() {
+		var msg models.Message
+		if err := rows.Scan(&msg.ID, &msg.ConversationID); err != nil {
+			return nil, fmt.Errorf("failed to scan message: %w", err)
+		}
+		deleted = append(deleted, msg)
+	}
+
+	return deleted, nil
+}
@@ -0,0 +1,187 @@
+package db_test
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"chatgo/internal/db"
+	"chatgo/internal/dbtest"
+	"chatgo/internal/models"
+)
+
+func TestGetMessagesByIDsOnlyReturnsVisibleMessages(t *testing.T) {
+	dbtest.Open(t)
+	alice := dbtest.User(t, "alice")
+	bob := dbtest.User(t, "bob")
+	carol := dbtest.User(t, "carol")
+	ours := dbtest.Direct(t, alice, bob)
+	theirs := dbtest.Direct(t, bob, carol)
+
+	first := dbtest.Message(t, ours, alice, "first")
+	second := dbtest.Message(t, ours, bob, "second")
+	private := dbtest.Message(t, theirs, carol, "not for alice")
+	missing := "00000000-0000-0000-0000-00000000abcd"
+
+	messages, err := db.GetMessagesByIDs([]string{second.ID, private.ID, first.ID, missing}, alice.ID)
+	if err != nil {
+		t.Fatalf("GetMessagesByIDs: %v", err)
+	}
+	if len(messages) != 2 {
+		t.Fatalf("got %d messages, want 2: %+v", len(messages), messages)
+	}
+	if messages[0].ID != first.ID || messages[1].ID != second.ID {
+		t.Errorf("got %s, %s; want %s, %s in seq order", messages[0].ID, messages[1].ID, first.ID, second.ID)
+	}
+
+	// Bob is in both conversations, so he sees all three.
+	messages, err = db.GetMessagesByIDs([]string{first.ID, second.ID, private.ID}, bob.ID)
+	if err != nil {
+		t.Fatalf("GetMessagesByIDs: %v", err)
+	}
+	if len(messages) != 3 {
+		t.Errorf("bob got %d messages, want 3", len(messages))
+	}
+}
+
+func TestDeleteExpiredMessagesOnlyDeletesExpired(t *testing.T) {
+	dbtest.Open(t)
+	alice := dbtest.User(t, "alice")
+	bob := dbtest.User(t, "bob")
+	conv := dbtest.Direct(t, alice, bob)
+
+	expiresAt := time.Now().Add(time.Hour)
+	ephemeral, err := db.CreateMessage(conv.ID, alice.ID, "gone soon", &expiresAt, nil, nil)
+	if err != nil {
+		t.Fatalf("CreateMessage: %v", err)
+	}
+	kept := dbtest.Message(t, conv, bob, "here to stay")
+
+	if deleted, err := db.DeleteExpiredMessages(); err != nil || len(deleted) != 0 {
+		t.Fatalf("before expiry: deleted %v (err %v), want nothing", deleted, err)
+	}
+
+	// Let the hour pass.
+	if _, err := db.DB.Exec(`UPDATE messages SET expires_at = NOW() - INTERVAL '1 second' WHERE id = $1`, ephemeral.ID); err != nil {
+		t.Fatalf("failed to age message: %v", err)
+	}
+	deleted, err := db.DeleteExpiredMessages()
+	if err != nil {
+		t.Fatalf("DeleteExpiredMessages: %v", err)
+	}
+	if len(deleted) != 1 || deleted[0].ID != ephemeral.ID || deleted[0].ConversationID != conv.ID {
+		t.Fatalf("deleted %+v, want just the expired message", deleted)
+	}
+
+	messages, err := db.GetConversationMessages(conv.ID, nil, 50, 0, false)
+	if err != nil {
+		t.Fatalf("GetConversationMessages: %v", err)
+	}
+	if len(messages) != 1 || messages[0].ID != kept.ID {
+		t.Errorf("conversation has %+v, want only the unexpired message", messages)
+	}
+
+	// A second pass finds nothing new.
+	if deleted, _ := db.DeleteExpiredMessages(); len(deleted) != 0 {
+		t.Errorf("second pass deleted %v again", deleted)
+	}
+}
+
+func TestCreateSystemMessage(t *testing.T) {
+	dbtest.Open(t)
+	alice := dbtest.User(t, "alice")
+	bob := dbtest.User(t, "bob")
+	carol := dbtest.User(t, "carol")
+	group := dbtest.Group(t, "team", alice, bob, carol)
+	dbtest.Message(t, group, alice, "hi")
+
+	msg, err := db.CreateSystemMessage(group.ID, "carol joined")
+	if err != nil {
+		t.Fatalf("CreateSystemMessage: %v", err)
+	}
+	if !msg.IsSystem || msg.SenderID != db.SystemUserID || msg.Seq != 2 {
+		t.Errorf("created %+v, want a system message with seq 2", msg)
+	}
+
+	stored, err := db.GetMessageByID(msg.ID)
+	if err != nil || stored == nil {
+		t.Fatalf("GetMessageByID: %v, %v", stored, err)
+	}
+	if !stored.IsSystem || stored.SenderID != db.SystemUserID || stored.Content != "carol joined" {
+		t.Errorf("stored %+v, want the system message", stored)
+	}
+
+	// Ordinary messages aren't flagged.
+	if plain, _ := db.GetMessageByID(dbtest.Message(t, group, bob, "welcome").ID); plain.IsSystem {
+		t.Error("a user's message is flagged as a system message")
+	}
+}
+
+func TestMessagesAreReportedInUTC(t *testing.T) {
+	fake := dbtest.UseFake(t)
+	// As a driver on a server in India would hand the row back.
+	ist := time.FixedZone("IST", 5*60*60+30*60)
+	sentAt := time.Date(2026, 3, 2, 15, 30, 0, 0, ist)
+	editedAt := sentAt.Add(time.Minute)
+	fake.OnRows("WHERE m.id = $1",
+		[]string{"id", "conversation_id", "sender_id", "username", "display_name", "avatar_url",
+			"content", "seq", "is_system", "expires_at", "edited_at", "reply_to_message_id", "created_at"},
+		[]driver.Value{"msg-1", "conv-1", "alice", "alice", "Alice", "", "hi", int64(1), false, nil, editedAt, nil, sentAt})
+
+	msg, err := db.GetMessageByID("msg-1")
+	if err != nil || msg == nil {
+		t.Fatalf("GetMessageByID: %v, %v", msg, err)
+	}
+	if msg.CreatedAt.Location() != time.UTC || !msg.CreatedAt.Equal(sentAt) {
+		t.Errorf("created_at = %v, want %v in UTC", msg.CreatedAt, sentAt)
+	}
+	if msg.EditedAt == nil || msg.EditedAt.Location() != time.UTC {
+		t.Errorf("edited_at = %v, want UTC", msg.EditedAt)
+	}
+
+	data, err := json.Marshal(msg)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if !strings.Contains(string(data), `"created_at":"2026-03-02T10:00:00Z"`) {
+		t.Errorf("JSON %s doesn't have created_at in UTC", data)
+	}
+}
+
+func TestEveryMessageReadLoadsAttachments(t *testing.T) {
+	fake := dbtest.UseFake(t)
+	fake.OnRows("FROM attachments",
+		[]string{"message_id", "url", "filename", "mime_type", "size", "width", "height", "thumbnail_url"},
+		[]driver.Value{"msg-1", "/uploads/cat.png", "cat.png", "image/png", int64(2048), int64(64), int64(48), ""})
+	fake.OnRows("FROM messages m",
+		[]string{"id", "conversation_id", "sender_id", "username", "display_name", "avatar_url",
+			"content", "seq", "is_system", "expires_at", "edited_at", "reply_to_message_id", "created_at"},
+		[]driver.Value{"msg-1", "conv-1", "alice", "alice", "Alice", "", "look", int64(1), false, nil, nil, nil, time.Now()})
+
+	reads := map[string]func() ([]models.Message, error){
+		"GetConversationMessages": func() ([]models.Message, error) {
+			return db.GetConversationMessages("conv-1", nil, 10, 0, false)
+		},
+		"GetMessagesByIDs": func() ([]models.Message, error) {
+			return db.GetMessagesByIDs([]string{"msg-1"}, "alice")
+		},
+		"GetMessageByID": func() ([]models.Message, error) {
+			msg, err := db.GetMessageByID("msg-1")
+			if msg == nil {
+				return nil, err
+			}
+			return []models.Message{*msg}, err
+		},
+	}
+	for name, read := range reads {
+		messages, err := read()
+		if err != nil || len(messages) != 1 {
+			t.Fatalf("%s: %v, %v", name, messages, err)
+		}
+		if a := messages[0].Attachments; len(a) != 1 || a[0].Filename != "cat.png" {
+			t.Errorf("%s: attachments = %+v, want cat.png", name, a)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+// Package db - notification database operations
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"chatgo/internal/models"
+)
+
+// CreateNotification stores a notification for a user.
+// payload is encoded as JSON; pass nil for an empty payload.
+func CreateNotification(userID, notificationType string, payload interface{}) (*models.Notification, error) {
+	if payload == nil {
+		payload = struct{}{}
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode notification payload: %w", err)
+	}
+
+	query := `INSERT INTO notifications (user_id, type, payload)
+	          VALUES ($1, $2, $3)
+	          RETURNING id, type, payload, created_at, acked_at`
+
+	var n models.Notification
+	var raw []byte
+	err = DB.QueryRow(query, userID, notificationType, data).Scan(&n.ID, &n.Type, &raw, &n.CreatedAt, &n.AckedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create notification: %w", err)
+	}
+	n.Payload = raw
+
+	return &n, nil
+}
+
+// GetUserNotifications returns a user's notifications, newest first.
+// Acknowledged notifications are only included if includeAcked is true.
+func GetUserNotifications(userID string, includeAcked bool) ([]models.Notification, error) {
+	query := `SELECT id, type, payload, created_at, acked_at
+	          FROM notifications
+	          WHERE user_id = $1 AND ($2 OR acked_at IS NULL)
+	          ORDER BY created_at DESC
+	          LIMIT 200`
+
+	rows, err := DB.Query(query, userID, includeAcked)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query notifications: %w", err)
+	}
+	defer rows.Close()
+
+	var notifications []models.Notification
+	for rows.Next() {
+		var n models.Notification
+		var raw []byte
+		if err := rows.Scan(&n.ID, &n.Type, &raw, &n.CreatedAt, &n.AckedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan notification: %w", err)
+		}
+		n.Payload = raw
+		notifications = append(notifications, n)
+	}
+
+	return notifications, nil
+}
+
+// AckNotification marks one of the user's notifications as acknowledged.
+// Returns false if the notification doesn't exist or belongs to someone else.
+// Acking an already-acked notification succeeds.
+func AckNotification(id, userID string) (bool, error) {
+	query := `UPDATE notifications SET acked_at = COALESCE(acked_at, NOW())
+	          WHERE id = $1 AND user_id = $2`
+
+	result, err := DB.Exec(query, id, userID)
+	if err != nil {
+		return false, fmt.Errorf("failed to ack notification: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	return rowsAffected > 0, nil
+}
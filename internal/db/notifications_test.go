@@ -0,0 +1,53 @@
+package db_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"chatgo/internal/db"
+	"chatgo/internal/dbtest"
+	"chatgo/internal/models"
+)
+
+func TestNotificationLifecycle(t *testing.T) {
+	dbtest.Open(t)
+	alice := dbtest.User(t, "alice")
+	bob := dbtest.User(t, "bob")
+
+	n, err := db.CreateNotification(alice.ID, models.NotificationAddedToConversation,
+		map[string]string{"conversation_id": "c1"})
+	if err != nil {
+		t.Fatalf("CreateNotification: %v", err)
+	}
+	var payload map[string]string
+	if err := json.Unmarshal(n.Payload, &payload); err != nil || payload["conversation_id"] != "c1" {
+		t.Errorf("payload = %s, want conversation_id c1", n.Payload)
+	}
+
+	list, err := db.GetUserNotifications(alice.ID, false)
+	if err != nil || len(list) != 1 || list[0].ID != n.ID {
+		t.Fatalf("GetUserNotifications = %v, %v; want just the new one", list, err)
+	}
+	if other, _ := db.GetUserNotifications(bob.ID, true); len(other) != 0 {
+		t.Errorf("bob sees %d of alice's notifications", len(other))
+	}
+
+	// Only the owner can ack it.
+	if acked, err := db.AckNotification(n.ID, bob.ID); err != nil || acked {
+		t.Errorf("bob acking alice's notification = %v, %v; want false", acked, err)
+	}
+	if acked, err := db.AckNotification(n.ID, alice.ID); err != nil || !acked {
+		t.Fatalf("AckNotification = %v, %v; want true", acked, err)
+	}
+	if acked, _ := db.AckNotification(n.ID, alice.ID); !acked {
+		t.Error("acking twice should still succeed")
+	}
+
+	if list, _ := db.GetUserNotifications(alice.ID, false); len(list) != 0 {
+		t.Errorf("acked notification still listed: %v", list)
+	}
+	list, err = db.GetUserNotifications(alice.ID, true)
+	if err != nil || len(list) != 1 || list[0].AckedAt == nil {
+		t.Errorf("with includeAcked got %v, %v; want it, acked", list, err)
+	}
+}
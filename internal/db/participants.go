@@ -0,0 +1,201 @@
+// Package db - adding and removing conversation participants
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"chatgo/internal/models"
+)
+
+// Errors returned when a participant change isn't allowed.
+var (
+	// ErrNotGroup: only group conversations can gain or lose members.
+	ErrNotGroup = errors.New("conversation is not a group")
+
+	// ErrGroupFull: the group already has MaxGroupSize participants.
+	ErrGroupFull = errors.New("group is full")
+
+	// ErrGroupTooSmall: the removal would leave the group with fewer than
+	// two members. Delete the conversation instead.
+	ErrGroupTooSmall = errors.New("group would have fewer than 2 participants")
+)
+
+// lockGroup locks a conversation row for the rest of tx, so concurrent
+// membership changes to the same group happen one at a time, and returns
+// its participant count. Returns ErrNotGroup for 1:1 conversations.
+func lockGroup(tx *sql.Tx, conversationID string) (int, error) {
+	var isGroup bool
+	err := tx.QueryRow(
+		`SELECT is_group FROM conversations WHERE id = $1 FOR UPDATE`,
+		conversationID,
+	).Scan(&isGroup)
+	if err == sql.ErrNoRows {
+		return 0, ErrNotGroup
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to lock conversation: %w", err)
+	}
+	if !isGroup {
+		return 0, ErrNotGroup
+	}
+
+	var count int
+	err = tx.QueryRow(
+		`SELECT COUNT(*) FROM conversation_participants WHERE conversation_id = $1`,
+		conversationID,
+	).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count participants: %w", err)
+	}
+
+	return count, nil
+}
+
+// AddParticipant adds a user to a group conversation as a member.
+// Returns false if the user was already a participant.
+func AddParticipant(conversationID, userID string) (bool, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	count, err := lockGroup(tx, conversationID)
+	if err != nil {
+		return false, err
+	}
+	if count >= MaxGroupSize {
+		return false, ErrGroupFull
+	}
+
+	result, err := tx.Exec(
+		`INSERT INTO conversation_participants (conversation_id, user_id) VALUES ($1, $2)
+		 ON CONFLICT DO NOTHING`,
+		conversationID, userID,
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to add participant: %w", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return rowsAffected > 0, nil
+}
+
+// RemoveParticipant removes a user from a group conversation.
+// Returns false if the user wasn't a participant, and ErrGroupTooSmall if
+// removing them would leave fewer than two members.
+func RemoveParticipant(conversationID, userID string) (bool, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	count, err := lockGroup(tx, conversationID)
+	if err != nil {
+		return false, err
+	}
+
+	_, removed, err := removeParticipant(tx, conversationID, userID)
+	if err != nil || !removed {
+		return false, err
+	}
+	if count-1 < 2 {
+		return false, ErrGroupTooSmall
+	}
+
+	if err = tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return true, nil
+}
+
+// LeaveConversation removes userID from a conversation at their own request.
+// Works for 1:1 and group conversations. Unlike RemoveParticipant there's no
+// minimum size: a conversation is kept while anyone is still in it, and
+// deleted (with its messages) when the last participant leaves. If the
+// group's owner leaves, the longest-standing remaining member becomes owner.
+// Returns left=false if the user wasn't a participant, and deleted=true if
+// the conversation was garbage-collected.
+func LeaveConversation(conversationID, userID string) (left, deleted bool, err error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return false, false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Lock the conversation so two last members leaving at once can't both
+	// see someone else still there.
+	_, err = tx.Exec(`SELECT 1 FROM conversations WHERE id = $1 FOR UPDATE`, conversationID)
+	if err != nil {
+		return false, false, fmt.Errorf("failed to lock conversation: %w", err)
+	}
+
+	role, removed, err := removeParticipant(tx, conversationID, userID)
+	if err != nil || !removed {
+		return false, false, err
+	}
+
+	var remaining int
+	err = tx.QueryRow(
+		`SELECT COUNT(*) FROM conversation_participants WHERE conversation_id = $1`,
+		conversationID,
+	).Scan(&remaining)
+	if err != nil {
+		return false, false, fmt.Errorf("failed to count participants: %w", err)
+	}
+
+	if remaining == 0 {
+		if _, err = tx.Exec(`DELETE FROM conversations WHERE id = $1`, conversationID); err != nil {
+			return false, false, fmt.Errorf("failed to delete conversation: %w", err)
+		}
+		deleted = true
+	} else if role == models.RoleOwner {
+		_, err = tx.Exec(
+			`UPDATE conversation_participants SET role = $1
+			 WHERE conversation_id = $2 AND user_id = (
+				SELECT user_id FROM conversation_participants
+				WHERE conversation_id = $2
+				ORDER BY joined_at, user_id
+				LIMIT 1
+			 )`,
+			models.RoleOwner, conversationID,
+		)
+		if err != nil {
+			return false, false, fmt.Errorf("failed to transfer ownership: %w", err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return false, false, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return true, deleted, nil
+}
+
+// removeParticipant deletes one participant row inside tx and returns the
+// role they had. removed is false if they weren't a participant.
+func removeParticipant(tx *sql.Tx, conversationID, userID string) (role string, removed bool, err error) {
+	err = tx.QueryRow(
+		`DELETE FROM conversation_participants WHERE conversation_id = $1 AND user_id = $2
+		 RETURNING role`,
+		conversationID, userID,
+	).Scan(&role)
+	if err == sql.ErrNoRows {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("failed to remove participant: %w", err)
+	}
+	return role, true, nil
+}
@@ -0,0 +1,64 @@
+package db_test
+
+import (
+	"slices"
+	"testing"
+
+	"chatgo/internal/db"
+	"chatgo/internal/dbtest"
+)
+
+func TestRemoveParticipantBelowMinimumIsRejected(t *testing.T) {
+	dbtest.Open(t)
+	alice := dbtest.User(t, "alice")
+	bob := dbtest.User(t, "bob")
+	carol := dbtest.User(t, "carol")
+	group := dbtest.Group(t, "team", alice, bob, carol)
+
+	if removed, err := db.RemoveParticipant(group.ID, carol.ID); err != nil || !removed {
+		t.Fatalf("removing carol = %v, %v; want removed", removed, err)
+	}
+
+	// Down to two: removing the second-to-last member would orphan the group.
+	removed, err := db.RemoveParticipant(group.ID, bob.ID)
+	if err != db.ErrGroupTooSmall || removed {
+		t.Fatalf("removing bob = %v, %v; want ErrGroupTooSmall", removed, err)
+	}
+	if in, _ := db.IsUserInConversation(bob.ID, group.ID); !in {
+		t.Error("rejected removal still took bob out of the group")
+	}
+}
+
+func TestDeleteConversationIsTheWayToEndAGroup(t *testing.T) {
+	dbtest.Open(t)
+	alice := dbtest.User(t, "alice")
+	bob := dbtest.User(t, "bob")
+	carol := dbtest.User(t, "carol")
+	group := dbtest.Group(t, "team", alice, bob, carol)
+	dbtest.Message(t, group, alice, "bye")
+
+	if _, err := db.RemoveParticipant(group.ID, carol.ID); err != nil {
+		t.Fatalf("RemoveParticipant: %v", err)
+	}
+	if _, err := db.RemoveParticipant(group.ID, bob.ID); err != db.ErrGroupTooSmall {
+		t.Fatalf("err = %v, want ErrGroupTooSmall", err)
+	}
+
+	participantIDs, deleted, err := db.DeleteConversation(group.ID)
+	if err != nil || !deleted {
+		t.Fatalf("DeleteConversation = %v, %v; want deleted", deleted, err)
+	}
+	slices.Sort(participantIDs)
+	want := []string{alice.ID, bob.ID}
+	slices.Sort(want)
+	if !slices.Equal(participantIDs, want) {
+		t.Errorf("participants = %v, want %v", participantIDs, want)
+	}
+
+	if exists, _ := db.ConversationExists(group.ID); exists {
+		t.Error("conversation still exists after delete")
+	}
+	if _, deleted, _ := db.DeleteConversation(group.ID); deleted {
+		t.Error("deleting twice reported deleted again")
+	}
+}
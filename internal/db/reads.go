@@ -0,0 +1,203 @@
+// Package db - read receipt database operations
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/lib/pq"
+
+	"chatgo/internal/models"
+)
+
+// MarkConversationRead records that userID has read conversationID up to and
+// including message upToMessageID. The marker only ever moves forward.
+// Returns nil if nothing changed: the message isn't in the conversation, or
+// the user had already read that far.
+func MarkConversationRead(userID, conversationID, upToMessageID string) (*models.ReadState, error) {
+	query := `
+		INSERT INTO conversation_reads (user_id, conversation_id, last_read_message_id, last_read_seq)
+		SELECT $1, m.conversation_id, m.id, m.seq
+		FROM messages m
+		WHERE m.id = $3 AND m.conversation_id = $2
+		ON CONFLICT (user_id, conversation_id) DO UPDATE
+		SET last_read_message_id = EXCLUDED.last_read_message_id,
+		    last_read_seq = EXCLUDED.last_read_seq,
+		    read_at = NOW()
+		WHERE conversation_reads.last_read_seq < EXCLUDED.last_read_seq
+		RETURNING user_id, conversation_id, last_read_message_id, last_read_seq, read_at
+	`
+
+	state, err := scanReadState(DB.QueryRow(query, userID, conversationID, upToMessageID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to mark conversation read: %w", err)
+	}
+
+	return state, nil
+}
+
+// MarkAllConversationsRead moves userID's read marker in every conversation
+// they're in up to its latest message, in a single statement.
+// Returns the markers that moved; conversations already read to the
+// end, or without messages, are left out.
+func MarkAllConversationsRead(userID string) ([]models.ReadState, error) {
+	query := `
+		INSERT INTO conversation_reads (user_id, conversation_id, last_read_message_id, last_read_seq)
+		SELECT $1, lm.conversation_id, lm.id, lm.seq
+		FROM conversation_participants cp
+		JOIN LATERAL (
+			SELECT m.id, m.conversation_id, m.seq
+			FROM messages m
+			WHERE m.conversation_id = cp.conversation_id AND m.deleted_at IS NULL
+			ORDER BY m.seq DESC
+			LIMIT 1
+		) lm ON TRUE
+		WHERE cp.user_id = $1
+		ON CONFLICT (user_id, conversation_id) DO UPDATE
+		SET last_read_message_id = EXCLUDED.last_read_message_id,
+		    last_read_seq = EXCLUDED.last_read_seq,
+		    read_at = NOW()
+		WHERE conversation_reads.last_read_seq < EXCLUDED.last_read_seq
+		RETURNING user_id, conversation_id, last_read_message_id, last_read_seq, read_at
+	`
+
+	rows, err := DB.Query(query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to mark conversations read: %w", err)
+	}
+	defer rows.Close()
+
+	var states []models.ReadState
+	for rows.Next() {
+		state, err := scanReadState(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan read state: %w", err)
+		}
+		states = append(states, *state)
+	}
+
+	return states, nil
+}
+
+// GetLastRead returns how far userID has read in conversationID.
+// Returns nil if they haven't read anything yet.
+func GetLastRead(userID, conversationID string) (*models.ReadState, error) {
+	return GetLastReadContext(context.Background(), userID, conversationID)
+}
+
+// GetLastReadContext is like GetLastRead, but runs under ctx and is cut off after QueryTimeout.
+func GetLastReadContext(ctx context.Context, userID, conversationID string) (*models.ReadState, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		SELECT user_id, conversation_id, last_read_message_id, last_read_seq, read_at
+		FROM conversation_reads
+		WHERE user_id = $1 AND conversation_id = $2
+	`
+
+	state, err := scanReadState(DB.QueryRowContext(ctx, query, userID, conversationID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get last read: %w", err)
+	}
+
+	return state, nil
+}
+
+// getLastReads returns userID's read markers in the given conversations,
+// keyed by conversation ID, with one query. Conversations the user hasn't
+// read anything in are left out of the map.
+func getLastReads(ctx context.Context, userID string, conversationIDs []string) (map[string]*models.ReadState, error) {
+	query := `
+		SELECT user_id, conversation_id, last_read_message_id, last_read_seq, read_at
+		FROM conversation_reads
+		WHERE user_id = $1 AND conversation_id = ANY($2::uuid[])
+	`
+
+	rows, err := DB.QueryContext(ctx, query, userID, pq.Array(conversationIDs))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query last reads: %w", err)
+	}
+	defer rows.Close()
+
+	states := make(map[string]*models.ReadState)
+	for rows.Next() {
+		state, err := scanReadState(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan last read: %w", err)
+		}
+		states[state.ConversationID] = state
+	}
+
+	return states, nil
+}
+
+// GetUnreadCounts returns, for each of userID's conversations that has unread
+// messages, how many messages other people sent after the user's read marker.
+// Conversations with nothing unread are left out of the map.
+// One aggregate query covers every conversation.
+func GetUnreadCounts(userID string) (map[string]int, error) {
+	return GetUnreadCountsContext(context.Background(), userID)
+}
+
+// GetUnreadCountsContext is like GetUnreadCounts, but runs under ctx and is cut off after QueryTimeout.
+func GetUnreadCountsContext(ctx context.Context, userID string) (map[string]int, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	return getUnreadCounts(ctx, userID, nil)
+}
+
+// getUnreadCounts implements GetUnreadCounts. Non-nil conversationIDs limits
+// the counts to those conversations.
+func getUnreadCounts(ctx context.Context, userID string, conversationIDs []string) (map[string]int, error) {
+	// A nil slice is passed as NULL, which matches every conversation.
+	query := `
+		SELECT m.conversation_id, COUNT(*)
+		FROM messages m
+		JOIN conversation_participants cp
+			ON cp.conversation_id = m.conversation_id AND cp.user_id = $1
+		LEFT JOIN conversation_reads cr
+			ON cr.conversation_id = m.conversation_id AND cr.user_id = $1
+		WHERE m.deleted_at IS NULL
+		AND m.sender_id <> $1
+		AND m.seq > COALESCE(cr.last_read_seq, 0)
+		AND ($2::uuid[] IS NULL OR m.conversation_id = ANY($2::uuid[]))
+		GROUP BY m.conversation_id
+	`
+
+	rows, err := DB.QueryContext(ctx, query, userID, pq.Array(conversationIDs))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query unread counts: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var conversationID string
+		var count int
+		if err := rows.Scan(&conversationID, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan unread count: %w", err)
+		}
+		counts[conversationID] = count
+	}
+
+	return counts, nil
+}
+
+// scanReadState scans a conversation_reads row.
+func scanReadState(row rowScanner) (*models.ReadState, error) {
+	var state models.ReadState
+	err := row.Scan(&state.UserID, &state.ConversationID, &state.MessageID, &state.Seq, &state.ReadAt)
+	if err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
@@ -0,0 +1,71 @@
+// Package db - refresh token database operations
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// CreateRefreshToken stores a new refresh token hash for a user, valid for ttl.
+func CreateRefreshToken(userID, tokenHash string, ttl time.Duration) error {
+	query := `INSERT INTO refresh_tokens (user_id, token_hash, expires_at)
+	          VALUES ($1, $2, NOW() + $3::float8 * INTERVAL '1 second')`
+
+	_, err := DB.Exec(query, userID, tokenHash, ttl.Seconds())
+	if err != nil {
+		return fmt.Errorf("failed to create refresh token: %w", err)
+	}
+	return nil
+}
+
+// ValidateRefreshToken checks a refresh token hash and marks it as used.
+// A token is valid if it exists, is not revoked, has not expired and - when
+// idleTTL is non-zero - was last used within idleTTL.
+// Returns the owning user ID, or "" if the token is not valid.
+func ValidateRefreshToken(tokenHash string, idleTTL time.Duration) (string, error) {
+	// The UPDATE only matches valid tokens, so checking and touching
+	// last_used_at happen atomically.
+	query := `UPDATE refresh_tokens SET last_used_at = NOW()
+	          WHERE token_hash = $1
+	          AND revoked_at IS NULL
+	          AND expires_at > NOW()
+	          AND ($2::float8 = 0 OR last_used_at > NOW() - $2::float8 * INTERVAL '1 second')
+	          RETURNING user_id`
+
+	var userID string
+	err := DB.QueryRow(query, tokenHash, idleTTL.Seconds()).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to validate refresh token: %w", err)
+	}
+
+	return userID, nil
+}
+
+// RevokeRefreshToken revokes a user's refresh token so it can't be used again.
+// Only tokens belonging to userID are affected.
+func RevokeRefreshToken(tokenHash, userID string) error {
+	query := `UPDATE refresh_tokens SET revoked_at = NOW()
+	          WHERE token_hash = $1 AND user_id = $2 AND revoked_at IS NULL`
+
+	_, err := DB.Exec(query, tokenHash, userID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke refresh token: %w", err)
+	}
+	return nil
+}
+
+// RevokeUserRefreshTokens revokes every refresh token userID still holds.
+func RevokeUserRefreshTokens(userID string) error {
+	query := `UPDATE refresh_tokens SET revoked_at = NOW()
+	          WHERE user_id = $1 AND revoked_at IS NULL`
+
+	_, err := DB.Exec(query, userID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke refresh tokens: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+// Package db - reply preview database operations
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/lib/pq"
+
+	"chatgo/internal/models"
+)
+
+// ErrInvalidReplyTo is returned when a message replies to a message that
+// doesn't exist, was deleted, or is in another conversation.
+var ErrInvalidReplyTo = errors.New("reply target not found in this conversation")
+
+// ReplyPreviewLength is how many characters of the parent message are kept
+// in a reply preview.
+const ReplyPreviewLength = 100
+
+// truncatePreview shortens content to ReplyPreviewLength characters.
+func truncatePreview(content string) string {
+	runes := []rune(content)
+	if len(runes) <= ReplyPreviewLength {
+		return content
+	}
+	return string(runes[:ReplyPreviewLength]) + "…"
+}
+
+// loadReplyPreviews fills in the ReplyTo preview of each message that is a
+// reply, with one query for all of them.
+func loadReplyPreviews(ctx context.Context, messages []models.Message) error {
+	var ids []string
+	for i := range messages {
+		if messages[i].ReplyToID != nil {
+			ids = append(ids, *messages[i].ReplyToID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	query := `
+		SELECT m.id, m.sender_id, u.username, u.display_name, m.content, m.deleted_at IS NOT NULL
+		FROM messages m
+		JOIN users u ON m.sender_id = u.id
+		WHERE m.id = ANY($1::uuid[])
+	`
+
+	rows, err := DB.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return fmt.Errorf("failed to query reply previews: %w", err)
+	}
+	defer rows.Close()
+
+	previews := make(map[string]*models.MessagePreview)
+	for rows.Next() {
+		var p models.MessagePreview
+		err := rows.Scan(&p.ID, &p.SenderID, &p.SenderUsername, &p.SenderDisplayName, &p.Content, &p.Deleted)
+		if err != nil {
+			return fmt.Errorf("failed to scan reply preview: %w", err)
+		}
+		// Deleted messages keep their row, but not their content.
+		if p.Deleted {
+			p.Content = ""
+		}
+		p.Content = truncatePreview(p.Content)
+		previews[p.ID] = &p
+	}
+
+	for i := range messages {
+		if messages[i].ReplyToID != nil {
+			messages[i].ReplyTo = previews[*messages[i].ReplyToID]
+		}
+	}
+	return nil
+}
@@ -3,30 +3,73 @@ package db
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 
+	"github.com/lib/pq"
+
+	"chatgo/internal/auth"
 	"chatgo/internal/models"
 )
 
-// GetUserByUsername finds a user by their username.
-// Returns the user and nil error if found.
-// Returns nil user and nil error if not found.
-// Returns nil user and error if something went wrong.
-func GetUserByUsername(username string) (*models.User, error) {
-	query := `SELECT id, username, password_hash, is_admin, created_at
-	          FROM users WHERE username = $1`
+// ErrUsernameTaken is returned when a user would get a username someone else has.
+// The unique index on LOWER(username) decides, so concurrent requests for the
+// same name can't both succeed, and names differing only in case clash.
+var ErrUsernameTaken = errors.New("username already taken")
+
+// ErrLastAdmin is returned when deleting, demoting or deactivating a user
+// would leave no active admin.
+var ErrLastAdmin = errors.New("cannot remove the last admin")
 
-	row := DB.QueryRow(query, username)
+// uniqueViolation is the Postgres error code for a unique constraint violation.
+const uniqueViolation = "23505"
 
+// isUniqueViolation reports whether err is a unique constraint violation.
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == uniqueViolation
+}
+
+// userColumns is the column list every user query selects, in scanUser order.
+const userColumns = `id, username, display_name, password_hash, is_admin, is_bot, is_active, avatar_url, last_seen_at, created_at`
+
+// rowScanner is implemented by both *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanUser scans a row selected with userColumns into a User.
+func scanUser(row rowScanner) (*models.User, error) {
 	var user models.User
 	err := row.Scan(
 		&user.ID,
 		&user.Username,
+		&user.DisplayName,
 		&user.PasswordHash,
 		&user.IsAdmin,
+		&user.IsBot,
+		&user.IsActive,
+		&user.AvatarURL,
+		&user.LastSeenAt,
 		&user.CreatedAt,
 	)
+	if err != nil {
+		return nil, err
+	}
+	user.LastSeenAt = utcPtr(user.LastSeenAt)
+	return &user, nil
+}
+
+// GetUserByUsername finds a user by their username, ignoring case,
+// so logins work however the user capitalizes their name.
+// Returns the user and nil error if found.
+// Returns nil user and nil error if not found.
+// Returns nil user and error if something went wrong.
+func GetUserByUsername(username string) (*models.User, error) {
+	query := `SELECT ` + userColumns + `
+	          FROM users WHERE LOWER(username) = LOWER($1)`
 
+	user, err := scanUser(DB.QueryRow(query, username))
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -34,25 +77,15 @@ func GetUserByUsername(username string) (*models.User, error) {
 		return nil, fmt.Errorf("failed to get user: %w", err)
 	}
 
-	return &user, nil
+	return user, nil
 }
 
 // GetUserByID finds a user by their ID.
 func GetUserByID(id string) (*models.User, error) {
-	query := `SELECT id, username, password_hash, is_admin, created_at
+	query := `SELECT ` + userColumns + `
 	          FROM users WHERE id = $1`
 
-	row := DB.QueryRow(query, id)
-
-	var user models.User
-	err := row.Scan(
-		&user.ID,
-		&user.Username,
-		&user.PasswordHash,
-		&user.IsAdmin,
-		&user.CreatedAt,
-	)
-
+	user, err := scanUser(DB.QueryRow(query, id))
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -60,15 +93,60 @@ func GetUserByID(id string) (*models.User, error) {
 		return nil, fmt.Errorf("failed to get user: %w", err)
 	}
 
-	return &user, nil
+	return user, nil
+}
+
+// requireOtherAdmin locks the active admins' rows for the rest of tx and
+// returns ErrLastAdmin if id is the only one. A concurrent change to another
+// admin waits on the lock and then sees this one's result, so two admins
+// demoting or deleting each other at once can't both succeed.
+// Deactivated admins can't log in, so they don't count.
+func requireOtherAdmin(tx *sql.Tx, id string) error {
+	rows, err := tx.Query(`SELECT id FROM users WHERE is_admin AND is_active FOR UPDATE`)
+	if err != nil {
+		return fmt.Errorf("failed to lock admins: %w", err)
+	}
+	defer rows.Close()
+
+	count, isAdmin := 0, false
+	for rows.Next() {
+		var adminID string
+		if err := rows.Scan(&adminID); err != nil {
+			return fmt.Errorf("failed to scan admin: %w", err)
+		}
+		count++
+		isAdmin = isAdmin || adminID == id
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to lock admins: %w", err)
+	}
+
+	if isAdmin && count <= 1 {
+		return ErrLastAdmin
+	}
+	return nil
 }
 
 // GetAllUsers returns all users from the database.
-func GetAllUsers() ([]models.User, error) {
-	query := `SELECT id, username, password_hash, is_admin, created_at
-	          FROM users ORDER BY created_at`
+// Bot accounts are only included if includeBots is true.
+func GetAllUsers(includeBots bool) ([]models.User, error) {
+	return GetUsers(includeBots, 0, 0)
+}
+
+// GetUsers returns one page of users in the order GetAllUsers uses, at most
+// limit of them after skipping offset; limit 0 means no limit.
+func GetUsers(includeBots bool, limit, offset int) ([]models.User, error) {
+	query := `SELECT ` + userColumns + `
+	          FROM users WHERE ($1 OR NOT is_bot) ORDER BY created_at, id
+	          LIMIT $2 OFFSET $3`
 
-	rows, err := DB.Query(query)
+	// NULL means no limit
+	var pageLimit sql.NullInt64
+	if limit > 0 {
+		pageLimit = sql.NullInt64{Int64: int64(limit), Valid: true}
+	}
+
+	rows, err := DB.Query(query, includeBots, pageLimit, offset)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query users: %w", err)
 	}
@@ -76,53 +154,59 @@ func GetAllUsers() ([]models.User, error) {
 
 	var users []models.User
 	for rows.Next() {
-		var user models.User
-		err := rows.Scan(
-			&user.ID,
-			&user.Username,
-			&user.PasswordHash,
-			&user.IsAdmin,
-			&user.CreatedAt,
-		)
+		user, err := scanUser(rows)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan user: %w", err)
 		}
-		users = append(users, user)
+		users = append(users, *user)
 	}
 
 	return users, nil
 }
 
-// CreateUser inserts a new user into the database.
-// Returns the created user with its generated ID.
-func CreateUser(username, passwordHash string, isAdmin bool) (*models.User, error) {
-	query := `INSERT INTO users (username, password_hash, is_admin)
-	          VALUES ($1, $2, $3)
-	          RETURNING id, username, password_hash, is_admin, created_at`
+// CountUsers returns how many users GetAllUsers would return.
+func CountUsers(includeBots bool) (int, error) {
+	var count int
+	err := DB.QueryRow(`SELECT COUNT(*) FROM users WHERE ($1 OR NOT is_bot)`, includeBots).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count users: %w", err)
+	}
+	return count, nil
+}
 
-	row := DB.QueryRow(query, username, passwordHash, isAdmin)
+// CreateUser inserts a new user into the database.
+// Returns the created user with its generated ID, or ErrUsernameTaken.
+func CreateUser(username, passwordHash string, isAdmin, isBot bool) (*models.User, error) {
+	query := `INSERT INTO users (username, display_name, password_hash, is_admin, is_bot)
+	          VALUES ($1, $1, $2, $3, $4)
+	          RETURNING ` + userColumns
 
-	var user models.User
-	err := row.Scan(
-		&user.ID,
-		&user.Username,
-		&user.PasswordHash,
-		&user.IsAdmin,
-		&user.CreatedAt,
-	)
+	user, err := scanUser(DB.QueryRow(query, username, passwordHash, isAdmin, isBot))
+	if isUniqueViolation(err) {
+		return nil, ErrUsernameTaken
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to create user: %w", err)
 	}
 
-	return &user, nil
+	return user, nil
 }
 
 // DeleteUser removes a user from the database.
-// Returns true if a user was deleted, false if no user found.
+// Returns true if a user was deleted, false if no user found, or
+// ErrLastAdmin if they are the only active admin.
 func DeleteUser(id string) (bool, error) {
-	query := `DELETE FROM users WHERE id = $1`
+	tx, err := DB.Begin()
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
 
-	result, err := DB.Exec(query, id)
+	if err := requireOtherAdmin(tx, id); err != nil {
+		return false, err
+	}
+
+	result, err := tx.Exec(`DELETE FROM users WHERE id = $1`, id)
 	if err != nil {
 		return false, fmt.Errorf("failed to delete user: %w", err)
 	}
@@ -133,45 +217,287 @@ func DeleteUser(id string) (bool, error) {
 		return false, fmt.Errorf("failed to get rows affected: %w", err)
 	}
 
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
 	return rowsAffected > 0, nil
 }
 
 // UpdateUser updates a user's username, password (optional), and admin status.
 // If passwordHash is empty, the password is not changed.
-// Returns the updated user, or nil if user not found.
-func UpdateUser(id, username, passwordHash string, isAdmin bool) (*models.User, error) {
+// Returns the updated user, or nil if user not found. Returns ErrLastAdmin
+// if isAdmin is false and they are the only active admin.
+func UpdateUser(id, username, passwordHash string, isAdmin bool, avatarURL *string) (*models.User, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if !isAdmin {
+		if err := requireOtherAdmin(tx, id); err != nil {
+			return nil, err
+		}
+	}
+
 	var query string
 	var row *sql.Row
 
+	// A nil avatarURL is passed as NULL, and COALESCE keeps the current one.
 	if passwordHash == "" {
 		// Update without changing password.
-		query = `UPDATE users SET username = $1, is_admin = $2
-		         WHERE id = $3
-		         RETURNING id, username, password_hash, is_admin, created_at`
-		row = DB.QueryRow(query, username, isAdmin, id)
+		query = `UPDATE users SET username = $1, is_admin = $2, avatar_url = COALESCE($3, avatar_url)
+		         WHERE id = $4
+		         RETURNING ` + userColumns
+		row = tx.QueryRow(query, username, isAdmin, avatarURL, id)
 	} else {
 		// Update including new password.
-		query = `UPDATE users SET username = $1, password_hash = $2, is_admin = $3
-		         WHERE id = $4
-		         RETURNING id, username, password_hash, is_admin, created_at`
-		row = DB.QueryRow(query, username, passwordHash, isAdmin, id)
+		query = `UPDATE users SET username = $1, password_hash = $2, is_admin = $3,
+		         avatar_url = COALESCE($4, avatar_url)
+		         WHERE id = $5
+		         RETURNING ` + userColumns
+		row = tx.QueryRow(query, username, passwordHash, isAdmin, avatarURL, id)
 	}
 
-	var user models.User
-	err := row.Scan(
-		&user.ID,
-		&user.Username,
-		&user.PasswordHash,
-		&user.IsAdmin,
-		&user.CreatedAt,
-	)
-
+	user, err := scanUser(row)
 	if err == sql.ErrNoRows {
 		return nil, nil // User not found
 	}
+	if isUniqueViolation(err) {
+		return nil, ErrUsernameTaken
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to update user: %w", err)
 	}
 
-	return &user, nil
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return user, nil
+}
+
+// UpdateUserProfile applies a user's own profile changes.
+// Nil fields are left as they are. Returns nil if the user doesn't exist.
+func UpdateUserProfile(id string, displayName, avatarURL *string) (*models.User, error) {
+	query := `UPDATE users SET display_name = COALESCE($1, display_name),
+	          avatar_url = COALESCE($2, avatar_url)
+	          WHERE id = $3
+	          RETURNING ` + userColumns
+
+	user, err := scanUser(DB.QueryRow(query, displayName, avatarURL, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to update profile: %w", err)
+	}
+
+	return user, nil
+}
+
+// SetUserActive activates or deactivates a user. Deactivated users keep
+// their messages and username but can no longer log in.
+// Returns nil if no user with that ID exists, or ErrLastAdmin when
+// deactivating the only active admin.
+func SetUserActive(id string, active bool) (*models.User, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if !active {
+		if err := requireOtherAdmin(tx, id); err != nil {
+			return nil, err
+		}
+	}
+
+	query := `UPDATE users SET is_active = $1
+	          WHERE id = $2
+	          RETURNING ` + userColumns
+
+	user, err := scanUser(tx.QueryRow(query, active, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to set user active: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return user, nil
+}
+
+// UpdateUsername renames a user, leaving every other column alone.
+// Returns nil if no user with that ID exists, or ErrUsernameTaken.
+func UpdateUsername(id, username string) (*models.User, error) {
+	query := `UPDATE users SET username = $1
+	          WHERE id = $2
+	          RETURNING ` + userColumns
+
+	user, err := scanUser(DB.QueryRow(query, username, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if isUniqueViolation(err) {
+		return nil, ErrUsernameTaken
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to update username: %w", err)
+	}
+
+	return user, nil
+}
+
+// SetUserAdmin grants or revokes admin rights, leaving every other column alone.
+// Returns nil if no user with that ID exists, or ErrLastAdmin when
+// demoting the only active admin.
+func SetUserAdmin(id string, isAdmin bool) (*models.User, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if !isAdmin {
+		if err := requireOtherAdmin(tx, id); err != nil {
+			return nil, err
+		}
+	}
+
+	query := `UPDATE users SET is_admin = $1
+	          WHERE id = $2
+	          RETURNING ` + userColumns
+
+	user, err := scanUser(tx.QueryRow(query, isAdmin, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to set user admin: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return user, nil
+}
+
+// UpdateLastSeen sets the user's last_seen_at to now. The WebSocket hub is
+// its only caller, and it throttles how often it calls it.
+func UpdateLastSeen(userID string) error {
+	_, err := DB.Exec(`UPDATE users SET last_seen_at = NOW() WHERE id = $1`, userID)
+	if err != nil {
+		return fmt.Errorf("failed to update last seen: %w", err)
+	}
+	return nil
+}
+
+// SetCurrentSessionID records jti as the user's current session, replacing
+// any earlier one. Used in single-session mode.
+func SetCurrentSessionID(userID, jti string) error {
+	_, err := DB.Exec(`UPDATE users SET current_session_id = $1 WHERE id = $2`, jti, userID)
+	if err != nil {
+		return fmt.Errorf("failed to set current session: %w", err)
+	}
+	return nil
+}
+
+// GetCurrentSessionID returns the jti recorded by SetCurrentSessionID, or ""
+// if there is none or the user doesn't exist.
+func GetCurrentSessionID(userID string) (string, error) {
+	var jti sql.NullString
+	err := DB.QueryRow(`SELECT current_session_id FROM users WHERE id = $1`, userID).Scan(&jti)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get current session: %w", err)
+	}
+	return jti.String, nil
+}
+
+// UpdateUserPassword replaces a user's password hash.
+// Returns false if no user with that ID exists.
+func UpdateUserPassword(id, passwordHash string) (bool, error) {
+	result, err := DB.Exec(`UPDATE users SET password_hash = $1 WHERE id = $2`, passwordHash, id)
+	if err != nil {
+		return false, fmt.Errorf("failed to update password: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	return rowsAffected > 0, nil
+}
+
+// EnsureAdminUser creates an admin account with the given credentials, but
+// only if the database has no admin at all yet (e.g. a fresh install).
+// Returns true if the admin was created.
+func EnsureAdminUser(username, password string) (bool, error) {
+	var exists bool
+	if err := DB.QueryRow(`SELECT EXISTS (SELECT 1 FROM users WHERE is_admin)`).Scan(&exists); err != nil {
+		return false, fmt.Errorf("failed to check for admin: %w", err)
+	}
+	if exists {
+		return false, nil
+	}
+
+	passwordHash, err := auth.HashPassword(password)
+	if err != nil {
+		return false, err
+	}
+
+	// Re-check in the INSERT so two servers starting together create one admin.
+	query := `INSERT INTO users (username, display_name, password_hash, is_admin)
+	          SELECT $1, $1, $2, TRUE
+	          WHERE NOT EXISTS (SELECT 1 FROM users WHERE is_admin)`
+
+	result, err := DB.Exec(query, username, passwordHash)
+	if err != nil {
+		return false, fmt.Errorf("failed to create admin: %w", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	return rowsAffected > 0, nil
+}
+
+// UsersExist checks a batch of user IDs in one query.
+// Returns the IDs (in request order) that don't belong to any user; an empty
+// result means they all exist. Malformed IDs count as unknown.
+func UsersExist(ids []string) ([]string, error) {
+	query := `
+		SELECT req.id
+		FROM unnest($1::text[]) WITH ORDINALITY AS req(id, n)
+		WHERE NOT EXISTS (SELECT 1 FROM users u WHERE u.id::text = req.id)
+		ORDER BY req.n
+	`
+
+	rows, err := DB.Query(query, pq.Array(ids))
+	if err != nil {
+		return nil, fmt.Errorf("failed to check users: %w", err)
+	}
+	defer rows.Close()
+
+	var unknown []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan user id: %w", err)
+		}
+		unknown = append(unknown, id)
+	}
+
+	return unknown, nil
 }
@@ -0,0 +1,54 @@
+package db_test
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"chatgo/internal/db"
+	"chatgo/internal/dbtest"
+)
+
+func TestAdminsDemotingEachOtherKeepOneAdmin(t *testing.T) {
+	dbtest.Open(t)
+	for round := range 10 {
+		var admins [2]string
+		for i := range admins {
+			user, err := db.CreateUser(fmt.Sprintf("admin-%d-%d", round, i), "!", true, false)
+			if err != nil {
+				t.Fatalf("CreateUser: %v", err)
+			}
+			admins[i] = user.ID
+		}
+
+		var wg sync.WaitGroup
+		errs := make([]error, len(admins))
+		for i, id := range admins {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, errs[i] = db.SetUserAdmin(id, false)
+			}()
+		}
+		wg.Wait()
+
+		refused := 0
+		for _, err := range errs {
+			if errors.Is(err, db.ErrLastAdmin) {
+				refused++
+			} else if err != nil {
+				t.Fatalf("SetUserAdmin: %v", err)
+			}
+		}
+		if refused != 1 {
+			t.Fatalf("round %d: %d of 2 demotions refused, want exactly 1", round, refused)
+		}
+
+		// Leave no admins behind for the next round. The guard would keep
+		// the survivor, so go around it.
+		if _, err := db.DB.Exec(`UPDATE users SET is_admin = FALSE`); err != nil {
+			t.Fatalf("failed to clear admins: %v", err)
+		}
+	}
+}
@@ -0,0 +1,218 @@
+// Package dbtest sets up databases for tests: a real PostgreSQL schema for
+// tests of the SQL itself (Open), or a scripted fake for tests of the code
+// around it (UseFake).
+package dbtest
+
+import (
+	"database/sql"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"chatgo/internal/db"
+	"chatgo/internal/models"
+)
+
+// URLEnv names the environment variable holding the PostgreSQL connection
+// string for tests. Tests that need a database are skipped when it's unset.
+const URLEnv = "CHATGO_TEST_DATABASE_URL"
+
+var (
+	setupOnce sync.Once
+	setupDB   *sql.DB
+	setupErr  error
+)
+
+// Open points db.DB at a clean test database for the rest of the test.
+//
+// Each test binary gets its own schema (named after the package), created
+// fresh with every migration the first time Open is called. Every call then
+// empties all tables, so tests start from nothing but the system user.
+// Tests using Open must not run in parallel with each other.
+func Open(t testing.TB) {
+	t.Helper()
+	connStr := os.Getenv(URLEnv)
+	if connStr == "" {
+		t.Skip(URLEnv + " not set; skipping database test")
+	}
+
+	setupOnce.Do(func() {
+		setupDB, setupErr = setup(connStr)
+	})
+	if setupErr != nil {
+		t.Fatalf("failed to set up test database: %v", setupErr)
+	}
+	if err := reset(setupDB); err != nil {
+		t.Fatalf("failed to reset test database: %v", err)
+	}
+
+	db.DB = setupDB
+}
+
+// setup creates this binary's schema and applies the migrations to it.
+func setup(connStr string) (*sql.DB, error) {
+	schema := "chatgo_test_" + strings.TrimSuffix(filepath.Base(os.Args[0]), ".test")
+	schema = strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '_' {
+			return r
+		}
+		return '_'
+	}, strings.ToLower(schema))
+
+	admin, err := sql.Open("postgres", connStr)
+	if err != nil {
+		return nil, err
+	}
+	defer admin.Close()
+	if _, err := admin.Exec(`DROP SCHEMA IF EXISTS ` + schema + ` CASCADE; CREATE SCHEMA ` + schema); err != nil {
+		return nil, fmt.Errorf("failed to create schema: %w", err)
+	}
+
+	conn, err := sql.Open("postgres", withSearchPath(connStr, schema))
+	if err != nil {
+		return nil, err
+	}
+	if err := migrate(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// withSearchPath adds a search_path setting to a URL or key=value connection string.
+func withSearchPath(connStr, schema string) string {
+	if !strings.Contains(connStr, "://") {
+		return connStr + " search_path=" + schema
+	}
+	u, err := url.Parse(connStr)
+	if err != nil {
+		return connStr
+	}
+	q := u.Query()
+	q.Set("search_path", schema)
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// migrate applies every migration in order.
+func migrate(conn *sql.DB) error {
+	dir, err := migrationsDir()
+	if err != nil {
+		return err
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.sql"))
+	if err != nil {
+		return err
+	}
+	sort.Strings(files)
+
+	for _, f := range files {
+		script, err := os.ReadFile(f)
+		if err != nil {
+			return err
+		}
+		if _, err := conn.Exec(string(script)); err != nil {
+			return fmt.Errorf("failed to apply %s: %w", filepath.Base(f), err)
+		}
+	}
+	return nil
+}
+
+// migrationsDir finds migrations/ by walking up to the module root.
+func migrationsDir() (string, error) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	for {
+		if _, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil {
+			return filepath.Join(dir, "migrations"), nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", fmt.Errorf("go.mod not found above working directory")
+		}
+		dir = parent
+	}
+}
+
+// reset empties every table and puts the system user back.
+func reset(conn *sql.DB) error {
+	rows, err := conn.Query(`SELECT tablename FROM pg_tables WHERE schemaname = current_schema()`)
+	if err != nil {
+		return err
+	}
+	var tables []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return err
+		}
+		tables = append(tables, name)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if len(tables) > 0 {
+		if _, err := conn.Exec(`TRUNCATE ` + strings.Join(tables, ", ") + ` CASCADE`); err != nil {
+			return err
+		}
+	}
+	_, err = conn.Exec(
+		`INSERT INTO users (id, username, display_name, password_hash, is_admin, is_bot) VALUES ($1, 'system', 'system', '!', FALSE, TRUE)`,
+		db.SystemUserID,
+	)
+	return err
+}
+
+// User creates a regular user called username.
+func User(t testing.TB, username string) *models.User {
+	t.Helper()
+	user, err := db.CreateUser(username, "!", false, false)
+	if err != nil {
+		t.Fatalf("failed to create user %s: %v", username, err)
+	}
+	return user
+}
+
+// Direct creates a 1:1 conversation between two users.
+func Direct(t testing.TB, a, b *models.User) *models.Conversation {
+	t.Helper()
+	conv, err := db.GetOrCreateConversation(a.ID, b.ID)
+	if err != nil {
+		t.Fatalf("failed to create conversation: %v", err)
+	}
+	return conv
+}
+
+// Group creates a group conversation owned by creator with the other members.
+func Group(t testing.TB, name string, creator *models.User, members ...*models.User) *models.Conversation {
+	t.Helper()
+	ids := make([]string, len(members))
+	for i, m := range members {
+		ids[i] = m.ID
+	}
+	conv, err := db.CreateGroupConversation(name, creator.ID, ids)
+	if err != nil {
+		t.Fatalf("failed to create group: %v", err)
+	}
+	return conv
+}
+
+// Message posts content from sender in a conversation.
+func Message(t testing.TB, conv *models.Conversation, sender *models.User, content string) *models.Message {
+	t.Helper()
+	msg, err := db.CreateMessage(conv.ID, sender.ID, content, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create message: %v", err)
+	}
+	return msg
+}
@@ -0,0 +1,222 @@
+package dbtest
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"chatgo/internal/db"
+)
+
+// Result is what a scripted statement returns: rows for a query, or just
+// RowsAffected for an exec. A non-nil Err fails the statement instead.
+// If Next is set, the rows after Rows are produced on demand: Next is called
+// each time the caller reads a row, until it returns nil.
+type Result struct {
+	Columns      []string
+	Rows         [][]driver.Value
+	Next         func() []driver.Value
+	RowsAffected int64
+	Err          error
+}
+
+// Call is one statement the code under test ran against a Fake.
+type Call struct {
+	Query string
+	Args  []driver.Value
+}
+
+// Fake is a scripted stand-in for PostgreSQL, for tests that exercise code
+// around the database rather than the SQL itself. Statements are matched by
+// substring against the handlers registered with On, in order; a statement
+// nothing matches returns no rows and affects nothing. Transactions are
+// accepted and do nothing. Safe for concurrent use.
+type Fake struct {
+	mutex    sync.Mutex
+	handlers []fakeHandler
+	calls    []Call
+}
+
+type fakeHandler struct {
+	fragment string
+	fn       func(args []driver.Value) Result
+}
+
+// UseFake makes a new Fake answer db.DB's statements until the test ends.
+//
+// db.DB itself is set once per process and then left alone: goroutines a
+// test started (presence timers, delivery workers) may outlive it and still
+// query the database. Between tests, statements fail with an error.
+func UseFake(t testing.TB) *Fake {
+	t.Helper()
+	f := &Fake{}
+
+	fakeOnce.Do(func() { fakeDB = sql.OpenDB(fakeConnector{}) })
+	if db.DB != fakeDB {
+		db.DB = fakeDB
+	}
+	currentFake.Store(f)
+	t.Cleanup(func() { currentFake.CompareAndSwap(f, nil) })
+	return f
+}
+
+var (
+	fakeOnce    sync.Once
+	fakeDB      *sql.DB
+	currentFake atomic.Pointer[Fake]
+)
+
+// errNoFake is returned for statements run while no test is using a Fake.
+var errNoFake = errors.New("dbtest: no fake database in use")
+
+// On answers every statement containing fragment with fn's result.
+// Handlers registered earlier win.
+func (f *Fake) On(fragment string, fn func(args []driver.Value) Result) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.handlers = append(f.handlers, fakeHandler{fragment: fragment, fn: fn})
+}
+
+// OnRows answers every statement containing fragment with fixed rows.
+func (f *Fake) OnRows(fragment string, columns []string, rows ...[]driver.Value) {
+	f.On(fragment, func([]driver.Value) Result {
+		return Result{Columns: columns, Rows: rows}
+	})
+}
+
+// Calls returns the statements run so far that contain fragment.
+func (f *Fake) Calls(fragment string) []Call {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	var calls []Call
+	for _, c := range f.calls {
+		if strings.Contains(c.Query, fragment) {
+			calls = append(calls, c)
+		}
+	}
+	return calls
+}
+
+// run records a statement on the current Fake and looks up its result.
+func run(query string, named []driver.NamedValue) Result {
+	f := currentFake.Load()
+	if f == nil {
+		return Result{Err: errNoFake}
+	}
+
+	args := make([]driver.Value, len(named))
+	for i, nv := range named {
+		args[i] = nv.Value
+	}
+
+	f.mutex.Lock()
+	f.calls = append(f.calls, Call{Query: query, Args: args})
+	var fn func([]driver.Value) Result
+	for _, h := range f.handlers {
+		if strings.Contains(query, h.fragment) {
+			fn = h.fn
+			break
+		}
+	}
+	f.mutex.Unlock()
+
+	if fn == nil {
+		return Result{}
+	}
+	return fn(args)
+}
+
+// fakeConnector opens connections that answer from the current Fake.
+type fakeConnector struct{}
+
+func (fakeConnector) Connect(context.Context) (driver.Conn, error) { return fakeConn{}, nil }
+func (fakeConnector) Driver() driver.Driver                        { return fakeDriver{} }
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(string) (driver.Conn, error) { return fakeConn{}, nil }
+
+// fakeConn answers statements directly (QueryerContext, ExecerContext), so
+// database/sql never needs to prepare them.
+type fakeConn struct{}
+
+func (fakeConn) Prepare(query string) (driver.Stmt, error) { return fakeStmt{query: query}, nil }
+func (fakeConn) Close() error                              { return nil }
+func (fakeConn) Begin() (driver.Tx, error)                 { return fakeTx{}, nil }
+
+func (fakeConn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	res := run(query, args)
+	if res.Err != nil {
+		return nil, res.Err
+	}
+	return &fakeRows{columns: res.Columns, rows: res.Rows, next: res.Next}, nil
+}
+
+func (fakeConn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	res := run(query, args)
+	if res.Err != nil {
+		return nil, res.Err
+	}
+	return driver.RowsAffected(res.RowsAffected), nil
+}
+
+type fakeStmt struct {
+	query string
+}
+
+func (s fakeStmt) Close() error  { return nil }
+func (s fakeStmt) NumInput() int { return -1 }
+
+func (s fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return fakeConn{}.ExecContext(context.Background(), s.query, named(args))
+}
+
+func (s fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return fakeConn{}.QueryContext(context.Background(), s.query, named(args))
+}
+
+func named(args []driver.Value) []driver.NamedValue {
+	nv := make([]driver.NamedValue, len(args))
+	for i, a := range args {
+		nv[i] = driver.NamedValue{Ordinal: i + 1, Value: a}
+	}
+	return nv
+}
+
+type fakeTx struct{}
+
+func (fakeTx) Commit() error   { return nil }
+func (fakeTx) Rollback() error { return nil }
+
+type fakeRows struct {
+	columns []string
+	rows    [][]driver.Value
+	next    func() []driver.Value
+}
+
+func (r *fakeRows) Columns() []string { return r.columns }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		if r.next == nil {
+			return io.EOF
+		}
+		row := r.next()
+		if row == nil {
+			return io.EOF
+		}
+		copy(dest, row)
+		return nil
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
@@ -0,0 +1,10 @@
+// Package models - server activity data structures
+package models
+
+import "time"
+
+// ActivityBucket is the number of messages sent in one time bucket.
+type ActivityBucket struct {
+	Start        time.Time `json:"start"`
+	MessageCount int       `json:"message_count"`
+}
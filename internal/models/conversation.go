@@ -12,18 +12,53 @@ type Conversation struct {
 
 // Message represents a single chat message.
 type Message struct {
-	ID             string    `json:"id"`
-	ConversationID string    `json:"conversation_id"`
-	SenderID       string    `json:"sender_id"`
-	SenderUsername string    `json:"sender_username,omitempty"` // Populated when fetching messages
-	Content        string    `json:"content"`
-	CreatedAt      time.Time `json:"created_at"`
+	ID                string          `json:"id"`
+	ConversationID    string          `json:"conversation_id"`
+	SenderID          string          `json:"sender_id"`
+	SenderUsername    string          `json:"sender_username,omitempty"` // Populated when fetching messages
+	SenderDisplayName string          `json:"sender_display_name,omitempty"`
+	SenderAvatarURL   string          `json:"sender_avatar_url,omitempty"`
+	Content           string          `json:"content"`
+	Seq               int64           `json:"seq"`                   // Position in the conversation, starting at 1
+	IsSystem          bool            `json:"is_system"`             // Sent by the server, not a real user
+	ExpiresAt         *time.Time      `json:"expires_at,omitempty"`  // Set for ephemeral messages
+	EditedAt          *time.Time      `json:"edited_at,omitempty"`   // Set once the sender edits it
+	Attachments       []Attachment    `json:"attachments,omitempty"` // Files attached by the sender
+	ReplyToID         *string         `json:"reply_to_id,omitempty"` // Message this one replies to
+	ReplyTo           *MessagePreview `json:"reply_to,omitempty"`    // Short preview of that message
+	CreatedAt         time.Time       `json:"created_at"`
+}
+
+// MessagePreview is a shortened copy of a message, embedded in replies
+// so clients can render the quoted message without fetching it.
+type MessagePreview struct {
+	ID                string `json:"id"`
+	SenderID          string `json:"sender_id"`
+	SenderUsername    string `json:"sender_username"`
+	SenderDisplayName string `json:"sender_display_name"`
+	Content           string `json:"content"` // Truncated; empty if deleted
+	Deleted           bool   `json:"deleted,omitempty"`
 }
 
+// Participant roles.
+const (
+	RoleOwner  = "owner"  // Created the group
+	RoleMember = "member" // Everyone else
+)
+
+// Conversation types accepted by the ?type= filter on the conversation list.
+const (
+	ConversationTypeDirect = "direct" // 1:1 conversations
+	ConversationTypeGroup  = "group"  // Group conversations
+)
+
 // Participant represents a user in a conversation.
 type Participant struct {
-	ID       string `json:"id"`
-	Username string `json:"username"`
+	ID          string     `json:"id"`
+	Username    string     `json:"username"`
+	DisplayName string     `json:"display_name"`
+	AvatarURL   string     `json:"avatar_url"`
+	LastSeenAt  *time.Time `json:"last_seen_at,omitempty"` // Last time they were connected
 }
 
 // ConversationWithParticipants includes all participants in the conversation.
@@ -33,5 +68,106 @@ type ConversationWithParticipants struct {
 	Name         string        `json:"name,omitempty"`
 	IsGroup      bool          `json:"is_group"`
 	Participants []Participant `json:"participants"`
+	LastMessage  *Message      `json:"last_message,omitempty"` // Most recent message, for previews
+	LastRead     *ReadState    `json:"last_read,omitempty"`    // The requesting user's read marker
+	UnreadCount  int           `json:"unread_count"`           // Messages from others after LastRead
+	Muted        bool          `json:"muted"`                  // The requesting user muted it; clients skip notification sounds
 	CreatedAt    time.Time     `json:"created_at"`
 }
+
+// ReadState is how far one user has read in a conversation.
+// Every message with Seq up to and including this one counts as read.
+type ReadState struct {
+	UserID         string    `json:"user_id"`
+	ConversationID string    `json:"conversation_id"`
+	MessageID      string    `json:"message_id"`
+	Seq            int64     `json:"seq"`
+	ReadAt         time.Time `json:"read_at"`
+}
+
+// ConversationSettings combines a conversation's own settings with the
+// requesting user's per-user settings, so clients can read them in one call.
+type ConversationSettings struct {
+	ConversationID   string                   `json:"conversation_id"`
+	Name             string                   `json:"name,omitempty"`
+	IsGroup          bool                     `json:"is_group"`
+	ReadOnly         bool                     `json:"read_only"`
+	ParticipantCount int                      `json:"participant_count"`
+	CreatedAt        time.Time                `json:"created_at"`
+	User             UserConversationSettings `json:"user"`
+}
+
+// UserConversationSettings holds one user's settings for a conversation.
+type UserConversationSettings struct {
+	Role     string    `json:"role"`
+	JoinedAt time.Time `json:"joined_at"`
+	Muted    bool      `json:"muted"` // No notification hints for new messages
+}
+
+// ConversationPermissions says what a user may do in a conversation,
+// so clients know which controls to show.
+type ConversationPermissions struct {
+	CanRename            bool `json:"can_rename"`
+	CanAddParticipant    bool `json:"can_add_participant"`
+	CanRemoveParticipant bool `json:"can_remove_participant"`
+	CanPost              bool `json:"can_post"`
+	CanPin               bool `json:"can_pin"`
+}
+
+// Permissions works out what the user in s.User may do in the conversation.
+// This is the one place these rules live; the REST API and WebSocket both use it.
+//   - The group owner can do everything.
+//   - 1:1 conversations can't be renamed or grown.
+//   - Group members can add people but only the owner renames or removes them.
+//   - Read-only conversations allow posting and pinning by the owner only.
+func (s *ConversationSettings) Permissions() ConversationPermissions {
+	if s.User.Role == RoleOwner {
+		return ConversationPermissions{
+			CanRename:            true,
+			CanAddParticipant:    true,
+			CanRemoveParticipant: true,
+			CanPost:              true,
+			CanPin:               true,
+		}
+	}
+
+	return ConversationPermissions{
+		CanRename:            false,
+		CanAddParticipant:    s.IsGroup,
+		CanRemoveParticipant: false,
+		CanPost:              !s.ReadOnly,
+		CanPin:               !s.ReadOnly,
+	}
+}
+
+// Attachment describes a file uploaded to the server.
+// Width, Height and ThumbnailURL are only set for images.
+type Attachment struct {
+	URL          string `json:"url"`
+	Filename     string `json:"filename"`
+	MimeType     string `json:"mime_type"`
+	Size         int64  `json:"size"`
+	Width        int    `json:"width,omitempty"`
+	Height       int    `json:"height,omitempty"`
+	ThumbnailURL string `json:"thumbnail_url,omitempty"`
+}
+
+// DeliveryTrace describes how a message was delivered to each participant.
+// Used by the admin diagnostics endpoint.
+type DeliveryTrace struct {
+	MessageID      string           `json:"message_id"`
+	ConversationID string           `json:"conversation_id"`
+	SenderID       string           `json:"sender_id"`
+	Recipients     []DeliveryStatus `json:"recipients"`
+}
+
+// DeliveryStatus is one participant's delivery state for a message.
+type DeliveryStatus struct {
+	UserID     string     `json:"user_id"`
+	Username   string     `json:"username"`
+	Status     string     `json:"status"` // "delivered", "offline", "dropped" or "" if unknown
+	RecordedAt *time.Time `json:"recorded_at,omitempty"`
+	Read       bool       `json:"read"`              // Their read marker is at or past this message
+	ReadAt     *time.Time `json:"read_at,omitempty"` // When that read marker was set
+	OnlineNow  bool       `json:"online_now"`
+}
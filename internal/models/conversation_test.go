@@ -0,0 +1,42 @@
+package models
+
+import "testing"
+
+func TestConversationPermissions(t *testing.T) {
+	all := ConversationPermissions{
+		CanRename: true, CanAddParticipant: true, CanRemoveParticipant: true, CanPost: true, CanPin: true,
+	}
+	tests := []struct {
+		name     string
+		settings ConversationSettings
+		want     ConversationPermissions
+	}{
+		{
+			name:     "owner of a read-only group",
+			settings: ConversationSettings{IsGroup: true, ReadOnly: true, User: UserConversationSettings{Role: RoleOwner}},
+			want:     all,
+		},
+		{
+			name:     "member of a group",
+			settings: ConversationSettings{IsGroup: true, User: UserConversationSettings{Role: RoleMember}},
+			want:     ConversationPermissions{CanAddParticipant: true, CanPost: true, CanPin: true},
+		},
+		{
+			name:     "member of a read-only group",
+			settings: ConversationSettings{IsGroup: true, ReadOnly: true, User: UserConversationSettings{Role: RoleMember}},
+			want:     ConversationPermissions{CanAddParticipant: true},
+		},
+		{
+			name:     "1:1 conversation",
+			settings: ConversationSettings{User: UserConversationSettings{Role: RoleMember}},
+			want:     ConversationPermissions{CanPost: true, CanPin: true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.settings.Permissions(); got != tt.want {
+				t.Errorf("Permissions() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
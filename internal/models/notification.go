@@ -0,0 +1,23 @@
+// Package models - notification data structures
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Notification types.
+const (
+	NotificationAddedToConversation = "added_to_conversation"
+	NotificationPasswordReset       = "password_reset"   // By an admin
+	NotificationPasswordChanged     = "password_changed" // By the user themselves
+)
+
+// Notification is a durable message from the server to one user.
+type Notification struct {
+	ID        string          `json:"id"`
+	Type      string          `json:"type"`
+	Payload   json.RawMessage `json:"payload"`
+	CreatedAt time.Time       `json:"created_at"`
+	AckedAt   *time.Time      `json:"acked_at,omitempty"`
+}
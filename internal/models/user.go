@@ -9,11 +9,16 @@ type User struct {
 	// Each field has a name, type, and an optional "tag" (the `json:"..."` part).
 	// Tags tell the JSON encoder what name to use when converting to/from JSON.
 
-	ID           string    `json:"id"`         // Unique identifier
-	Username     string    `json:"username"`   // Display name / login name
-	PasswordHash string    `json:"-"`          // "-" means: never include in JSON output (security!)
-	IsAdmin      bool      `json:"is_admin"`   // Can this user manage other users?
-	CreatedAt    time.Time `json:"created_at"` // When the user was created
+	ID           string     `json:"id"`                     // Unique identifier
+	Username     string     `json:"username"`               // Unique login name
+	DisplayName  string     `json:"display_name"`           // Shown in the UI; defaults to the username
+	PasswordHash string     `json:"-"`                      // "-" means: never include in JSON output (security!)
+	IsAdmin      bool       `json:"is_admin"`               // Can this user manage other users?
+	IsBot        bool       `json:"is_bot"`                 // Automated account (hidden from user lists by default)
+	IsActive     bool       `json:"is_active"`              // False once an admin deactivates the account
+	AvatarURL    string     `json:"avatar_url"`             // Profile picture URL, or "" for none
+	LastSeenAt   *time.Time `json:"last_seen_at,omitempty"` // Last time they were connected; nil if never
+	CreatedAt    time.Time  `json:"created_at"`             // When the user was created
 }
 
 // UserCreateRequest is the data needed to create a new user.
@@ -22,23 +27,53 @@ type UserCreateRequest struct {
 	Username string `json:"username"`
 	Password string `json:"password"` // Plain password - we'll hash it before storing
 	IsAdmin  bool   `json:"is_admin"`
+	IsBot    bool   `json:"is_bot"`
 }
 
 // UserUpdateRequest is the data for updating a user.
 // Password is optional - empty string means don't change it.
 type UserUpdateRequest struct {
+	Username  string  `json:"username"`
+	Password  string  `json:"password"` // Optional: empty = keep current password
+	IsAdmin   bool    `json:"is_admin"`
+	AvatarURL *string `json:"avatar_url"` // Optional: omitted = keep current avatar
+}
+
+// UserActiveRequest is the body of PUT /api/users/{id}/active.
+type UserActiveRequest struct {
+	Active *bool `json:"active"` // Required
+}
+
+// UserAdminRequest is the body of PATCH /api/users/{id}/admin.
+type UserAdminRequest struct {
+	IsAdmin *bool `json:"is_admin"` // Required
+}
+
+// ProfileUpdateRequest is the body of PATCH /api/me.
+// Pointer fields are optional: nil (omitted) means leave unchanged.
+type ProfileUpdateRequest struct {
+	DisplayName *string `json:"display_name"`
+	AvatarURL   *string `json:"avatar_url"` // "" removes the avatar
+}
+
+// UsernameUpdateRequest is the body of PATCH /api/me/username.
+type UsernameUpdateRequest struct {
 	Username string `json:"username"`
-	Password string `json:"password"` // Optional: empty = keep current password
-	IsAdmin  bool   `json:"is_admin"`
 }
 
 // UserResponse is what we send back to the client.
 // Notice: no password field at all - we never send passwords back.
 type UserResponse struct {
-	ID        string    `json:"id"`
-	Username  string    `json:"username"`
-	IsAdmin   bool      `json:"is_admin"`
-	CreatedAt time.Time `json:"created_at"`
+	ID          string     `json:"id"`
+	Username    string     `json:"username"`
+	DisplayName string     `json:"display_name"`
+	IsAdmin     bool       `json:"is_admin"`
+	IsBot       bool       `json:"is_bot"`
+	IsActive    bool       `json:"is_active"`
+	AvatarURL   string     `json:"avatar_url"`
+	LastSeenAt  *time.Time `json:"last_seen_at,omitempty"` // Last time they were connected; show "online" instead while Online
+	CreatedAt   time.Time  `json:"created_at"`
+	Online      bool       `json:"online"` // Has a live WebSocket connection (only filled in by the users list)
 }
 
 // ToResponse converts a User to a UserResponse.
@@ -46,9 +81,14 @@ type UserResponse struct {
 // (u User) means this method can be called on any User value.
 func (u User) ToResponse() UserResponse {
 	return UserResponse{
-		ID:        u.ID,
-		Username:  u.Username,
-		IsAdmin:   u.IsAdmin,
-		CreatedAt: u.CreatedAt,
+		ID:          u.ID,
+		Username:    u.Username,
+		DisplayName: u.DisplayName,
+		IsAdmin:     u.IsAdmin,
+		IsBot:       u.IsBot,
+		IsActive:    u.IsActive,
+		AvatarURL:   u.AvatarURL,
+		LastSeenAt:  u.LastSeenAt,
+		CreatedAt:   u.CreatedAt,
 	}
 }
@@ -0,0 +1,65 @@
+// Package storage handles persisting uploaded files.
+package storage
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Storage persists uploaded files and returns the URL they can be fetched from.
+// Keeping this behind an interface lets us swap the local disk for object
+// storage (S3, GCS, ...) later, and lets tests use an in-memory store.
+type Storage interface {
+	Put(key string, r io.Reader) (url string, err error)
+}
+
+// LocalStorage stores files in a directory on the local disk.
+type LocalStorage struct {
+	// Dir is the directory files are written to.
+	Dir string
+
+	// BaseURL is the URL prefix the directory is served under, e.g. "/uploads".
+	BaseURL string
+}
+
+// NewLocalStorage creates a LocalStorage, making sure the directory exists.
+func NewLocalStorage(dir, baseURL string) (*LocalStorage, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create upload directory: %w", err)
+	}
+	return &LocalStorage{Dir: dir, BaseURL: strings.TrimSuffix(baseURL, "/")}, nil
+}
+
+// Put writes the contents of r to a file named key.
+func (s *LocalStorage) Put(key string, r io.Reader) (string, error) {
+	// Never let a key escape the upload directory.
+	if key != filepath.Base(key) {
+		return "", fmt.Errorf("invalid storage key: %q", key)
+	}
+
+	f, err := os.Create(filepath.Join(s.Dir, key))
+	if err != nil {
+		return "", fmt.Errorf("failed to create file: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(f, r); err != nil {
+		return "", fmt.Errorf("failed to write file: %w", err)
+	}
+
+	return s.BaseURL + "/" + key, nil
+}
+
+// newKey returns a random hex string used to name stored files.
+func newKey() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate key: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,162 @@
+// Package storage - upload processing and image thumbnails
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif" // Register the GIF decoder with image.Decode.
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"chatgo/internal/models"
+)
+
+// ThumbnailSize is the maximum width/height of a generated thumbnail.
+const ThumbnailSize = 256
+
+// MaxImagePixels is the largest image (width × height) SaveUpload will accept.
+// Decoding allocates about 4 bytes per pixel whatever the file size, so a
+// small, highly compressed file could otherwise exhaust memory.
+var MaxImagePixels = 50_000_000
+
+// ErrImageTooLarge is returned by SaveUpload for images over MaxImagePixels.
+var ErrImageTooLarge = errors.New("image dimensions too large")
+
+// SaveUpload stores an uploaded file and returns its attachment metadata.
+// For images (PNG, JPEG, GIF) it also records the dimensions and stores a
+// small thumbnail next to the original. Other files are stored as-is.
+// Images larger than MaxImagePixels are rejected with ErrImageTooLarge.
+func SaveUpload(store Storage, filename string, data []byte) (*models.Attachment, error) {
+	key, err := newKey()
+	if err != nil {
+		return nil, err
+	}
+
+	mimeType := http.DetectContentType(data)
+	ext := safeExt(filename)
+
+	// Read just the header first: the pixel count decides whether decoding is safe.
+	decodable := false
+	if isImage(mimeType) {
+		if cfg, _, err := image.DecodeConfig(bytes.NewReader(data)); err == nil {
+			if int64(cfg.Width)*int64(cfg.Height) > int64(MaxImagePixels) {
+				return nil, ErrImageTooLarge
+			}
+			decodable = true
+		}
+	}
+
+	url, err := store.Put(key+ext, bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to store upload: %w", err)
+	}
+
+	attachment := &models.Attachment{
+		URL:      url,
+		Filename: filepath.Base(filename),
+		MimeType: mimeType,
+		Size:     int64(len(data)),
+	}
+
+	// Not an image, or one whose header doesn't parse: no preview.
+	if !decodable {
+		return attachment, nil
+	}
+
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		// The content sniffed as an image but doesn't decode - keep the
+		// upload, just without preview metadata.
+		return attachment, nil
+	}
+
+	bounds := img.Bounds()
+	attachment.Width = bounds.Dx()
+	attachment.Height = bounds.Dy()
+
+	var thumb bytes.Buffer
+	thumbExt, err := encodeThumbnail(&thumb, resize(img, ThumbnailSize), format)
+	if err != nil {
+		return nil, err
+	}
+
+	thumbURL, err := store.Put(key+"_thumb"+thumbExt, &thumb)
+	if err != nil {
+		return nil, fmt.Errorf("failed to store thumbnail: %w", err)
+	}
+	attachment.ThumbnailURL = thumbURL
+
+	return attachment, nil
+}
+
+// safeExt returns the lowercased extension of filename, or "" if it contains
+// anything other than letters and digits (the client controls this value).
+func safeExt(filename string) string {
+	ext := strings.ToLower(filepath.Ext(filename))
+	if len(ext) < 2 || len(ext) > 10 {
+		return ""
+	}
+	for _, r := range ext[1:] {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') {
+			return ""
+		}
+	}
+	return ext
+}
+
+// isImage reports whether we know how to thumbnail the given mime type.
+func isImage(mimeType string) bool {
+	switch mimeType {
+	case "image/png", "image/jpeg", "image/gif":
+		return true
+	}
+	return false
+}
+
+// encodeThumbnail writes the thumbnail in a format matching the original.
+// JPEGs stay JPEG (smaller for photos), everything else becomes PNG.
+func encodeThumbnail(buf *bytes.Buffer, img image.Image, format string) (string, error) {
+	if format == "jpeg" {
+		if err := jpeg.Encode(buf, img, &jpeg.Options{Quality: 80}); err != nil {
+			return "", fmt.Errorf("failed to encode thumbnail: %w", err)
+		}
+		return ".jpg", nil
+	}
+
+	if err := png.Encode(buf, img); err != nil {
+		return "", fmt.Errorf("failed to encode thumbnail: %w", err)
+	}
+	return ".png", nil
+}
+
+// resize scales img so that neither side exceeds maxSize, keeping the aspect
+// ratio. Uses nearest-neighbor sampling, which is plenty for small previews.
+func resize(img image.Image, maxSize int) image.Image {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width <= maxSize && height <= maxSize {
+		return img
+	}
+
+	newWidth, newHeight := maxSize, maxSize
+	if width > height {
+		newHeight = max(1, height*maxSize/width)
+	} else {
+		newWidth = max(1, width*maxSize/height)
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, newWidth, newHeight))
+	for y := 0; y < newHeight; y++ {
+		srcY := bounds.Min.Y + y*height/newHeight
+		for x := 0; x < newWidth; x++ {
+			srcX := bounds.Min.X + x*width/newWidth
+			dst.Set(x, y, img.At(srcX, srcY))
+		}
+	}
+	return dst
+}
@@ -0,0 +1,126 @@
+package storage
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"strings"
+	"testing"
+)
+
+// memoryStorage is an in-memory Storage.
+type memoryStorage struct {
+	files map[string][]byte
+}
+
+func newMemoryStorage() *memoryStorage {
+	return &memoryStorage{files: make(map[string][]byte)}
+}
+
+func (s *memoryStorage) Put(key string, r io.Reader) (string, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+	s.files[key] = data
+	return "/uploads/" + key, nil
+}
+
+// read returns the file stored under url.
+func (s *memoryStorage) read(t *testing.T, url string) []byte {
+	t.Helper()
+	data, ok := s.files[strings.TrimPrefix(url, "/uploads/")]
+	if !ok {
+		t.Fatalf("nothing stored at %s", url)
+	}
+	return data
+}
+
+// pngImage encodes a solid width×height PNG.
+func pngImage(t *testing.T, width, height int) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := range height {
+		for x := range width {
+			img.Set(x, y, color.RGBA{R: 200, A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("png.Encode: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestSaveUploadImageGetsDimensionsAndThumbnail(t *testing.T) {
+	store := newMemoryStorage()
+
+	a, err := SaveUpload(store, "photo.PNG", pngImage(t, 600, 300))
+	if err != nil {
+		t.Fatalf("SaveUpload: %v", err)
+	}
+	if a.MimeType != "image/png" || !strings.HasSuffix(a.URL, ".png") {
+		t.Errorf("got mime %q, url %q; want a .png image/png", a.MimeType, a.URL)
+	}
+	if a.Width != 600 || a.Height != 300 {
+		t.Errorf("dimensions = %dx%d, want 600x300", a.Width, a.Height)
+	}
+	if a.ThumbnailURL == "" {
+		t.Fatal("no thumbnail stored")
+	}
+
+	thumb, err := png.DecodeConfig(bytes.NewReader(store.read(t, a.ThumbnailURL)))
+	if err != nil {
+		t.Fatalf("thumbnail doesn't decode: %v", err)
+	}
+	if thumb.Width != ThumbnailSize || thumb.Height != ThumbnailSize/2 {
+		t.Errorf("thumbnail = %dx%d, want %dx%d", thumb.Width, thumb.Height, ThumbnailSize, ThumbnailSize/2)
+	}
+}
+
+func TestSaveUploadNonImageIsStoredAsIs(t *testing.T) {
+	store := newMemoryStorage()
+	data := []byte("just some notes\n")
+
+	a, err := SaveUpload(store, "notes.txt", data)
+	if err != nil {
+		t.Fatalf("SaveUpload: %v", err)
+	}
+	if a.Width != 0 || a.Height != 0 || a.ThumbnailURL != "" {
+		t.Errorf("text upload got preview metadata: %+v", a)
+	}
+	if len(store.files) != 1 || !bytes.Equal(store.read(t, a.URL), data) {
+		t.Errorf("want just the original stored, got %d files", len(store.files))
+	}
+}
+
+func TestSaveUploadRejectsOversizedImageBeforeDecoding(t *testing.T) {
+	saved := MaxImagePixels
+	MaxImagePixels = 100 * 100
+	defer func() { MaxImagePixels = saved }()
+
+	store := newMemoryStorage()
+	if _, err := SaveUpload(store, "big.png", pngImage(t, 200, 100)); err != ErrImageTooLarge {
+		t.Fatalf("err = %v, want ErrImageTooLarge", err)
+	}
+	if len(store.files) != 0 {
+		t.Errorf("rejected upload left %d files behind", len(store.files))
+	}
+}
+
+func TestSaveUploadSafeExtension(t *testing.T) {
+	tests := map[string]string{
+		"a.JPG":         ".jpg",
+		"archive.tar":   ".tar",
+		"evil.p/hp":     "",
+		"noext":         "",
+		"x.verylongext": "",
+	}
+	for name, want := range tests {
+		if got := safeExt(name); got != want {
+			t.Errorf("safeExt(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+// Package websocket - send acknowledgements for chat messages
+package websocket
+
+import "time"
+
+// AckMessage tells the sender that their message was saved.
+type AckMessage struct {
+	Type        string `json:"type"` // "ack"
+	ClientMsgID string `json:"client_msg_id"`
+	MessageID   string `json:"message_id"`
+	Seq         int64  `json:"seq"`
+	CreatedAt   string `json:"created_at"`
+}
+
+// NackMessage tells the sender that their message was NOT saved, and why,
+// so the UI can offer a retry.
+type NackMessage struct {
+	Type        string `json:"type"` // "nack"
+	ClientMsgID string `json:"client_msg_id"`
+	Error       string `json:"error"`
+}
+
+// sendAck acknowledges a saved message to this client's user.
+// Clients that didn't send a client_msg_id get no ack.
+func (c *Client) sendAck(clientMsgID, messageID string, seq int64, createdAt time.Time) {
+	if clientMsgID == "" {
+		return
+	}
+	c.hub.SendToUser(c.UserID, AckMessage{
+		Type:        "ack",
+		ClientMsgID: clientMsgID,
+		MessageID:   messageID,
+		Seq:         seq,
+		CreatedAt:   createdAt.UTC().Format(time.RFC3339),
+	})
+}
+
+// sendNack reports a rejected or failed message to this client's user.
+// Clients that didn't send a client_msg_id get no nack.
+func (c *Client) sendNack(clientMsgID, reason string) {
+	if clientMsgID == "" {
+		return
+	}
+	c.hub.SendToUser(c.UserID, NackMessage{
+		Type:        "nack",
+		ClientMsgID: clientMsgID,
+		Error:       reason,
+	})
+}
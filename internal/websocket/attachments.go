@@ -0,0 +1,79 @@
+// Package websocket - validation of message attachments
+package websocket
+
+import (
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	"chatgo/internal/models"
+)
+
+const (
+	// Most attachments one message may carry.
+	maxAttachments = 10
+
+	// Largest attachment size we accept, in bytes. Matches api.MaxUploadSize.
+	maxAttachmentSize = 10 << 20
+
+	// Longest attachment filename we store.
+	maxAttachmentFilename = 255
+)
+
+// allowedAttachmentTypes are the mime types (or "type/" families) clients may attach.
+var allowedAttachmentTypes = []string{
+	"image/",
+	"video/",
+	"audio/",
+	"text/plain",
+	"application/pdf",
+	"application/zip",
+	"application/octet-stream",
+}
+
+// validateAttachment checks one attachment's metadata. The file itself was
+// uploaded out of band, so all we can check is what the client claims.
+// Returns a description of the problem, or "" if it's acceptable.
+func validateAttachment(a models.Attachment) string {
+	u, err := url.Parse(a.URL)
+	if a.URL == "" || err != nil {
+		return "attachment url is invalid"
+	}
+	// Absolute http(s) URLs for object storage, or a path on this server (local uploads).
+	if u.Scheme != "http" && u.Scheme != "https" && !(u.Scheme == "" && u.Host == "" && strings.HasPrefix(u.Path, "/")) {
+		return "attachment url must be http(s) or a server path"
+	}
+
+	if a.Filename == "" || len(a.Filename) > maxAttachmentFilename || filepath.Base(a.Filename) != a.Filename {
+		return "attachment filename is invalid"
+	}
+
+	if a.Size <= 0 || a.Size > maxAttachmentSize {
+		return fmt.Sprintf("attachment size must be between 1 and %d bytes", maxAttachmentSize)
+	}
+
+	mimeType := strings.ToLower(a.MimeType)
+	for _, allowed := range allowedAttachmentTypes {
+		if mimeType == allowed || (strings.HasSuffix(allowed, "/") && strings.HasPrefix(mimeType, allowed)) {
+			return ""
+		}
+	}
+	return fmt.Sprintf("attachment type %q is not allowed", a.MimeType)
+}
+
+// checkAttachments validates a message's attachments. Returns false (after
+// rejecting the frame with rejectMessage) if any is unacceptable.
+func (c *Client) checkAttachments(attachments []models.Attachment, clientMsgID string) bool {
+	if len(attachments) > maxAttachments {
+		c.rejectMessage(clientMsgID, ErrCodeInvalidAttachment, fmt.Sprintf("at most %d attachments per message", maxAttachments))
+		return false
+	}
+	for _, a := range attachments {
+		if problem := validateAttachment(a); problem != "" {
+			c.rejectMessage(clientMsgID, ErrCodeInvalidAttachment, problem)
+			return false
+		}
+	}
+	return true
+}
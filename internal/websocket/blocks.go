@@ -0,0 +1,28 @@
+// Package websocket - keeping blocked users apart
+package websocket
+
+import (
+	"log"
+
+	"chatgo/internal/db"
+)
+
+// blockedBy returns the IDs of the users who have blocked this client's user.
+// They don't receive this user's messages. On error nobody is left out.
+func (c *Client) blockedBy() []string {
+	ids, err := db.GetBlockerIDs(c.UserID)
+	if err != nil {
+		log.Printf("Failed to get users blocking %s: %v", c.UserID, err)
+	}
+	return ids
+}
+
+// blocking returns the IDs of the users this client's user has blocked.
+// They don't receive this user's typing events. On error nobody is left out.
+func (c *Client) blocking() []string {
+	ids, err := db.GetBlockedIDs(c.UserID)
+	if err != nil {
+		log.Printf("Failed to get users blocked by %s: %v", c.UserID, err)
+	}
+	return ids
+}
@@ -0,0 +1,44 @@
+package websocket
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBlockedSenderIsLeftOutOfLiveDelivery(t *testing.T) {
+	chat := newFakeChat(t)
+	chat.addConversation("group-1", "alice", "bob", "carol")
+	chat.block("bob", "alice")
+	hub, srv := startHub(t, Config{})
+
+	alice := dial(t, hub, srv, "alice")
+	bob := dial(t, hub, srv, "bob")
+	carol := dial(t, hub, srv, "carol")
+
+	alice.send(IncomingMessage{Type: "message", ConversationID: "group-1", Content: "hello", ClientMsgID: "c1"})
+
+	// Alice can't tell: she gets her ack and her own copy as usual.
+	if ack := alice.next("ack", "nack"); ack.Type != "ack" {
+		t.Errorf("sender got %s, want ack", ack.Type)
+	}
+	expectMessage(t, map[string]*testConn{"alice": alice, "carol": carol}, "hello")
+	bob.expectNone(300*time.Millisecond, "message")
+}
+
+func TestBlockedUsersDontSeeTheBlockersTyping(t *testing.T) {
+	chat := newFakeChat(t)
+	chat.addConversation("group-1", "alice", "bob", "carol")
+	chat.block("alice", "bob")
+	hub, srv := startHub(t, Config{})
+
+	alice := dial(t, hub, srv, "alice")
+	bob := dial(t, hub, srv, "bob")
+	carol := dial(t, hub, srv, "carol")
+
+	alice.send(IncomingMessage{Type: "typing", ConversationID: "group-1", IsTyping: true})
+
+	if f := carol.next("typing"); f.UserID != "alice" || !f.IsTyping {
+		t.Errorf("carol got %+v, want alice typing", f)
+	}
+	bob.expectNone(300*time.Millisecond, "typing")
+}
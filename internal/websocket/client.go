@@ -3,6 +3,7 @@ package websocket
 
 import (
 	"encoding/json"
+	"fmt"
 	"log"
 	"sync"
 	"time"
@@ -10,22 +11,32 @@ import (
 	"github.com/gorilla/websocket"
 
 	"chatgo/internal/db"
+	"chatgo/internal/models"
 )
 
+// Keepalive timeouts and the frame size limit come from the hub's Config.
 const (
-	// Time allowed to write a message to the peer.
-	writeWait = 10 * time.Second
-
-	// Time allowed to read the next pong message from the peer.
-	pongWait = 60 * time.Second
-
-	// Send pings to peer with this period. Must be less than pongWait.
-	pingPeriod = (pongWait * 9) / 10
-
-	// Maximum message size allowed from peer.
-	maxMessageSize = 4096
+	// A client shown as typing is shown as stopped if it sends no typing
+	// event for this long, in case its "stopped" event never arrives.
+	// Clients that keep typing should repeat is_typing:true more often.
+	typingTimeout = 10 * time.Second
+
+	// Per-connection rate limits for incoming frames: a steady rate per
+	// second plus a burst allowance. Typing events are frequent by nature,
+	// so they get their own, looser bucket.
+	messageRateLimit = 5
+	messageBurst     = 10
+	typingRateLimit  = 10
+	typingBurst      = 20
+
+	// Longest lifetime a sender may give an ephemeral message.
+	maxMessageLifetime = 7 * 24 * time.Hour
 )
 
+// MaxContentLength is the longest message content, in bytes, that will be stored.
+// Override at startup (e.g. from CHATGO_MAX_MESSAGE_LENGTH).
+var MaxContentLength = 4000
+
 // Client represents a single WebSocket connection.
 type Client struct {
 	hub *Hub
@@ -42,25 +53,134 @@ type Client struct {
 
 	// closeOnce ensures we only close the send channel once.
 	closeOnce sync.Once
+
+	// The close frame the write pump sends once send is closed.
+	// Zero closeCode sends an empty close frame. Set only inside closeOnce.
+	closeCode   int
+	closeReason string
+
+	// tokenMutex protects the token expiry, which a "reauth" frame extends.
+	// See Hub for the order locks must be taken in.
+	tokenMutex      sync.Mutex
+	tokenExpiry     time.Time // Zero means the token never expires
+	reauthRequested bool
+
+	// typingMutex protects typing and closed: throttle timers run on their own goroutines.
+	typingMutex sync.Mutex
+	typing      map[string]*typingThrottle // Keyed by conversation ID
+	closed      bool
+
+	// Incoming frame rate limits. Only used by ReadPump, so no lock needed.
+	messageLimiter *tokenBucket
+	typingLimiter  *tokenBucket
+}
+
+// tokenBucket is a simple token-bucket rate limiter. It holds up to burst
+// tokens and refills at rate tokens per second; each allowed event takes one.
+// It is not safe for concurrent use.
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// newTokenBucket returns a full bucket.
+func newTokenBucket(rate, burst float64) *tokenBucket {
+	return &tokenBucket{rate: rate, burst: burst, tokens: burst, last: time.Now()}
+}
+
+// allow takes a token if one is available.
+func (b *tokenBucket) allow() bool {
+	now := time.Now()
+	b.tokens = min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
 }
 
 // IncomingMessage is the format of messages from the client.
 type IncomingMessage struct {
-	Type           string `json:"type"`            // "message" or "typing"
+	Type           string `json:"type"`            // "message", "typing", "edit", "read", "sync" or "reauth"
 	ConversationID string `json:"conversation_id"` // Target conversation
-	Content        string `json:"content"`         // Message content (for "message" type)
+	Content        string `json:"content"`         // Message content (for "message" and "edit" types)
 	IsTyping       bool   `json:"is_typing"`       // Typing status (for "typing" type)
+
+	// Optional expiry for ephemeral messages (for "message" type).
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+
+	// Message being edited (for "edit" type), or the last message read (for "read" type).
+	MessageID string `json:"message_id,omitempty"`
+
+	// Files attached to the message, already uploaded (for "message" type).
+	Attachments []models.Attachment `json:"attachments,omitempty"`
+
+	// Optional message being replied to, in the same conversation (for "message" type).
+	ReplyToID *string `json:"reply_to_id,omitempty"`
+
+	// Optional client-chosen ID, echoed back in the "ack"/"nack" reply to a
+	// "message" and as the ref of any "error" reply to this frame.
+	ClientMsgID string `json:"client_msg_id,omitempty"`
+
+	// Newest message the client already has (for "sync" type).
+	LastSeenMessageID string `json:"last_seen_message_id,omitempty"`
+
+	// Or, per conversation ID, the highest seq the client already has (for "sync" type).
+	LastSeenSeqs map[string]int64 `json:"last_seen_seqs,omitempty"`
+
+	// Fresh access token (for "reauth" type).
+	Token string `json:"token,omitempty"`
 }
 
 // ChatMessage is sent when a new message is created.
 type ChatMessage struct {
-	Type           string `json:"type"` // "message"
-	ID             string `json:"id"`
-	ConversationID string `json:"conversation_id"`
-	SenderID       string `json:"sender_id"`
-	SenderUsername string `json:"sender_username"`
-	Content        string `json:"content"`
-	CreatedAt      string `json:"created_at"`
+	Type              string                 `json:"type"` // "message"
+	ID                string                 `json:"id"`
+	ConversationID    string                 `json:"conversation_id"`
+	SenderID          string                 `json:"sender_id"`
+	SenderUsername    string                 `json:"sender_username"`
+	SenderDisplayName string                 `json:"sender_display_name"`
+	SenderAvatarURL   string                 `json:"sender_avatar_url,omitempty"`
+	Content           string                 `json:"content"`
+	Seq               int64                  `json:"seq"`
+	IsSystem          bool                   `json:"is_system,omitempty"`
+	ExpiresAt         string                 `json:"expires_at,omitempty"`
+	EditedAt          string                 `json:"edited_at,omitempty"`
+	CreatedAt         string                 `json:"created_at"`
+	Attachments       []models.Attachment    `json:"attachments,omitempty"`
+	ReplyToID         *string                `json:"reply_to_id,omitempty"`
+	ReplyTo           *models.MessagePreview `json:"reply_to,omitempty"`
+}
+
+// newChatMessage builds the outgoing form of a saved message.
+func newChatMessage(m *models.Message) ChatMessage {
+	chatMsg := ChatMessage{
+		Type:              "message",
+		ID:                m.ID,
+		ConversationID:    m.ConversationID,
+		SenderID:          m.SenderID,
+		SenderUsername:    m.SenderUsername,
+		SenderDisplayName: m.SenderDisplayName,
+		SenderAvatarURL:   m.SenderAvatarURL,
+		Content:           m.Content,
+		Seq:               m.Seq,
+		IsSystem:          m.IsSystem,
+		CreatedAt:         m.CreatedAt.UTC().Format(time.RFC3339),
+		Attachments:       m.Attachments,
+		ReplyToID:         m.ReplyToID,
+		ReplyTo:           m.ReplyTo,
+	}
+	if m.ExpiresAt != nil {
+		chatMsg.ExpiresAt = m.ExpiresAt.UTC().Format(time.RFC3339)
+	}
+	if m.EditedAt != nil {
+		chatMsg.EditedAt = m.EditedAt.UTC().Format(time.RFC3339)
+	}
+	return chatMsg
 }
 
 // TypingMessage is sent when a user starts/stops typing.
@@ -73,36 +193,60 @@ type TypingMessage struct {
 }
 
 // NewClient creates a new client instance.
-func NewClient(hub *Hub, conn *websocket.Conn, userID, username string) *Client {
+// tokenExpiry is when the token used to connect expires (zero for never).
+func NewClient(hub *Hub, conn *websocket.Conn, userID, username string, tokenExpiry time.Time) *Client {
 	return &Client{
-		hub:      hub,
-		conn:     conn,
-		send:     make(chan []byte, 256),
-		UserID:   userID,
-		Username: username,
+		hub:         hub,
+		conn:        conn,
+		send:        make(chan []byte, 256),
+		UserID:      userID,
+		Username:    username,
+		tokenExpiry: tokenExpiry,
+		typing:      make(map[string]*typingThrottle),
+
+		messageLimiter: newTokenBucket(messageRateLimit, messageBurst),
+		typingLimiter:  newTokenBucket(typingRateLimit, typingBurst),
 	}
 }
 
 // Close safely closes the client's send channel (only once).
 func (c *Client) Close() {
+	c.closeWith(0, "")
+}
+
+// closeWith is like Close, but the peer gets a close frame with this code
+// and reason. Only the first close of a client takes effect.
+func (c *Client) closeWith(code int, reason string) {
 	c.closeOnce.Do(func() {
 		log.Printf("Closing send channel for client: %s", c.UserID)
+		c.closeCode = code
+		c.closeReason = reason
+		c.stopTyping()
 		close(c.send)
 	})
 }
 
+// isClosed reports whether the client has been closed.
+func (c *Client) isClosed() bool {
+	c.typingMutex.Lock()
+	defer c.typingMutex.Unlock()
+	return c.closed
+}
+
 // ReadPump pumps messages from the WebSocket connection to the hub.
 // Runs in its own goroutine.
 func (c *Client) ReadPump() {
 	defer func() {
+		// Don't leave a "typing..." indicator behind for a closed connection.
+		c.clearAllTyping()
 		c.hub.unregister <- c
 		c.conn.Close()
 	}()
 
-	c.conn.SetReadLimit(maxMessageSize)
-	c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	c.conn.SetReadLimit(c.hub.config.MaxMessageSize)
+	c.conn.SetReadDeadline(time.Now().Add(c.hub.config.PongWait))
 	c.conn.SetPongHandler(func(string) error {
-		c.conn.SetReadDeadline(time.Now().Add(pongWait))
+		c.conn.SetReadDeadline(time.Now().Add(c.hub.config.PongWait))
 		return nil
 	})
 
@@ -115,10 +259,31 @@ func (c *Client) ReadPump() {
 			break
 		}
 
+		// A client the hub has closed (e.g. by Hub.DisconnectUser) can still
+		// have frames in flight until the write pump closes the connection.
+		// They're dropped rather than acted on under a revoked session.
+		if c.isClosed() {
+			continue
+		}
+
 		// Parse the incoming message.
 		var msg IncomingMessage
 		if err := json.Unmarshal(data, &msg); err != nil {
 			log.Printf("Invalid message format: %v", err)
+			c.sendError(ErrCodeInvalidRequest, "invalid message format", "")
+			continue
+		}
+
+		// Drop frames over the rate limit before they reach the database.
+		// Typing events are dropped quietly; anything else gets an error
+		// so the client knows to slow down (and can retry).
+		if msg.Type == "typing" {
+			if !c.typingLimiter.allow() {
+				continue
+			}
+		} else if !c.messageLimiter.allow() {
+			log.Printf("Rate limited %s: dropped %q frame", c.UserID, msg.Type)
+			c.sendError(ErrCodeRateLimited, "sending too fast, slow down", msg.ClientMsgID)
 			continue
 		}
 
@@ -128,8 +293,17 @@ func (c *Client) ReadPump() {
 			c.handleChatMessage(msg)
 		case "typing":
 			c.handleTypingMessage(msg)
+		case "edit":
+			c.handleEditMessage(msg)
+		case "read":
+			c.handleReadMessage(msg)
+		case "sync":
+			c.handleSync(msg)
+		case "reauth":
+			c.handleReauth(msg)
 		default:
 			log.Printf("Unknown message type: %s", msg.Type)
+			c.sendError(ErrCodeInvalidRequest, fmt.Sprintf("unknown message type %q", msg.Type), msg.ClientMsgID)
 		}
 	}
 }
@@ -137,98 +311,121 @@ func (c *Client) ReadPump() {
 // WritePump pumps messages from the hub to the WebSocket connection.
 // Runs in its own goroutine.
 func (c *Client) WritePump() {
-	ticker := time.NewTicker(pingPeriod)
+	ticker := time.NewTicker(c.hub.config.PingPeriod)
+	tokenTicker := time.NewTicker(c.hub.config.TokenCheckPeriod)
+	lastSeenTicker := time.NewTicker(lastSeenInterval)
 	defer func() {
 		ticker.Stop()
+		tokenTicker.Stop()
+		lastSeenTicker.Stop()
 		c.conn.Close()
 	}()
 
 	for {
 		select {
 		case message, ok := <-c.send:
-			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			c.conn.SetWriteDeadline(time.Now().Add(c.hub.config.WriteWait))
 			if !ok {
 				// The hub closed the channel.
-				c.conn.WriteMessage(websocket.CloseMessage, []byte{})
+				closeMsg := []byte{}
+				if c.closeCode != 0 {
+					closeMsg = websocket.FormatCloseMessage(c.closeCode, c.closeReason)
+				}
+				c.conn.WriteMessage(websocket.CloseMessage, closeMsg)
 				return
 			}
 
 			if err := c.conn.WriteMessage(websocket.TextMessage, message); err != nil {
 				return
 			}
+			payloadBytes.Add(uint64(len(message)))
 
 		case <-ticker.C:
-			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			c.conn.SetWriteDeadline(time.Now().Add(c.hub.config.WriteWait))
 			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
 				return
 			}
+
+		case <-tokenTicker.C:
+			if !c.checkTokenExpiry() {
+				return
+			}
+
+		case <-lastSeenTicker.C:
+			go recordLastSeen(c.UserID)
 		}
 	}
 }
 
 // handleChatMessage processes an incoming chat message.
 func (c *Client) handleChatMessage(msg IncomingMessage) {
-	// Verify user is in this conversation.
-	isParticipant, err := db.IsUserInConversation(c.UserID, msg.ConversationID)
-	if err != nil || !isParticipant {
+	if !c.checkContent(msg.Content, msg.ClientMsgID, len(msg.Attachments) > 0) {
+		return
+	}
+	if !c.checkAttachments(msg.Attachments, msg.ClientMsgID) {
+		return
+	}
+
+	// Verify user is in this conversation and allowed to post in it.
+	settings, err := db.GetConversationSettings(msg.ConversationID, c.UserID)
+	if err != nil || settings == nil {
 		log.Printf("User %s not in conversation %s", c.UserID, msg.ConversationID)
+		c.rejectMessage(msg.ClientMsgID, ErrCodeNotParticipant, "not a participant in this conversation")
+		return
+	}
+	if !settings.Permissions().CanPost {
+		log.Printf("User %s may not post in read-only conversation %s", c.UserID, msg.ConversationID)
+		c.rejectMessage(msg.ClientMsgID, ErrCodeReadOnly, "conversation is read-only")
 		return
 	}
 
+	// Ephemeral messages must expire in the future, within the allowed lifetime.
+	if msg.ExpiresAt != nil {
+		lifetime := time.Until(*msg.ExpiresAt)
+		if lifetime <= 0 || lifetime > maxMessageLifetime {
+			log.Printf("User %s sent message with invalid expires_at %v", c.UserID, msg.ExpiresAt)
+			c.rejectMessage(msg.ClientMsgID, ErrCodeInvalidRequest, "invalid expires_at")
+			return
+		}
+	}
+
+	// Hold the conversation lock until the message is queued for everyone,
+	// so concurrent senders can't be fanned out in a different order than their seq.
+	unlock := c.hub.lockConversation(msg.ConversationID)
+	defer unlock()
+
 	// Save message to database.
-	savedMsg, err := db.CreateMessage(msg.ConversationID, c.UserID, msg.Content)
+	savedMsg, err := db.CreateMessage(msg.ConversationID, c.UserID, msg.Content, msg.ExpiresAt, msg.Attachments, msg.ReplyToID)
+	if err == db.ErrInvalidReplyTo {
+		log.Printf("User %s replied to unknown message %s in %s", c.UserID, *msg.ReplyToID, msg.ConversationID)
+		c.rejectMessage(msg.ClientMsgID, ErrCodeInvalidRequest, "invalid reply_to_id")
+		return
+	}
 	if err != nil {
 		log.Printf("Failed to save message: %v", err)
+		c.rejectMessage(msg.ClientMsgID, ErrCodeInternal, "failed to save message")
 		return
 	}
 
-	// Create the outgoing message.
-	chatMsg := ChatMessage{
-		Type:           "message",
-		ID:             savedMsg.ID,
-		ConversationID: savedMsg.ConversationID,
-		SenderID:       savedMsg.SenderID,
-		SenderUsername: c.Username,
-		Content:        savedMsg.Content,
-		CreatedAt:      savedMsg.CreatedAt.Format(time.RFC3339),
-	}
+	// Tell the sender it's saved before fanning out, so the ack never
+	// trails the broadcast copy of the same message.
+	c.sendAck(msg.ClientMsgID, savedMsg.ID, savedMsg.Seq, savedMsg.CreatedAt)
 
-	// Send to all participants in the conversation.
-	c.sendToConversationParticipants(msg.ConversationID, chatMsg)
+	// Send to all participants, including self so the message appears in the
+	// sender's chat, except those who blocked the sender. The sender still
+	// gets a normal ack, so the block isn't revealed.
+	c.sendToConversationParticipants(msg.ConversationID, savedMsg.ID, newChatMessage(savedMsg), c.blockedBy())
 }
 
 // handleTypingMessage processes a typing indicator.
+// Broadcasts are throttled per conversation (see throttleTyping).
 func (c *Client) handleTypingMessage(msg IncomingMessage) {
-	// Verify user is in this conversation.
-	isParticipant, err := db.IsUserInConversation(c.UserID, msg.ConversationID)
-	if err != nil || !isParticipant {
-		return
-	}
-
-	// Create typing notification.
-	typingMsg := TypingMessage{
-		Type:           "typing",
-		ConversationID: msg.ConversationID,
-		UserID:         c.UserID,
-		Username:       c.Username,
-		IsTyping:       msg.IsTyping,
-	}
-
-	// Send to all other participants.
-	c.sendToConversationParticipants(msg.ConversationID, typingMsg)
+	c.throttleTyping(msg.ConversationID, msg.IsTyping)
 }
 
-// sendToConversationParticipants sends a message to all users in a conversation.
-func (c *Client) sendToConversationParticipants(conversationID string, message interface{}) {
-	// Get all participants in this conversation.
-	participants, err := db.GetConversationParticipants(conversationID)
-	if err != nil {
-		log.Printf("Failed to get conversation participants: %v", err)
-		return
-	}
-
-	// Send to all participants (including self so message appears in sender's chat).
-	for _, p := range participants {
-		c.hub.SendToUser(p.ID, message)
-	}
+// sendToConversationParticipants sends a message to every participant of a
+// conversation, 1:1 or group. If messageID is set, the delivery outcome per
+// participant is recorded. Participants whose IDs are in exclude are skipped.
+func (c *Client) sendToConversationParticipants(conversationID, messageID string, message interface{}, exclude []string) {
+	c.hub.sendToConversationExcept(conversationID, exclude, messageID, message)
 }
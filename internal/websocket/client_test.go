@@ -0,0 +1,170 @@
+package websocket
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"chatgo/internal/models"
+)
+
+// collectMessages reads n chat messages from each connection concurrently
+// and returns their seqs, per connection, in arrival order.
+func collectMessages(t *testing.T, conns map[string]*testConn, n int) map[string][]int64 {
+	t.Helper()
+	var mutex sync.Mutex
+	seqs := make(map[string][]int64)
+	var wg sync.WaitGroup
+	for userID, conn := range conns {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range n {
+				f, ok := conn.readType(FrameTimeout, "message")
+				if !ok {
+					t.Errorf("%s got only %d of %d messages", userID, len(seqs[userID]), n)
+					return
+				}
+				mutex.Lock()
+				seqs[userID] = append(seqs[userID], f.Seq)
+				mutex.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	return seqs
+}
+
+func TestConcurrentSendersAreSeenInSeqOrder(t *testing.T) {
+	chat := newFakeChat(t)
+	users := []string{"s0", "s1", "s2", "s3", "listener"}
+	chat.addConversation("conv-1", users...)
+	hub, srv := startHub(t, Config{})
+
+	conns := make(map[string]*testConn)
+	for _, u := range users {
+		conns[u] = dial(t, hub, srv, u)
+	}
+
+	// Stay under the per-connection burst, so nothing is rate limited.
+	const perSender = messageBurst - 2
+	senders := users[:4]
+	var wg sync.WaitGroup
+	for _, u := range senders {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range perSender {
+				conns[u].conn.WriteJSON(IncomingMessage{
+					Type:           "message",
+					ConversationID: "conv-1",
+					Content:        fmt.Sprintf("%s #%d", u, i),
+				})
+			}
+		}()
+	}
+	wg.Wait()
+
+	total := perSender * len(senders)
+	for userID, seqs := range collectMessages(t, conns, total) {
+		for i, seq := range seqs {
+			if seq != int64(i+1) {
+				t.Errorf("%s: message %d has seq %d; order was %v", userID, i, seq, seqs)
+				break
+			}
+		}
+	}
+}
+
+// expectMessage checks that every connection gets a chat message with content.
+func expectMessage(t *testing.T, conns map[string]*testConn, content string) {
+	t.Helper()
+	for userID, conn := range conns {
+		f := conn.next("message")
+		if f.Content != content {
+			t.Errorf("%s got %q, want %q", userID, f.Content, content)
+		}
+	}
+}
+
+func TestGroupMessageReachesEveryMember(t *testing.T) {
+	chat := newFakeChat(t)
+	chat.addConversation("group-1", "alice", "bob", "carol")
+	hub, srv := startHub(t, Config{})
+
+	conns := map[string]*testConn{
+		"alice": dial(t, hub, srv, "alice"),
+		"bob":   dial(t, hub, srv, "bob"),
+		"carol": dial(t, hub, srv, "carol"),
+	}
+
+	conns["alice"].send(IncomingMessage{Type: "message", ConversationID: "group-1", Content: "hi all"})
+
+	// The sender sees their own message land too.
+	expectMessage(t, conns, "hi all")
+}
+
+func TestDirectMessageReachesBothSidesOnly(t *testing.T) {
+	chat := newFakeChat(t)
+	chat.addConversation("direct-1", "alice", "bob")
+	chat.addConversation("direct-2", "carol", "dave")
+	hub, srv := startHub(t, Config{})
+
+	alice := dial(t, hub, srv, "alice")
+	bob := dial(t, hub, srv, "bob")
+	carol := dial(t, hub, srv, "carol")
+
+	alice.send(IncomingMessage{Type: "message", ConversationID: "direct-1", Content: "hi bob"})
+
+	expectMessage(t, map[string]*testConn{"alice": alice, "bob": bob}, "hi bob")
+	carol.expectNone(300*time.Millisecond, "message")
+}
+
+func TestChatMessageTimesAreUTC(t *testing.T) {
+	ist := time.FixedZone("IST", 5*60*60+30*60)
+	sentAt := time.Date(2026, 3, 2, 15, 30, 0, 0, ist)
+	expiresAt := sentAt.Add(time.Hour)
+
+	msg := newChatMessage(&models.Message{ID: "msg-1", CreatedAt: sentAt, ExpiresAt: &expiresAt, EditedAt: &sentAt})
+	if msg.CreatedAt != "2026-03-02T10:00:00Z" || msg.EditedAt != "2026-03-02T10:00:00Z" {
+		t.Errorf("created_at %q, edited_at %q; want 2026-03-02T10:00:00Z", msg.CreatedAt, msg.EditedAt)
+	}
+	if msg.ExpiresAt != "2026-03-02T11:00:00Z" {
+		t.Errorf("expires_at = %q, want 2026-03-02T11:00:00Z", msg.ExpiresAt)
+	}
+}
+
+func TestRejectedContentIsNacked(t *testing.T) {
+	chat := newFakeChat(t)
+	chat.addConversation("conv-1", "alice", "bob")
+	hub, srv := startHub(t, Config{})
+	alice := dial(t, hub, srv, "alice")
+
+	tests := []struct {
+		name        string
+		content     string
+		attachments []models.Attachment
+		code        string
+	}{
+		{"too long", strings.Repeat("x", MaxContentLength+1), nil, ErrCodeMessageTooLong},
+		{"empty", "  ", nil, ErrCodeEmptyMessage},
+		{"too many attachments", "look", make([]models.Attachment, maxAttachments+1), ErrCodeInvalidAttachment},
+	}
+	for _, tt := range tests {
+		alice.send(IncomingMessage{
+			Type: "message", ConversationID: "conv-1", Content: tt.content,
+			Attachments: tt.attachments, ClientMsgID: tt.name,
+		})
+		if f := alice.next("nack"); f.ClientMsgID != tt.name {
+			t.Errorf("%s: nack for %q", tt.name, f.ClientMsgID)
+		}
+		if f := alice.next("error"); f.Code != tt.code {
+			t.Errorf("%s: error code %q, want %s", tt.name, f.Code, tt.code)
+		}
+	}
+	if calls := chat.fake.Calls("INSERT INTO messages"); len(calls) != 0 {
+		t.Errorf("%d messages stored, want none", len(calls))
+	}
+}
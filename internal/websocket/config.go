@@ -0,0 +1,96 @@
+// Package websocket - connection keepalive, size and slow-client settings
+package websocket
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Config holds the keepalive timeouts, frame size limit and slow-client
+// handling of a Hub's connections.
+type Config struct {
+	// Time allowed to write a message to the peer.
+	WriteWait time.Duration
+
+	// Time allowed to read the next pong message from the peer.
+	// Mobile clients on flaky networks may need longer.
+	PongWait time.Duration
+
+	// Send pings to peer with this period. Must be less than PongWait.
+	PingPeriod time.Duration
+
+	// Maximum frame size allowed from peer; larger frames close the connection.
+	// Keep it well above MaxContentLength so over-long content gets an "error"
+	// reply instead of a dropped connection.
+	MaxMessageSize int64
+
+	// What to do when a client's send buffer is full. By default the client
+	// is disconnected, so it reconnects and resyncs instead of silently
+	// missing messages. With KeepSlowClients the frame is dropped and the
+	// connection kept.
+	KeepSlowClients bool
+
+	// How often each connection checks whether its token is about to expire.
+	TokenCheckPeriod time.Duration
+}
+
+// DefaultConfig returns the settings used when nothing is configured.
+func DefaultConfig() Config {
+	pongWait := 60 * time.Second
+	return Config{
+		WriteWait:        10 * time.Second,
+		PongWait:         pongWait,
+		PingPeriod:       (pongWait * 9) / 10,
+		MaxMessageSize:   64 * 1024,
+		TokenCheckPeriod: 10 * time.Second,
+	}
+}
+
+// Validate reports the first setting that isn't usable.
+func (c Config) Validate() error {
+	if c.WriteWait <= 0 {
+		return errors.New("write wait must be positive")
+	}
+	if c.PongWait <= 0 {
+		return errors.New("pong wait must be positive")
+	}
+	if c.PingPeriod <= 0 || c.PingPeriod >= c.PongWait {
+		return fmt.Errorf("ping period must be positive and less than pong wait (%v)", c.PongWait)
+	}
+	if c.MaxMessageSize <= int64(MaxContentLength) {
+		return fmt.Errorf("max message size must be larger than the max content length (%d)", MaxContentLength)
+	}
+	if c.TokenCheckPeriod <= 0 {
+		return errors.New("token check period must be positive")
+	}
+	return nil
+}
+
+// withDefaults fills in zero settings from DefaultConfig. A missing
+// PingPeriod, or one that isn't below PongWait, is derived from PongWait.
+func (c Config) withDefaults() Config {
+	defaults := DefaultConfig()
+	if c.WriteWait <= 0 {
+		c.WriteWait = defaults.WriteWait
+	}
+	if c.PongWait <= 0 {
+		c.PongWait = defaults.PongWait
+	}
+	if c.PingPeriod >= c.PongWait {
+		log.Printf("WebSocket ping period %v is not below pong wait %v; using %v",
+			c.PingPeriod, c.PongWait, (c.PongWait*9)/10)
+		c.PingPeriod = 0
+	}
+	if c.PingPeriod <= 0 {
+		c.PingPeriod = (c.PongWait * 9) / 10
+	}
+	if c.MaxMessageSize <= 0 {
+		c.MaxMessageSize = defaults.MaxMessageSize
+	}
+	if c.TokenCheckPeriod <= 0 {
+		c.TokenCheckPeriod = defaults.TokenCheckPeriod
+	}
+	return c
+}
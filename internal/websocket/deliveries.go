@@ -0,0 +1,53 @@
+// Package websocket - recording delivery outcomes
+package websocket
+
+import (
+	"log"
+
+	"chatgo/internal/db"
+)
+
+const (
+	// deliveryQueueSize bounds the outcomes waiting to be written. If the
+	// database falls this far behind, further outcomes are dropped: they're
+	// diagnostics, and Run must never wait on the database.
+	deliveryQueueSize = 4096
+
+	// deliveryWorkers is how many goroutines write outcomes, each taking up
+	// to deliveryBatchSize of them per statement.
+	deliveryWorkers   = 4
+	deliveryBatchSize = 200
+)
+
+// queueDelivery hands a delivery outcome to the delivery workers.
+// It never blocks; a full queue drops the outcome.
+func (h *Hub) queueDelivery(d db.Delivery) {
+	select {
+	case h.deliveries <- d:
+	default:
+		log.Printf("Delivery queue full; not recording %s for %s", d.MessageID, d.UserID)
+	}
+}
+
+// recordDeliveries is the loop each delivery worker runs: wait for an
+// outcome, take whatever else is already queued, and store the batch in
+// one statement. Logs (doesn't retry) on error.
+func (h *Hub) recordDeliveries() {
+	batch := make([]db.Delivery, 0, deliveryBatchSize)
+	for d := range h.deliveries {
+		batch = append(batch[:0], d)
+	fill:
+		for len(batch) < deliveryBatchSize {
+			select {
+			case d := <-h.deliveries:
+				batch = append(batch, d)
+			default:
+				break fill
+			}
+		}
+
+		if err := db.RecordDeliveries(batch); err != nil {
+			log.Printf("Failed to record %d deliveries: %v", len(batch), err)
+		}
+	}
+}
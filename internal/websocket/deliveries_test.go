@@ -0,0 +1,95 @@
+package websocket
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/lib/pq"
+
+	"chatgo/internal/db"
+)
+
+// recordedDeliveries collects the outcomes written so far, by message and user.
+func recordedDeliveries(t *testing.T, chat *fakeChat) map[[2]string]string {
+	t.Helper()
+	got := make(map[[2]string]string)
+	for _, call := range chat.fake.Calls("INSERT INTO message_deliveries") {
+		var messageIDs, userIDs, statuses pq.StringArray
+		for i, arr := range []*pq.StringArray{&messageIDs, &userIDs, &statuses} {
+			if err := arr.Scan(call.Args[i]); err != nil {
+				t.Fatalf("bad delivery argument %v: %v", call.Args[i], err)
+			}
+		}
+		for i := range statuses {
+			got[[2]string{messageIDs[i], userIDs[i]}] = statuses[i]
+		}
+	}
+	return got
+}
+
+func TestDeliveryOutcomesAreRecorded(t *testing.T) {
+	chat := newFakeChat(t)
+	chat.addConversation("conv-1", "online", "offline", "stalled")
+	// Keep the stalled client connected so its frame counts as dropped.
+	hub := NewHub(Config{KeepSlowClients: true})
+	go hub.Run()
+
+	online := addTestClient(t, hub, "online", 16)
+	addTestClient(t, hub, "stalled", 0)
+
+	hub.sendToConversation("conv-1", "msg-1", map[string]string{"type": "message"})
+
+	want := map[[2]string]string{
+		{"msg-1", "online"}:  db.DeliveryDelivered,
+		{"msg-1", "offline"}: db.DeliveryOffline,
+		{"msg-1", "stalled"}: db.DeliveryDropped,
+	}
+	var got map[[2]string]string
+	waitFor(t, "all three outcomes", func() bool {
+		got = recordedDeliveries(t, chat)
+		return len(got) == len(want)
+	})
+	for key, status := range want {
+		if got[key] != status {
+			t.Errorf("%s: recorded %q, want %q", key[1], got[key], status)
+		}
+	}
+
+	select {
+	case <-online.send:
+	default:
+		t.Error("online recipient was recorded as delivered but got nothing")
+	}
+}
+
+func TestDeliveryOutcomesAreBatched(t *testing.T) {
+	chat := newFakeChat(t)
+	hub := NewHub(Config{})
+
+	// Queue before the workers start, so they find everything waiting.
+	const outcomes = 2*deliveryBatchSize + 1
+	for i := range outcomes {
+		hub.queueDelivery(db.Delivery{MessageID: "msg-1", UserID: fmt.Sprintf("user-%d", i), Status: db.DeliveryOffline})
+	}
+	go hub.Run()
+
+	waitFor(t, "every outcome to be written", func() bool {
+		return len(recordedDeliveries(t, chat)) == outcomes
+	})
+	batches := len(chat.fake.Calls("INSERT INTO message_deliveries"))
+	if batches < 3 || batches > outcomes/10 {
+		t.Errorf("%d outcomes took %d statements; want a few batches of up to %d", outcomes, batches, deliveryBatchSize)
+	}
+}
+
+func TestQueueDeliveryNeverBlocks(t *testing.T) {
+	hub := NewHub(Config{})
+
+	// No workers are running, so the queue fills up; the rest are dropped.
+	for range deliveryQueueSize + 10 {
+		hub.queueDelivery(db.Delivery{MessageID: "msg-1", UserID: "u", Status: db.DeliveryOffline})
+	}
+	if len(hub.deliveries) != deliveryQueueSize {
+		t.Errorf("queue holds %d outcomes, want %d", len(hub.deliveries), deliveryQueueSize)
+	}
+}
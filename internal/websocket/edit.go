@@ -0,0 +1,56 @@
+// Package websocket - message editing
+package websocket
+
+import (
+	"log"
+	"time"
+
+	"chatgo/internal/db"
+)
+
+// EditedMessage is sent to a conversation when one of its messages is edited.
+type EditedMessage struct {
+	Type           string `json:"type"` // "edited"
+	ID             string `json:"id"`
+	ConversationID string `json:"conversation_id"`
+	Content        string `json:"content"`
+	EditedAt       string `json:"edited_at"`
+}
+
+// handleEditMessage processes an "edit" frame: the sender replaces the
+// content of one of their own messages and the conversation is told.
+func (c *Client) handleEditMessage(msg IncomingMessage) {
+	if msg.MessageID == "" {
+		log.Printf("User %s sent edit without message_id", c.UserID)
+		c.sendError(ErrCodeInvalidRequest, "message_id required", msg.ClientMsgID)
+		return
+	}
+	if !c.checkContent(msg.Content, msg.ClientMsgID, false) {
+		return
+	}
+
+	// UpdateMessage only matches messages this user sent, in a conversation
+	// they're still part of, so ownership and membership are checked together.
+	edited, err := db.UpdateMessage(msg.MessageID, c.UserID, msg.Content)
+	if err != nil {
+		log.Printf("Failed to edit message: %v", err)
+		c.sendError(ErrCodeInternal, "failed to edit message", msg.ClientMsgID)
+		return
+	}
+	if edited == nil {
+		log.Printf("User %s tried to edit message %s they didn't send", c.UserID, msg.MessageID)
+		c.sendError(ErrCodeNotFound, "no such message of yours to edit", msg.ClientMsgID)
+		return
+	}
+
+	editedMsg := EditedMessage{
+		Type:           "edited",
+		ID:             edited.ID,
+		ConversationID: edited.ConversationID,
+		Content:        edited.Content,
+		EditedAt:       edited.EditedAt.UTC().Format(time.RFC3339),
+	}
+
+	// No message ID here: an edit is not a new delivery to record.
+	c.sendToConversationParticipants(edited.ConversationID, "", editedMsg, c.blockedBy())
+}
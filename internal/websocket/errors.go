@@ -0,0 +1,64 @@
+// Package websocket - error replies to clients
+package websocket
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Error codes sent in ErrorMessage.Code.
+const (
+	ErrCodeInvalidRequest    = "invalid_request" // Malformed frame, unknown type or missing field
+	ErrCodeMessageTooLong    = "message_too_long"
+	ErrCodeEmptyMessage      = "empty_message"
+	ErrCodeRateLimited       = "rate_limited"
+	ErrCodeInvalidAttachment = "invalid_attachment"
+	ErrCodeNotParticipant    = "not_participant"
+	ErrCodeReadOnly          = "read_only"
+	ErrCodeNotFound          = "not_found"
+	ErrCodeInternal          = "internal_error" // Server-side failure; retrying may work
+)
+
+// ErrorMessage tells a client that one of its frames was rejected or failed.
+// Unlike a read-limit violation, this keeps the connection open.
+type ErrorMessage struct {
+	Type    string `json:"type"`          // "error"
+	Ref     string `json:"ref,omitempty"` // client_msg_id of the frame it answers, if it had one
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// sendError sends an ErrorMessage to this client's user.
+// ref is the client_msg_id of the failed frame ("" if it had none).
+func (c *Client) sendError(code, message, ref string) {
+	c.hub.SendToUser(c.UserID, ErrorMessage{
+		Type:    "error",
+		Ref:     ref,
+		Code:    code,
+		Message: message,
+	})
+}
+
+// rejectMessage reports a chat message that wasn't saved: a "nack" for
+// clients tracking acks, and an "error" with the reason.
+func (c *Client) rejectMessage(clientMsgID, code, message string) {
+	c.sendNack(clientMsgID, message)
+	c.sendError(code, message, clientMsgID)
+}
+
+// checkContent validates message content before it is stored.
+// Returns false (after rejecting the frame with rejectMessage) if it is too
+// long, or empty when allowEmpty is false (a message with attachments may
+// have no text).
+func (c *Client) checkContent(content, clientMsgID string, allowEmpty bool) bool {
+	if !allowEmpty && strings.TrimSpace(content) == "" {
+		c.rejectMessage(clientMsgID, ErrCodeEmptyMessage, "message content is empty")
+		return false
+	}
+	if len(content) > MaxContentLength {
+		c.rejectMessage(clientMsgID, ErrCodeMessageTooLong,
+			fmt.Sprintf("message content is longer than %d bytes", MaxContentLength))
+		return false
+	}
+	return true
+}
@@ -4,31 +4,129 @@ package websocket
 import (
 	"log"
 	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/gorilla/websocket"
 
 	"chatgo/internal/auth"
+	"chatgo/internal/db"
 )
 
+// HandshakeTimeout bounds how long the upgrade handshake may take.
+// Set it before calling Handler and ConfigureServer.
+var HandshakeTimeout = 10 * time.Second
+
+// ConfigureServer makes srv drop clients that connect but don't finish
+// sending their request, the WebSocket upgrade request included, within
+// HandshakeTimeout. The upgrader only bounds the server's side of the handshake.
+func ConfigureServer(srv *http.Server) {
+	srv.ReadHeaderTimeout = HandshakeTimeout
+}
+
+// EnableCompression turns on permessage-deflate (RFC 7692) for clients that
+// ask for it. It saves bandwidth on slow links at the cost of server CPU,
+// so it is off by default. Set it before calling Handler.
+var EnableCompression = false
+
+// AllowedOrigins lists the origins (e.g. "https://chat.example.com") that
+// browsers may open WebSocket connections from. Set it before calling Handler.
+// When empty, any origin is accepted in development, and only same-origin
+// pages are accepted in production (see Production).
+var AllowedOrigins []string
+
+// Production disables the permissive "any origin" fallback used when
+// AllowedOrigins is empty.
+var Production = false
+
 // upgrader configures the WebSocket upgrade.
 var upgrader = websocket.Upgrader{
 	ReadBufferSize:  1024,
 	WriteBufferSize: 1024,
-	// Allow connections from any origin (for development).
-	// In production, you should check the origin!
-	CheckOrigin: func(r *http.Request) bool {
+	CheckOrigin:     checkOrigin,
+}
+
+// checkOrigin guards against cross-site WebSocket hijacking: a page on
+// another site opening a socket with the user's browser. Requests without
+// an Origin header don't come from a browser page, so they're allowed.
+func checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
 		return true
-	},
+	}
+
+	for _, o := range AllowedOrigins {
+		if o == origin {
+			return true
+		}
+	}
+
+	if len(AllowedOrigins) == 0 {
+		if !Production {
+			return true
+		}
+		// No list in production: only the page this server itself serves.
+		if u, err := url.Parse(origin); err == nil && strings.EqualFold(u.Host, r.Host) {
+			return true
+		}
+	}
+
+	log.Printf("Rejected WebSocket connection from origin %q (not in CHATGO_ALLOWED_ORIGINS)", origin)
+	return false
+}
+
+// Subprotocol is the WebSocket subprotocol browsers offer alongside their
+// token, since they can't set an Authorization header on a WebSocket:
+//
+//	new WebSocket(url, ["chatgo", "bearer." + token])
+//
+// The server accepts "chatgo"; the token itself is never echoed back.
+const Subprotocol = "chatgo"
+
+// bearerProtocolPrefix marks the subprotocol entry that carries the token.
+const bearerProtocolPrefix = "bearer."
+
+// requestToken finds the JWT for a WebSocket request. In order, it looks at
+// the Authorization: Bearer header, a "bearer.<token>" subprotocol, and
+// finally the ?token= query parameter (kept for older clients, though it
+// leaks into access logs). protocol is the subprotocol to accept, if the
+// token came that way.
+func requestToken(r *http.Request) (token, protocol string) {
+	if h := r.Header.Get("Authorization"); strings.HasPrefix(h, "Bearer ") {
+		return strings.TrimPrefix(h, "Bearer "), ""
+	}
+
+	offered := websocket.Subprotocols(r)
+	for _, p := range offered {
+		if strings.HasPrefix(p, bearerProtocolPrefix) {
+			token = strings.TrimPrefix(p, bearerProtocolPrefix)
+			break
+		}
+	}
+	if token != "" {
+		if !slices.Contains(offered, Subprotocol) {
+			// Nothing safe to echo back; refuse rather than echo the token.
+			return "", ""
+		}
+		return token, Subprotocol
+	}
+
+	return r.URL.Query().Get("token"), ""
 }
 
 // Handler handles WebSocket connection requests.
-// It authenticates the user via JWT token in query parameter.
+// It authenticates the user via JWT (see requestToken for where it's read from).
 func Handler(hub *Hub) http.HandlerFunc {
+	upgrader := upgrader
+	upgrader.HandshakeTimeout = HandshakeTimeout
+	// The upgrader only negotiates compression if the client offers the
+	// extension in its handshake; other clients get plain frames.
+	upgrader.EnableCompression = EnableCompression
+
 	return func(w http.ResponseWriter, r *http.Request) {
-		// Get token from query parameter.
-		// WebSocket connections can't use Authorization header easily,
-		// so we use a query parameter: /ws?token=xxx
-		token := r.URL.Query().Get("token")
+		token, protocol := requestToken(r)
 		if token == "" {
 			http.Error(w, "Token required", http.StatusUnauthorized)
 			return
@@ -41,15 +139,41 @@ func Handler(hub *Hub) http.HandlerFunc {
 			return
 		}
 
+		// The token may outlive the account: refuse users who were
+		// deleted or deactivated since it was issued.
+		user, err := db.GetUserByID(claims.UserID)
+		if err != nil {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		if user == nil || !user.IsActive {
+			http.Error(w, "Account is not active", http.StatusForbidden)
+			return
+		}
+
 		// Upgrade HTTP connection to WebSocket.
-		conn, err := upgrader.Upgrade(w, r, nil)
+		// The wrapper lets us count bytes on the wire for GetStats.
+		// If the token came as a subprotocol, the spec requires us to
+		// accept one of the offered protocols in the response.
+		var responseHeader http.Header
+		if protocol != "" {
+			responseHeader = http.Header{"Sec-WebSocket-Protocol": {protocol}}
+		}
+		conn, err := upgrader.Upgrade(countingResponseWriter{w}, r, responseHeader)
 		if err != nil {
 			log.Printf("WebSocket upgrade error: %v", err)
 			return
 		}
+		// A no-op unless compression was negotiated. Only data frames are
+		// compressed; pings and pongs are control frames and never are.
+		conn.EnableWriteCompression(EnableCompression)
 
-		// Create a new client.
-		client := NewClient(hub, conn, claims.UserID, claims.Username)
+		// Create a new client. It must reauthenticate before the token expires.
+		var tokenExpiry time.Time
+		if claims.ExpiresAt != nil {
+			tokenExpiry = claims.ExpiresAt.Time
+		}
+		client := NewClient(hub, conn, claims.UserID, claims.Username, tokenExpiry)
 
 		// Register the client with the hub.
 		hub.register <- client
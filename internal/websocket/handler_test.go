@@ -0,0 +1,99 @@
+package websocket
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"chatgo/internal/auth"
+)
+
+func TestStalledHandshakeIsDropped(t *testing.T) {
+	saved := HandshakeTimeout
+	HandshakeTimeout = 200 * time.Millisecond
+	t.Cleanup(func() { HandshakeTimeout = saved })
+
+	srv := httptest.NewUnstartedServer(Handler(NewHub(Config{})))
+	ConfigureServer(srv.Config)
+	srv.Start()
+	defer srv.Close()
+
+	conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+
+	// Start the upgrade request, then stall before the blank line ending it.
+	start := time.Now()
+	io.WriteString(conn, "GET / HTTP/1.1\r\nHost: chatgo\r\nUpgrade: websocket\r\n")
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := io.ReadAll(conn); err != nil {
+		t.Fatalf("connection still open after %v: %v", time.Since(start), err)
+	}
+	if elapsed := time.Since(start); elapsed < HandshakeTimeout {
+		t.Errorf("dropped after %v, before the %v timeout", elapsed, HandshakeTimeout)
+	}
+}
+
+func TestCompressionIsNegotiatedPerClient(t *testing.T) {
+	EnableCompression = true
+	t.Cleanup(func() { EnableCompression = false })
+	newFakeChat(t)
+	hub, srv := startHub(t, Config{})
+
+	for _, offer := range []bool{true, false} {
+		userID := fmt.Sprintf("offer-%v", offer)
+		token, err := auth.GenerateToken(userID, userID, false)
+		if err != nil {
+			t.Fatalf("GenerateToken: %v", err)
+		}
+		dialer := websocket.Dialer{EnableCompression: offer}
+		conn, resp, err := dialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"),
+			http.Header{"Authorization": {"Bearer " + token}})
+		if err != nil {
+			t.Fatalf("dial as %s: %v", userID, err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		waitFor(t, "registration of "+userID, func() bool { return hub.client(userID) != nil })
+
+		extensions := resp.Header.Get("Sec-WebSocket-Extensions")
+		if negotiated := strings.Contains(extensions, "permessage-deflate"); negotiated != offer {
+			t.Errorf("client offering compression: %v; handshake extensions %q", offer, extensions)
+		}
+		if !offer {
+			continue
+		}
+
+		// The server answers pings on the compressed connection.
+		pong := make(chan struct{}, 1)
+		conn.SetPongHandler(func(string) error {
+			pong <- struct{}{}
+			return nil
+		})
+		if err := conn.WriteControl(websocket.PingMessage, []byte("ping"), time.Now().Add(time.Second)); err != nil {
+			t.Fatalf("ping: %v", err)
+		}
+		go func() {
+			// Reading is what runs the pong handler; presence frames are skipped.
+			for {
+				if _, _, err := conn.ReadMessage(); err != nil {
+					return
+				}
+			}
+		}()
+		select {
+		case <-pong:
+		case <-time.After(FrameTimeout):
+			t.Error("no pong on the compressed connection")
+		}
+	}
+}
@@ -0,0 +1,333 @@
+package websocket
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"chatgo/internal/auth"
+	"chatgo/internal/dbtest"
+)
+
+// fakeChat scripts a dbtest.Fake so the hub sees every user as active,
+// conversations with fixed members, and blocks between users. Saved
+// messages get the next seq in their conversation, like the real query.
+type fakeChat struct {
+	fake *dbtest.Fake
+
+	mutex    sync.Mutex
+	members  map[string][]string // Conversation ID -> user IDs
+	readOnly map[string]bool     // Conversation ID -> read-only
+	blocks   map[string][]string // Blocker ID -> blocked IDs
+	seqs     map[string]int64    // Conversation ID -> last seq
+}
+
+func newFakeChat(t *testing.T) *fakeChat {
+	t.Helper()
+	c := &fakeChat{
+		fake:     dbtest.UseFake(t),
+		members:  make(map[string][]string),
+		readOnly: make(map[string]bool),
+		blocks:   make(map[string][]string),
+		seqs:     make(map[string]int64),
+	}
+
+	c.fake.On("FROM users WHERE id = $1", func(args []driver.Value) dbtest.Result {
+		id := args[0].(string)
+		return dbtest.Result{
+			Columns: []string{"id", "username", "display_name", "password_hash", "is_admin",
+				"is_bot", "is_active", "avatar_url", "last_seen_at", "created_at"},
+			Rows: [][]driver.Value{{id, id, id, "!", false, false, true, "", nil, time.Now()}},
+		}
+	})
+	c.fake.On("LEFT JOIN conversation_settings", func(args []driver.Value) dbtest.Result {
+		convID, userID := args[0].(string), args[1].(string)
+		members, readOnly := c.conversation(convID)
+		if !slices.Contains(members, userID) {
+			return dbtest.Result{}
+		}
+		return dbtest.Result{
+			Columns: []string{"id", "name", "is_group", "read_only", "created_at",
+				"count", "role", "joined_at", "muted"},
+			Rows: [][]driver.Value{{convID, "", len(members) > 2, readOnly, time.Now(),
+				int64(len(members)), "member", time.Now(), false}},
+		}
+	})
+	c.fake.On("UPDATE conversations SET last_seq", func(args []driver.Value) dbtest.Result {
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+		convID := args[0].(string)
+		c.seqs[convID]++
+		return dbtest.Result{Columns: []string{"last_seq"}, Rows: [][]driver.Value{{c.seqs[convID]}}}
+	})
+	c.fake.On("INSERT INTO messages", func(args []driver.Value) dbtest.Result {
+		convID, senderID, content, seq := args[0].(string), args[1].(string), args[2].(string), args[3].(int64)
+		return dbtest.Result{
+			Columns: []string{"id", "conversation_id", "sender_id", "username", "display_name",
+				"avatar_url", "content", "seq", "is_system", "expires_at", "edited_at",
+				"reply_to_message_id", "created_at"},
+			Rows: [][]driver.Value{{fmt.Sprintf("%s-%d", convID, seq), convID, senderID, senderID,
+				senderID, "", content, seq, args[5], nil, nil, nil, time.Now()}},
+		}
+	})
+	c.fake.On("SELECT user_id FROM conversation_participants WHERE conversation_id", func(args []driver.Value) dbtest.Result {
+		members, _ := c.conversation(args[0].(string))
+		return idRows(members)
+	})
+	c.fake.On("SELECT 1 FROM conversation_participants WHERE user_id", func(args []driver.Value) dbtest.Result {
+		members, _ := c.conversation(args[1].(string))
+		if !slices.Contains(members, args[0].(string)) {
+			return dbtest.Result{}
+		}
+		return dbtest.Result{Columns: []string{"exists"}, Rows: [][]driver.Value{{int64(1)}}}
+	})
+	c.fake.On("SELECT DISTINCT other.user_id", func(args []driver.Value) dbtest.Result {
+		return idRows(c.contacts(args[0].(string)))
+	})
+	c.fake.On("SELECT blocked_id FROM blocks", func(args []driver.Value) dbtest.Result {
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+		return idRows(c.blocks[args[0].(string)])
+	})
+	c.fake.On("SELECT blocker_id FROM blocks", func(args []driver.Value) dbtest.Result {
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+		var blockers []string
+		for blocker, blocked := range c.blocks {
+			if slices.Contains(blocked, args[0].(string)) {
+				blockers = append(blockers, blocker)
+			}
+		}
+		return idRows(blockers)
+	})
+	return c
+}
+
+// addConversation creates (or replaces) a conversation with these members.
+func (c *fakeChat) addConversation(id string, members ...string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.members[id] = members
+}
+
+// setReadOnly makes a conversation read-only for its members.
+func (c *fakeChat) setReadOnly(id string, readOnly bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.readOnly[id] = readOnly
+}
+
+// block records that blocker has blocked blocked.
+func (c *fakeChat) block(blocker, blocked string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.blocks[blocker] = append(c.blocks[blocker], blocked)
+}
+
+func (c *fakeChat) conversation(id string) (members []string, readOnly bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return slices.Clone(c.members[id]), c.readOnly[id]
+}
+
+func (c *fakeChat) contacts(userID string) []string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	var contacts []string
+	for _, members := range c.members {
+		if !slices.Contains(members, userID) {
+			continue
+		}
+		for _, m := range members {
+			if m != userID && !slices.Contains(contacts, m) {
+				contacts = append(contacts, m)
+			}
+		}
+	}
+	return contacts
+}
+
+func idRows(ids []string) dbtest.Result {
+	rows := make([][]driver.Value, len(ids))
+	for i, id := range ids {
+		rows[i] = []driver.Value{id}
+	}
+	return dbtest.Result{Columns: []string{"id"}, Rows: rows}
+}
+
+// startHub runs a hub behind a test server and returns the server.
+// When the test ends (and its connections are closed), it waits for every
+// client to unregister, so the next test starts with none.
+func startHub(t *testing.T, cfg Config) (*Hub, *httptest.Server) {
+	t.Helper()
+	hub := NewHub(cfg)
+	go hub.Run()
+
+	srv := httptest.NewServer(Handler(hub))
+	t.Cleanup(func() {
+		waitFor(t, "clients to unregister", func() bool { return hub.ClientCount() == 0 })
+		srv.Close()
+	})
+	return hub, srv
+}
+
+// testConn is a test's end of a WebSocket connection.
+type testConn struct {
+	t    *testing.T
+	conn *websocket.Conn
+}
+
+// dial connects to srv as userID and waits until the hub has registered it.
+func dial(t *testing.T, hub *Hub, srv *httptest.Server, userID string) *testConn {
+	t.Helper()
+	before := hub.client(userID)
+	conn, err := dialConn(srv, userID)
+	if err != nil {
+		t.Fatalf("dial as %s: %v", userID, err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	waitFor(t, "registration of "+userID, func() bool {
+		current := hub.client(userID)
+		return current != nil && current != before
+	})
+	return &testConn{t: t, conn: conn}
+}
+
+// dialConn opens a connection to srv as userID. Unlike dial it doesn't
+// touch t, so it can be used from any goroutine.
+func dialConn(srv *httptest.Server, userID string) (*websocket.Conn, error) {
+	token, err := auth.GenerateToken(userID, userID, false)
+	if err != nil {
+		return nil, err
+	}
+	url := "ws" + strings.TrimPrefix(srv.URL, "http")
+	header := http.Header{"Authorization": {"Bearer " + token}}
+	conn, _, err := websocket.DefaultDialer.Dial(url, header)
+	return conn, err
+}
+
+// client returns the hub's live client for userID, or nil.
+func (h *Hub) client(userID string) *Client {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	return h.clients[userID]
+}
+
+// send writes one frame.
+func (c *testConn) send(msg IncomingMessage) {
+	c.t.Helper()
+	if err := c.conn.WriteJSON(msg); err != nil {
+		c.t.Fatalf("write: %v", err)
+	}
+}
+
+// frame is a decoded frame from the server; Type says which fields are set.
+type frame struct {
+	Type           string `json:"type"`
+	ID             string `json:"id"`
+	ConversationID string `json:"conversation_id"`
+	MessageID      string `json:"message_id"`
+	ClientMsgID    string `json:"client_msg_id"`
+	SenderID       string `json:"sender_id"`
+	UserID         string `json:"user_id"`
+	Content        string `json:"content"`
+	Seq            int64  `json:"seq"`
+	IsSystem       bool   `json:"is_system"`
+	IsTyping       bool   `json:"is_typing"`
+	Code           string `json:"code"`
+}
+
+// FrameTimeout is how long tests wait for a frame they expect.
+const FrameTimeout = 2 * time.Second
+
+// next returns the next frame of one of the given types, skipping others
+// (presence events and the like). It fails the test if none arrives in time.
+func (c *testConn) next(types ...string) frame {
+	c.t.Helper()
+	f, ok := c.readType(FrameTimeout, types...)
+	if !ok {
+		c.t.Fatalf("no %v frame arrived", types)
+	}
+	return f
+}
+
+// readType is like next, but reports a missing frame instead of failing,
+// so it can be used from any goroutine.
+func (c *testConn) readType(wait time.Duration, types ...string) (frame, bool) {
+	deadline := time.Now().Add(wait)
+	for {
+		f, ok := c.read(time.Until(deadline))
+		if !ok || slices.Contains(types, f.Type) {
+			return f, ok
+		}
+	}
+}
+
+// expectNone fails the test if a frame of one of the given types arrives within wait.
+func (c *testConn) expectNone(wait time.Duration, types ...string) {
+	c.t.Helper()
+	deadline := time.Now().Add(wait)
+	for {
+		f, ok := c.read(time.Until(deadline))
+		if !ok {
+			return
+		}
+		if slices.Contains(types, f.Type) {
+			c.t.Fatalf("unexpected %s frame: %+v", f.Type, f)
+		}
+	}
+}
+
+// read returns the next frame, or false if none arrives within wait.
+// A timed-out read leaves the connection unusable, so call it last.
+func (c *testConn) read(wait time.Duration) (frame, bool) {
+	if wait <= 0 {
+		return frame{}, false
+	}
+	c.conn.SetReadDeadline(time.Now().Add(wait))
+	_, data, err := c.conn.ReadMessage()
+	if err != nil {
+		return frame{}, false
+	}
+	var f frame
+	if err := json.Unmarshal(data, &f); err != nil {
+		c.t.Errorf("bad frame %s: %v", data, err)
+		return frame{}, false
+	}
+	return f, true
+}
+
+// waitFor polls cond until it holds, failing the test after a few seconds.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// addTestClient registers a client with no network connection whose send
+// buffer holds buffer frames; the test reads its frames straight off
+// client.send. With buffer 0 every frame sent to it is dropped.
+func addTestClient(t *testing.T, hub *Hub, userID string, buffer int) *Client {
+	t.Helper()
+	client := NewClient(hub, nil, userID, userID, time.Time{})
+	client.send = make(chan []byte, buffer)
+	hub.register <- client
+	waitFor(t, "registration of "+userID, func() bool { return hub.client(userID) == client })
+	t.Cleanup(func() { hub.DisconnectUser(userID) })
+	return client
+}
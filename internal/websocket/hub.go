@@ -3,20 +3,47 @@ package websocket
 
 import (
 	"encoding/json"
+	"hash/fnv"
 	"log"
+	"slices"
 	"sync"
+	"time"
+
+	"chatgo/internal/db"
+	"chatgo/internal/models"
 )
 
+// conversationLockStripes is the number of locks conversations are spread over.
+const conversationLockStripes = 64
+
 // Hub maintains the set of active clients and broadcasts messages.
+//
+// Locking order. Several locks guard hub and client state; whenever more than
+// one is held they must be taken in this order, to avoid deadlocks:
+//
+//  1. Hub.conversationLocks - held while saving a chat message and queueing it
+//  2. Hub.mutex             - guards the clients map
+//  3. Client.typingMutex    - guards a client's typing throttle state
+//  4. Client.tokenMutex     - guards a client's token expiry
+//
+// No code may block on the broadcast channel while holding Hub.mutex or a
+// Client lock: Run needs Hub.mutex to drain that channel.
 type Hub struct {
+	// config holds the keepalive and size settings for every connection.
+	config Config
+
 	// clients maps user ID to their connection.
 	// A user can only have one active connection.
 	clients map[string]*Client
 
-	// mutex protects the clients map from concurrent access.
+	// mutex protects the clients and offlineTimers maps from concurrent access.
 	// Go maps are not thread-safe, so we need this.
 	mutex sync.RWMutex
 
+	// offlineTimers holds users who just disconnected and whose offline
+	// presence event is waiting out presenceGracePeriod.
+	offlineTimers map[string]*time.Timer
+
 	// register channel for new client connections.
 	register chan *Client
 
@@ -25,38 +52,65 @@ type Hub struct {
 
 	// broadcast channel for messages to send to specific users.
 	broadcast chan *OutgoingMessage
+
+	// deliveries queues delivery outcomes for the delivery workers
+	// (see recordDeliveries), so Run never waits on the database.
+	deliveries chan db.Delivery
+
+	// conversationLocks serialize "save message, then fan it out" per
+	// conversation, so every recipient sees messages in seq order.
+	// Conversations are hashed onto a fixed set of stripes to keep memory bounded.
+	conversationLocks [conversationLockStripes]sync.Mutex
 }
 
 // OutgoingMessage is a message to send to a specific user.
 type OutgoingMessage struct {
 	RecipientID string
 	Data        []byte
+
+	// MessageID is set for chat messages so the hub can record whether
+	// the recipient got it (see db.RecordDeliveries).
+	MessageID string
 }
 
-// NewHub creates a new Hub instance.
-func NewHub() *Hub {
+// NewHub creates a new Hub instance whose connections use cfg.
+// Zero settings in cfg take their DefaultConfig values.
+func NewHub(cfg Config) *Hub {
 	return &Hub{
-		clients:    make(map[string]*Client),
-		register:   make(chan *Client),
-		unregister: make(chan *Client),
-		broadcast:  make(chan *OutgoingMessage, 256), // Buffered channel
+		config:        cfg.withDefaults(),
+		clients:       make(map[string]*Client),
+		offlineTimers: make(map[string]*time.Timer),
+		register:      make(chan *Client),
+		unregister:    make(chan *Client),
+		broadcast:     make(chan *OutgoingMessage, 256), // Buffered channel
+		deliveries:    make(chan db.Delivery, deliveryQueueSize),
 	}
 }
 
-// Run starts the hub's main loop.
+// Run starts the hub's main loop, and the workers recording delivery outcomes.
 // This should be run in a goroutine.
 func (h *Hub) Run() {
+	for range deliveryWorkers {
+		go h.recordDeliveries()
+	}
+
 	for {
 		select {
 		case client := <-h.register:
 			log.Printf("Register request for: %s (%s)", client.Username, client.UserID)
 			h.mutex.Lock()
 			// If user already has a connection, close the old one.
-			if oldClient, exists := h.clients[client.UserID]; exists {
+			oldClient, exists := h.clients[client.UserID]
+			if exists {
 				log.Printf("Replacing existing client for: %s", client.UserID)
 				oldClient.Close() // Use safe Close method
 			}
 			h.clients[client.UserID] = client
+			totalConnections.Add(1)
+			if !exists {
+				activeConnections.Add(1)
+			}
+			h.userConnected(client.UserID, exists)
 			h.mutex.Unlock()
 			log.Printf("Client connected: %s (%s)", client.Username, client.UserID)
 
@@ -67,7 +121,9 @@ func (h *Hub) Run() {
 			if existingClient, exists := h.clients[client.UserID]; exists && existingClient == client {
 				log.Printf("Removing active client: %s", client.UserID)
 				delete(h.clients, client.UserID)
+				activeConnections.Add(-1)
 				client.Close() // Use safe Close method
+				h.userDisconnected(client.UserID)
 				log.Printf("Client disconnected: %s (%s)", client.Username, client.UserID)
 			} else {
 				log.Printf("Skipping unregister - client already replaced: %s", client.UserID)
@@ -75,23 +131,44 @@ func (h *Hub) Run() {
 			h.mutex.Unlock()
 
 		case message := <-h.broadcast:
+			status := db.DeliveryOffline
 			h.mutex.RLock()
-			if client, exists := h.clients[message.RecipientID]; exists {
+			client, exists := h.clients[message.RecipientID]
+			if exists {
 				select {
 				case client.send <- message.Data:
 					// Message sent successfully
+					status = db.DeliveryDelivered
+					messagesSent.Add(1)
 				default:
 					// Client's send buffer is full, skip this message
 					log.Printf("Failed to send message to %s: buffer full", message.RecipientID)
+					status = db.DeliveryDropped
+					messagesDropped.Add(1)
 				}
 			}
 			h.mutex.RUnlock()
+
+			// A client that missed a frame is out of sync; make it reconnect.
+			if status == db.DeliveryDropped && !h.config.KeepSlowClients {
+				h.disconnectSlowClient(client)
+			}
+
+			if message.MessageID != "" {
+				h.queueDelivery(db.Delivery{MessageID: message.MessageID, UserID: message.RecipientID, Status: status})
+			}
 		}
 	}
 }
 
 // SendToUser sends a message to a specific user by their ID.
 func (h *Hub) SendToUser(userID string, message interface{}) error {
+	return h.sendTracked(userID, "", message)
+}
+
+// sendTracked is like SendToUser, but records the delivery outcome of
+// chat message messageID for this user (when messageID is non-empty).
+func (h *Hub) sendTracked(userID, messageID string, message interface{}) error {
 	data, err := json.Marshal(message)
 	if err != nil {
 		return err
@@ -100,18 +177,130 @@ func (h *Hub) SendToUser(userID string, message interface{}) error {
 	h.broadcast <- &OutgoingMessage{
 		RecipientID: userID,
 		Data:        data,
+		MessageID:   messageID,
 	}
 	return nil
 }
 
+// sendToConversation sends a message to every participant of a conversation.
+// If messageID is set, the delivery outcome per participant is recorded.
+func (h *Hub) sendToConversation(conversationID, messageID string, message interface{}) {
+	h.sendToConversationExcept(conversationID, nil, messageID, message)
+}
+
+// sendToConversationExcept is like sendToConversation, but skips the
+// participants whose IDs are in exclude.
+func (h *Hub) sendToConversationExcept(conversationID string, exclude []string, messageID string, message interface{}) {
+	participantIDs, err := db.GetConversationParticipantIDs(conversationID)
+	if err != nil {
+		log.Printf("Failed to get conversation participants: %v", err)
+		return
+	}
+
+	for _, id := range participantIDs {
+		if slices.Contains(exclude, id) {
+			continue
+		}
+		if err := h.sendTracked(id, messageID, message); err != nil {
+			log.Printf("Failed to send to %s: %v", id, err)
+		}
+	}
+}
+
+// ClearTyping clears a user's typing state in a conversation and, if they were
+// typing, tells the conversation they stopped. Call it when a user is removed
+// from a conversation. Nil-safe; does nothing if the user isn't connected.
+func (h *Hub) ClearTyping(userID, conversationID string) {
+	if h == nil {
+		return
+	}
+
+	h.mutex.RLock()
+	client, exists := h.clients[userID]
+	h.mutex.RUnlock()
+
+	if exists {
+		client.clearTyping(conversationID)
+	}
+}
+
+// lockConversation locks the stripe for a conversation and returns the unlock func.
+// Hold it from assigning a message's seq until the message is queued for all
+// recipients: the broadcast channel is FIFO, so queue order is delivery order.
+func (h *Hub) lockConversation(conversationID string) func() {
+	hash := fnv.New32a()
+	hash.Write([]byte(conversationID))
+	lock := &h.conversationLocks[hash.Sum32()%conversationLockStripes]
+	lock.Lock()
+	return lock.Unlock
+}
+
 // IsUserOnline checks if a user is currently connected.
+// A nil hub reports everyone as offline.
 func (h *Hub) IsUserOnline(userID string) bool {
+	if h == nil {
+		return false
+	}
+
 	h.mutex.RLock()
 	defer h.mutex.RUnlock()
 	_, exists := h.clients[userID]
 	return exists
 }
 
+// DisconnectUser closes a user's live connection, if they have one, with a
+// CloseSessionRevoked close frame. The client has to reconnect (and pass
+// authentication again) to get back in. A nil hub does nothing.
+func (h *Hub) DisconnectUser(userID string) {
+	if h == nil {
+		return
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	client, exists := h.clients[userID]
+	if !exists {
+		return
+	}
+	log.Printf("Force-disconnecting client: %s", userID)
+	// Removed here, so the unregister that follows from ReadPump is a no-op.
+	delete(h.clients, userID)
+	activeConnections.Add(-1)
+	client.closeWith(CloseSessionRevoked, "session revoked")
+	h.userDisconnected(userID)
+}
+
+// disconnectSlowClient closes a client whose send buffer is full, with a
+// CloseSlowClient close frame. Only called from Run, which is the only
+// sender on client.send, so closing it here can't race a send.
+func (h *Hub) disconnectSlowClient(client *Client) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if current, exists := h.clients[client.UserID]; !exists || current != client {
+		return
+	}
+	log.Printf("Disconnecting slow client: %s", client.UserID)
+	// Removed here, so the unregister that follows from ReadPump is a no-op.
+	delete(h.clients, client.UserID)
+	activeConnections.Add(-1)
+	client.closeWith(CloseSlowClient, "send buffer full")
+	h.userDisconnected(client.UserID)
+}
+
+// ClientCount returns how many users currently have a live connection.
+// A nil hub has none.
+func (h *Hub) ClientCount() int {
+	if h == nil {
+		return 0
+	}
+
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	return len(h.clients)
+}
+
 // Global hub instance for access from API handlers.
 var globalHub *Hub
 
@@ -132,9 +321,10 @@ type NewConversationMessage struct {
 }
 
 // NotifyNewConversation notifies all participants about a new conversation.
-func NotifyNewConversation(conversationID string, participantIDs []string) {
-	hub := GetGlobalHub()
-	if hub == nil {
+// Safe to call on a nil hub (e.g. in tests or REST-only setups): it does nothing.
+// Participants who aren't connected are simply skipped by the hub.
+func (h *Hub) NotifyNewConversation(conversationID string, participantIDs []string) {
+	if h == nil {
 		return
 	}
 
@@ -144,6 +334,56 @@ func NotifyNewConversation(conversationID string, participantIDs []string) {
 	}
 
 	for _, userID := range participantIDs {
-		hub.SendToUser(userID, msg)
+		h.SendToUser(userID, msg)
 	}
 }
+
+// NotifyNewConversation notifies participants using the global hub, if one is set.
+func NotifyNewConversation(conversationID string, participantIDs []string) {
+	GetGlobalHub().NotifyNewConversation(conversationID, participantIDs)
+}
+
+// ConversationDeletedMessage tells a former participant that a conversation
+// is gone, so clients can close it.
+type ConversationDeletedMessage struct {
+	Type           string `json:"type"` // "conversation_deleted"
+	ConversationID string `json:"conversation_id"`
+}
+
+// NotifyConversationDeleted tells everyone who was in a deleted conversation.
+// The participants are passed in because they're no longer in the database.
+// Nil-safe.
+func (h *Hub) NotifyConversationDeleted(conversationID string, participantIDs []string) {
+	if h == nil {
+		return
+	}
+
+	msg := ConversationDeletedMessage{
+		Type:           "conversation_deleted",
+		ConversationID: conversationID,
+	}
+
+	for _, userID := range participantIDs {
+		h.ClearTyping(userID, conversationID)
+		h.SendToUser(userID, msg)
+	}
+}
+
+// NotificationMessage pushes a durable notification to an online user.
+type NotificationMessage struct {
+	Type         string               `json:"type"` // "notification"
+	Notification *models.Notification `json:"notification"`
+}
+
+// SendNotification pushes a stored notification to the user if they're online.
+// Offline users fetch it later via GET /api/notifications. Nil-safe.
+func (h *Hub) SendNotification(userID string, n *models.Notification) {
+	if h == nil {
+		return
+	}
+
+	h.SendToUser(userID, NotificationMessage{
+		Type:         "notification",
+		Notification: n,
+	})
+}
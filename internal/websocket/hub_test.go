@@ -0,0 +1,111 @@
+package websocket
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// TestHubConcurrentChurn connects, replaces, force-disconnects and hangs up
+// clients all at once while they send messages and typing events, so the
+// race detector sees every path that touches the clients map and a
+// client's send channel at the same time.
+func TestHubConcurrentChurn(t *testing.T) {
+	chat := newFakeChat(t)
+	users := []string{"u0", "u1", "u2", "u3", "u4", "u5"}
+	chat.addConversation("conv-1", users...)
+	hub, srv := startHub(t, Config{})
+	activeBefore := activeConnections.Load()
+
+	const rounds = 10
+	var wg sync.WaitGroup
+
+	// Two connection loops per user, so each user's connections keep
+	// replacing one another.
+	for _, userID := range users {
+		for range 2 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := range rounds {
+					conn, err := dialConn(srv, userID)
+					if err != nil {
+						t.Errorf("dial as %s: %v", userID, err)
+						return
+					}
+					go func() {
+						for {
+							if _, _, err := conn.ReadMessage(); err != nil {
+								return
+							}
+						}
+					}()
+
+					for j := range 3 {
+						conn.WriteJSON(IncomingMessage{
+							Type:           "message",
+							ConversationID: "conv-1",
+							Content:        fmt.Sprintf("%s %d.%d", userID, i, j),
+						})
+						conn.WriteJSON(IncomingMessage{Type: "typing", ConversationID: "conv-1", IsTyping: j%2 == 0})
+					}
+					conn.Close()
+				}
+			}()
+		}
+	}
+
+	// Meanwhile, kick users off and read hub state.
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := range rounds * 20 {
+			userID := users[i%len(users)]
+			hub.DisconnectUser(userID)
+			hub.IsUserOnline(userID)
+			hub.ClearTyping(userID, "conv-1")
+			hub.ClientCount()
+			time.Sleep(time.Millisecond)
+		}
+	}()
+
+	wg.Wait()
+	waitFor(t, "every client to unregister", func() bool { return hub.ClientCount() == 0 })
+	if len(chat.fake.Calls("INSERT INTO messages")) == 0 {
+		t.Error("no message was saved; the clients never got that far")
+	}
+	if got := activeConnections.Load(); got != activeBefore {
+		t.Errorf("active connections = %d after everyone left, want %d", got, activeBefore)
+	}
+}
+
+func TestDisconnectedClientCannotSend(t *testing.T) {
+	chat := newFakeChat(t)
+	chat.addConversation("conv-1", "alice", "bob")
+	hub, srv := startHub(t, Config{})
+	alice := dial(t, hub, srv, "alice")
+	bob := dial(t, hub, srv, "bob")
+
+	hub.DisconnectUser("alice")
+	alice.conn.WriteJSON(IncomingMessage{Type: "message", ConversationID: "conv-1", Content: "still here?"})
+
+	alice.conn.SetReadDeadline(time.Now().Add(FrameTimeout))
+	for {
+		_, _, err := alice.conn.ReadMessage()
+		if err == nil {
+			continue
+		}
+		if !websocket.IsCloseError(err, CloseSessionRevoked) {
+			t.Fatalf("connection ended with %v, want close code %d", err, CloseSessionRevoked)
+		}
+		break
+	}
+
+	bob.expectNone(200*time.Millisecond, "message")
+	if calls := chat.fake.Calls("INSERT INTO messages"); len(calls) != 0 {
+		t.Errorf("stored %d messages after the disconnect, want none", len(calls))
+	}
+}
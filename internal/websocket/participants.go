@@ -0,0 +1,63 @@
+// Package websocket - participant change events
+package websocket
+
+import (
+	"log"
+)
+
+// ParticipantMessage tells a conversation that its membership changed.
+type ParticipantMessage struct {
+	Type           string `json:"type"` // "participant_added", "participant_removed" or "participant_left"
+	ConversationID string `json:"conversation_id"`
+	UserID         string `json:"user_id"`
+	Username       string `json:"username"`
+}
+
+// NotifyParticipantAdded tells the conversation's members that userID joined,
+// and tells userID about the conversation. Nil-safe.
+func (h *Hub) NotifyParticipantAdded(conversationID, userID, username string) {
+	if h == nil {
+		return
+	}
+
+	h.sendToConversation(conversationID, "", ParticipantMessage{
+		Type:           "participant_added",
+		ConversationID: conversationID,
+		UserID:         userID,
+		Username:       username,
+	})
+	h.NotifyNewConversation(conversationID, []string{userID})
+}
+
+// NotifyParticipantRemoved tells the remaining members, and the removed user
+// themselves, that userID was removed from the conversation. Nil-safe.
+func (h *Hub) NotifyParticipantRemoved(conversationID, userID, username string) {
+	h.notifyParticipantGone("participant_removed", conversationID, userID, username)
+}
+
+// NotifyParticipantLeft tells the remaining members, and the user who left,
+// that userID left the conversation. Nil-safe.
+func (h *Hub) NotifyParticipantLeft(conversationID, userID, username string) {
+	h.notifyParticipantGone("participant_left", conversationID, userID, username)
+}
+
+// notifyParticipantGone sends a "participant_removed" or "participant_left"
+// event and clears any typing indicator the user left behind.
+func (h *Hub) notifyParticipantGone(eventType, conversationID, userID, username string) {
+	if h == nil {
+		return
+	}
+
+	h.ClearTyping(userID, conversationID)
+
+	msg := ParticipantMessage{
+		Type:           eventType,
+		ConversationID: conversationID,
+		UserID:         userID,
+		Username:       username,
+	}
+	h.sendToConversation(conversationID, "", msg)
+	if err := h.SendToUser(userID, msg); err != nil {
+		log.Printf("Failed to send to %s: %v", userID, err)
+	}
+}
@@ -0,0 +1,102 @@
+// Package websocket - presence (online/offline) events
+package websocket
+
+import (
+	"log"
+	"slices"
+	"time"
+
+	"chatgo/internal/db"
+)
+
+// presenceGracePeriod is how long a user may be disconnected before their
+// contacts are told they went offline. A reconnect within this window (a page
+// reload, a flaky network) produces no offline/online flap at all.
+const presenceGracePeriod = 5 * time.Second
+
+// lastSeenInterval is how often a connected user's last_seen_at is refreshed.
+// It's also written on disconnect, so this only bounds how stale it can get
+// if the server dies with the user connected.
+const lastSeenInterval = 5 * time.Minute
+
+// recordLastSeen updates a user's last_seen_at, logging (not failing) on error.
+func recordLastSeen(userID string) {
+	if err := db.UpdateLastSeen(userID); err != nil {
+		log.Printf("Failed to update last seen for %s: %v", userID, err)
+	}
+}
+
+// PresenceMessage tells a user's contacts that they came online or went offline.
+type PresenceMessage struct {
+	Type   string `json:"type"` // "presence"
+	UserID string `json:"user_id"`
+	Online bool   `json:"online"`
+}
+
+// userConnected is called by Run, with h.mutex held, when a user's client registers.
+// wasConnected reports whether they already had a client (being replaced).
+func (h *Hub) userConnected(userID string, wasConnected bool) {
+	if timer, pending := h.offlineTimers[userID]; pending {
+		// Reconnected within the grace period; contacts never saw them leave.
+		timer.Stop()
+		delete(h.offlineTimers, userID)
+		return
+	}
+	if wasConnected {
+		return
+	}
+
+	// Broadcasting goes through h.broadcast, which Run drains, so never do it inline.
+	go h.broadcastPresence(userID, true)
+}
+
+// userDisconnected is called by Run, with h.mutex held, when a user's last
+// client unregisters. The offline event is sent after presenceGracePeriod
+// unless the user reconnects first.
+func (h *Hub) userDisconnected(userID string) {
+	// Don't hold up the hub (and h.mutex) on the database.
+	go recordLastSeen(userID)
+
+	var timer *time.Timer
+	timer = time.AfterFunc(presenceGracePeriod, func() {
+		h.mutex.Lock()
+		_, online := h.clients[userID]
+		current := h.offlineTimers[userID] == timer
+		if current {
+			delete(h.offlineTimers, userID)
+		}
+		h.mutex.Unlock()
+
+		if current && !online {
+			h.broadcastPresence(userID, false)
+		}
+	})
+	h.offlineTimers[userID] = timer
+}
+
+// broadcastPresence sends a presence event to every connected user who shares
+// a conversation with userID.
+func (h *Hub) broadcastPresence(userID string, online bool) {
+	contacts, err := db.GetContactUserIDs(userID)
+	if err != nil {
+		log.Printf("Failed to get contacts for presence: %v", err)
+		return
+	}
+
+	// Users blocked by userID don't get to see them come and go.
+	blocked, err := db.GetBlockedIDs(userID)
+	if err != nil {
+		log.Printf("Failed to get blocked users for presence: %v", err)
+		return
+	}
+
+	presence := PresenceMessage{Type: "presence", UserID: userID, Online: online}
+	for _, contactID := range contacts {
+		if !h.IsUserOnline(contactID) || slices.Contains(blocked, contactID) {
+			continue
+		}
+		if err := h.SendToUser(contactID, presence); err != nil {
+			log.Printf("Failed to send presence to %s: %v", contactID, err)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+// Package websocket - read receipts
+package websocket
+
+import (
+	"log"
+	"time"
+
+	"chatgo/internal/db"
+	"chatgo/internal/models"
+)
+
+// ReadReceiptMessage tells a conversation how far one participant has read.
+type ReadReceiptMessage struct {
+	Type           string `json:"type"` // "read_receipt"
+	ConversationID string `json:"conversation_id"`
+	UserID         string `json:"user_id"`
+	MessageID      string `json:"message_id"` // Last message read
+	Seq            int64  `json:"seq"`
+	ReadAt         string `json:"read_at"`
+}
+
+// handleReadMessage processes a "read" frame, sent by clients when the user
+// views a conversation. message_id is the newest message they've seen.
+func (c *Client) handleReadMessage(msg IncomingMessage) {
+	if msg.MessageID == "" {
+		log.Printf("User %s sent read without message_id", c.UserID)
+		c.sendError(ErrCodeInvalidRequest, "message_id required", msg.ClientMsgID)
+		return
+	}
+
+	isParticipant, err := db.IsUserInConversation(c.UserID, msg.ConversationID)
+	if err != nil || !isParticipant {
+		log.Printf("User %s not in conversation %s", c.UserID, msg.ConversationID)
+		c.sendError(ErrCodeNotParticipant, "not a participant in this conversation", msg.ClientMsgID)
+		return
+	}
+
+	state, err := db.MarkConversationRead(c.UserID, msg.ConversationID, msg.MessageID)
+	if err != nil {
+		log.Printf("Failed to mark conversation read: %v", err)
+		c.sendError(ErrCodeInternal, "failed to mark conversation read", msg.ClientMsgID)
+		return
+	}
+	if state == nil {
+		// Already read that far (or not a message in this conversation).
+		return
+	}
+
+	c.hub.BroadcastReadReceipt(state)
+}
+
+// BroadcastReadReceipt tells the other participants of a conversation how
+// far a user has read in it. Nil-safe.
+func (h *Hub) BroadcastReadReceipt(state *models.ReadState) {
+	if h == nil {
+		return
+	}
+
+	receipt := ReadReceiptMessage{
+		Type:           "read_receipt",
+		ConversationID: state.ConversationID,
+		UserID:         state.UserID,
+		MessageID:      state.MessageID,
+		Seq:            state.Seq,
+		ReadAt:         state.ReadAt.UTC().Format(time.RFC3339),
+	}
+
+	// Only the other participants care that this user has read their messages.
+	participantIDs, err := db.GetConversationParticipantIDs(state.ConversationID)
+	if err != nil {
+		log.Printf("Failed to get conversation participants: %v", err)
+		return
+	}
+	for _, id := range participantIDs {
+		if id == state.UserID {
+			continue
+		}
+		if err := h.SendToUser(id, receipt); err != nil {
+			log.Printf("Failed to send read receipt to %s: %v", id, err)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+// Package websocket - token expiry enforcement for long-lived connections
+package websocket
+
+import (
+	"log"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"chatgo/internal/auth"
+)
+
+const (
+	// How long before the token expires we ask the client to reauthenticate.
+	reauthWindow = 5 * time.Minute
+
+	// CloseTokenExpired is the close code sent when a connection's token
+	// expired without a successful reauth. Codes 4000-4999 are for applications.
+	CloseTokenExpired = 4001
+
+	// CloseSessionRevoked is the close code sent when the server ends a
+	// user's connection, e.g. because their account was deactivated.
+	CloseSessionRevoked = 4003
+
+	// CloseSlowClient is the close code sent when a client fell so far behind
+	// that its send buffer filled up. It should reconnect and sync.
+	CloseSlowClient = 4004
+)
+
+// ReauthRequiredMessage asks the client to send a fresh token.
+type ReauthRequiredMessage struct {
+	Type      string `json:"type"` // "reauth_required"
+	ExpiresAt string `json:"expires_at"`
+}
+
+// ReauthResultMessage tells the client whether its reauth was accepted.
+type ReauthResultMessage struct {
+	Type      string `json:"type"` // "reauth_ok" or "reauth_failed"
+	ExpiresAt string `json:"expires_at,omitempty"`
+}
+
+// handleReauth processes a {"type":"reauth","token":...} frame.
+// The new token must be valid and belong to the same user; its expiry
+// then replaces the connection's current one.
+func (c *Client) handleReauth(msg IncomingMessage) {
+	claims, err := auth.ValidateToken(msg.Token)
+	if err != nil || claims.UserID != c.UserID {
+		log.Printf("Rejected reauth for %s: %v", c.UserID, err)
+		c.hub.SendToUser(c.UserID, ReauthResultMessage{Type: "reauth_failed"})
+		return
+	}
+
+	var expiry time.Time
+	if claims.ExpiresAt != nil {
+		expiry = claims.ExpiresAt.Time
+	}
+
+	c.tokenMutex.Lock()
+	c.tokenExpiry = expiry
+	c.reauthRequested = false
+	c.tokenMutex.Unlock()
+
+	result := ReauthResultMessage{Type: "reauth_ok"}
+	if !expiry.IsZero() {
+		result.ExpiresAt = expiry.UTC().Format(time.RFC3339)
+	}
+	c.hub.SendToUser(c.UserID, result)
+}
+
+// checkTokenExpiry asks for a reauth as the token nears expiry and closes
+// the connection once it has expired. Called from the write pump.
+// Returns false if the connection was closed.
+func (c *Client) checkTokenExpiry() bool {
+	c.tokenMutex.Lock()
+	expiry := c.tokenExpiry
+	askForReauth := false
+	if !expiry.IsZero() && !c.reauthRequested && time.Until(expiry) <= reauthWindow {
+		c.reauthRequested = true
+		askForReauth = true
+	}
+	c.tokenMutex.Unlock()
+
+	if expiry.IsZero() {
+		return true
+	}
+
+	// Same tolerance as ValidateToken, or a token accepted at connect could
+	// be cut off on the first check.
+	if time.Now().After(expiry.Add(auth.TokenLeeway)) {
+		log.Printf("Token expired for %s, closing connection", c.UserID)
+		c.conn.SetWriteDeadline(time.Now().Add(c.hub.config.WriteWait))
+		c.conn.WriteMessage(websocket.CloseMessage,
+			websocket.FormatCloseMessage(CloseTokenExpired, "token expired"))
+		return false
+	}
+
+	if askForReauth {
+		c.hub.SendToUser(c.UserID, ReauthRequiredMessage{
+			Type:      "reauth_required",
+			ExpiresAt: expiry.UTC().Format(time.RFC3339),
+		})
+	}
+	return true
+}
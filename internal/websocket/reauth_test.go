@@ -0,0 +1,80 @@
+package websocket
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"chatgo/internal/auth"
+)
+
+// reauthConfig checks tokens often, so tests needn't wait long.
+var reauthConfig = Config{TokenCheckPeriod: 20 * time.Millisecond}
+
+// dialExpiring connects as userID with a token that is already past its
+// expiry but still within the leeway, which runs out after about remaining.
+func dialExpiring(t *testing.T, hub *Hub, srv *httptest.Server, userID string, remaining time.Duration) *testConn {
+	t.Helper()
+	saved := auth.TokenTTL
+	auth.TokenTTL = remaining - auth.TokenLeeway
+	defer func() { auth.TokenTTL = saved }()
+	return dial(t, hub, srv, userID)
+}
+
+// freshToken issues a long-lived token for userID.
+func freshToken(t *testing.T, userID string) string {
+	t.Helper()
+	saved := auth.TokenTTL
+	auth.TokenTTL = time.Hour
+	defer func() { auth.TokenTTL = saved }()
+
+	token, err := auth.GenerateToken(userID, userID, false)
+	if err != nil {
+		t.Fatalf("GenerateToken: %v", err)
+	}
+	return token
+}
+
+func TestReauthExtendsSession(t *testing.T) {
+	newFakeChat(t)
+	hub, srv := startHub(t, reauthConfig)
+	alice := dialExpiring(t, hub, srv, "alice", 2*time.Second)
+
+	// The token is already inside the reauth window.
+	alice.next("reauth_required")
+
+	// Someone else's token doesn't count.
+	alice.send(IncomingMessage{Type: "reauth", Token: freshToken(t, "mallory")})
+	alice.next("reauth_failed")
+
+	alice.send(IncomingMessage{Type: "reauth", Token: freshToken(t, "alice")})
+	alice.next("reauth_ok")
+
+	// Well past the first token's expiry, the connection is still up.
+	alice.expectNone(3*time.Second, "reauth_required")
+	if !hub.IsUserOnline("alice") {
+		t.Error("alice was disconnected despite reauthenticating")
+	}
+}
+
+func TestMissingReauthClosesConnection(t *testing.T) {
+	newFakeChat(t)
+	hub, srv := startHub(t, reauthConfig)
+	alice := dialExpiring(t, hub, srv, "alice", 2*time.Second)
+	alice.next("reauth_required")
+
+	alice.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		_, _, err := alice.conn.ReadMessage()
+		if err == nil {
+			continue
+		}
+		if !websocket.IsCloseError(err, CloseTokenExpired) {
+			t.Fatalf("connection ended with %v, want close code %d", err, CloseTokenExpired)
+		}
+		break
+	}
+	waitFor(t, "alice to be disconnected", func() bool { return !hub.IsUserOnline("alice") })
+}
@@ -0,0 +1,49 @@
+// Package websocket - retention worker for expiring messages
+package websocket
+
+import (
+	"log"
+	"time"
+
+	"chatgo/internal/db"
+)
+
+// retentionInterval is how often the retention worker looks for expired messages.
+const retentionInterval = 10 * time.Second
+
+// MessageDeletedMessage is sent when a message is removed from a conversation.
+type MessageDeletedMessage struct {
+	Type           string `json:"type"` // "message_deleted"
+	ConversationID string `json:"conversation_id"`
+	MessageID      string `json:"message_id"`
+}
+
+// RunRetention periodically deletes expired messages and tells the
+// conversation's participants. This should be run in a goroutine.
+func (h *Hub) RunRetention() {
+	ticker := time.NewTicker(retentionInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		h.deleteExpiredMessages()
+	}
+}
+
+// deleteExpiredMessages runs one retention pass.
+func (h *Hub) deleteExpiredMessages() {
+	deleted, err := db.DeleteExpiredMessages()
+	if err != nil {
+		log.Printf("Retention: %v", err)
+		return
+	}
+
+	for _, msg := range deleted {
+		deletedMsg := MessageDeletedMessage{
+			Type:           "message_deleted",
+			ConversationID: msg.ConversationID,
+			MessageID:      msg.ID,
+		}
+
+		h.sendToConversation(msg.ConversationID, "", deletedMsg)
+	}
+}
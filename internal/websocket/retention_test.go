@@ -0,0 +1,55 @@
+package websocket
+
+import (
+	"database/sql/driver"
+	"testing"
+	"time"
+)
+
+func TestMessageExpiryMustBeInRange(t *testing.T) {
+	chat := newFakeChat(t)
+	chat.addConversation("conv-1", "alice", "bob")
+	hub, srv := startHub(t, Config{})
+	alice := dial(t, hub, srv, "alice")
+
+	tests := []struct {
+		name      string
+		expiresAt time.Time
+	}{
+		{"past", time.Now().Add(-time.Minute)},
+		{"too far", time.Now().Add(maxMessageLifetime + time.Hour)},
+	}
+	for _, tt := range tests {
+		alice.send(IncomingMessage{
+			Type: "message", ConversationID: "conv-1", Content: "gone soon",
+			ExpiresAt: &tt.expiresAt, ClientMsgID: tt.name,
+		})
+		if f := alice.next("nack"); f.ClientMsgID != tt.name {
+			t.Errorf("%s expiry: nack for %q", tt.name, f.ClientMsgID)
+		}
+		if f := alice.next("error"); f.Code != ErrCodeInvalidRequest {
+			t.Errorf("%s expiry: error code %q, want %s", tt.name, f.Code, ErrCodeInvalidRequest)
+		}
+	}
+	if calls := chat.fake.Calls("INSERT INTO messages"); len(calls) != 0 {
+		t.Errorf("%d messages stored, want none", len(calls))
+	}
+}
+
+func TestRetentionTellsMembersOfDeletedMessages(t *testing.T) {
+	chat := newFakeChat(t)
+	chat.addConversation("conv-1", "alice", "bob")
+	hub, srv := startHub(t, Config{})
+	alice := dial(t, hub, srv, "alice")
+	bob := dial(t, hub, srv, "bob")
+
+	chat.fake.OnRows("UPDATE messages SET deleted_at", []string{"id", "conversation_id"},
+		[]driver.Value{"conv-1-7", "conv-1"})
+	hub.deleteExpiredMessages()
+
+	for name, conn := range map[string]*testConn{"alice": alice, "bob": bob} {
+		if f := conn.next("message_deleted"); f.MessageID != "conv-1-7" || f.ConversationID != "conv-1" {
+			t.Errorf("%s got %+v, want conv-1-7 deleted", name, f)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+// Package websocket - traffic and connection counters for WebSocket clients
+package websocket
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"sync/atomic"
+)
+
+// Cumulative counters for every connection served by this process.
+// They're per-process, so behind a load balancer each server reports its own.
+var (
+	payloadBytes atomic.Uint64 // message bytes handed to the writer (before compression)
+	wireBytes    atomic.Uint64 // bytes actually written to the network (after compression)
+
+	totalConnections  atomic.Uint64 // connections registered with a hub, ever
+	activeConnections atomic.Int64  // connections registered right now
+	messagesSent      atomic.Uint64 // outgoing frames queued on a client's send buffer
+	messagesDropped   atomic.Uint64 // outgoing frames dropped because that buffer was full
+)
+
+// Stats is a snapshot of the WebSocket counters.
+type Stats struct {
+	PayloadBytes uint64 `json:"payload_bytes"`
+	WireBytes    uint64 `json:"wire_bytes"`
+	// WireBytes / PayloadBytes. Below 1 means compression is saving bandwidth.
+	// Wire bytes include frame headers, pings and the upgrade response,
+	// so without compression this sits slightly above 1.
+	CompressionRatio float64 `json:"compression_ratio"`
+
+	TotalConnections  uint64 `json:"total_connections"`
+	ActiveConnections int64  `json:"active_connections"`
+	MessagesSent      uint64 `json:"messages_sent"`
+	// A rising drop count means some clients can't keep up with what they're sent.
+	MessagesDropped uint64 `json:"messages_dropped"`
+}
+
+// GetStats returns the current counters.
+func GetStats() Stats {
+	stats := Stats{
+		PayloadBytes:      payloadBytes.Load(),
+		WireBytes:         wireBytes.Load(),
+		TotalConnections:  totalConnections.Load(),
+		ActiveConnections: activeConnections.Load(),
+		MessagesSent:      messagesSent.Load(),
+		MessagesDropped:   messagesDropped.Load(),
+	}
+	if stats.PayloadBytes > 0 {
+		stats.CompressionRatio = float64(stats.WireBytes) / float64(stats.PayloadBytes)
+	}
+	return stats
+}
+
+// countingConn counts bytes written to the underlying network connection.
+type countingConn struct {
+	net.Conn
+}
+
+func (c countingConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	wireBytes.Add(uint64(n))
+	return n, err
+}
+
+// countingResponseWriter hands the upgrader a counting connection when it
+// hijacks the HTTP connection, so every byte gorilla/websocket writes
+// (after any compression) goes through countingConn.
+type countingResponseWriter struct {
+	http.ResponseWriter
+}
+
+func (w countingResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+	conn, rw, err := h.Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+	return countingConn{conn}, rw, nil
+}
@@ -0,0 +1,23 @@
+package websocket
+
+import "testing"
+
+func TestByteCountersRiseWithTraffic(t *testing.T) {
+	chat := newFakeChat(t)
+	chat.addConversation("conv-1", "alice", "bob")
+	hub, srv := startHub(t, Config{})
+	alice := dial(t, hub, srv, "alice")
+	bob := dial(t, hub, srv, "bob")
+
+	before := GetStats()
+	alice.send(IncomingMessage{Type: "message", ConversationID: "conv-1", Content: "hello, bob"})
+	bob.next("message")
+
+	after := GetStats()
+	if after.PayloadBytes <= before.PayloadBytes {
+		t.Errorf("PayloadBytes = %d after the send, want more than %d", after.PayloadBytes, before.PayloadBytes)
+	}
+	if after.WireBytes <= before.WireBytes {
+		t.Errorf("WireBytes = %d after the send, want more than %d", after.WireBytes, before.WireBytes)
+	}
+}
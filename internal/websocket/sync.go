@@ -0,0 +1,64 @@
+// Package websocket - catching up on messages missed while offline
+package websocket
+
+import (
+	"log"
+
+	"chatgo/internal/db"
+	"chatgo/internal/models"
+)
+
+// maxSyncMessages is the most messages replayed by one "sync" request.
+// Clients further behind than this are told to reload over REST instead.
+const maxSyncMessages = 200
+
+// SyncMessage answers a "sync" request with every message the client missed.
+// If Reload is set, Messages is empty and the client should refetch its
+// conversations and history over REST.
+type SyncMessage struct {
+	Type     string        `json:"type"` // "sync"
+	Messages []ChatMessage `json:"messages"`
+	Reload   bool          `json:"reload,omitempty"`
+}
+
+// handleSync processes a "sync" frame, sent by clients right after connecting.
+// The client says where it is either with last_seen_message_id, or with
+// last_seen_seqs mapping conversation IDs to the highest seq it has there
+// (only those conversations are synced). The missed messages are sent back
+// in one frame, oldest first; clients should skip any they already have.
+func (c *Client) handleSync(msg IncomingMessage) {
+	reply := SyncMessage{Type: "sync", Messages: []ChatMessage{}}
+
+	// Ask for one more than we'll send, to tell whether the client is too far behind.
+	var messages []models.Message
+	var err error
+	switch {
+	case len(msg.LastSeenSeqs) > 0:
+		messages, err = db.GetMessagesAfterSeqs(c.UserID, msg.LastSeenSeqs, maxSyncMessages+1)
+	case msg.LastSeenMessageID != "":
+		messages, err = db.GetMessagesSince(c.UserID, msg.LastSeenMessageID, maxSyncMessages+1)
+	default:
+		// Nothing to sync from.
+		reply.Reload = true
+		c.hub.SendToUser(c.UserID, reply)
+		return
+	}
+	if err != nil {
+		if err != db.ErrMessageNotFound {
+			log.Printf("Failed to sync messages for %s: %v", c.UserID, err)
+		}
+		reply.Reload = true
+		c.hub.SendToUser(c.UserID, reply)
+		return
+	}
+
+	if len(messages) > maxSyncMessages {
+		reply.Reload = true
+	} else {
+		for i := range messages {
+			reply.Messages = append(reply.Messages, newChatMessage(&messages[i]))
+		}
+	}
+
+	c.hub.SendToUser(c.UserID, reply)
+}
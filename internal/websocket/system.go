@@ -0,0 +1,28 @@
+// Package websocket - automated system messages
+package websocket
+
+import (
+	"chatgo/internal/db"
+)
+
+// PostSystemMessage stores a message from the system user in a conversation
+// and broadcasts it to all participants. Use it for membership notices and
+// announcements. A nil hub still stores the message, it just isn't pushed.
+func (h *Hub) PostSystemMessage(conversationID, content string) error {
+	if h == nil {
+		_, err := db.CreateSystemMessage(conversationID, content)
+		return err
+	}
+
+	// Same ordering guarantee as user messages.
+	unlock := h.lockConversation(conversationID)
+	defer unlock()
+
+	savedMsg, err := db.CreateSystemMessage(conversationID, content)
+	if err != nil {
+		return err
+	}
+
+	h.sendToConversation(conversationID, savedMsg.ID, newChatMessage(savedMsg))
+	return nil
+}
@@ -0,0 +1,27 @@
+package websocket
+
+import (
+	"testing"
+
+	"chatgo/internal/db"
+)
+
+func TestSystemMessageReachesMembers(t *testing.T) {
+	chat := newFakeChat(t)
+	chat.addConversation("conv-1", "alice", "bob", "carol")
+	hub, srv := startHub(t, Config{})
+	conns := map[string]*testConn{
+		"alice": dial(t, hub, srv, "alice"),
+		"bob":   dial(t, hub, srv, "bob"),
+	}
+
+	if err := hub.PostSystemMessage("conv-1", "carol joined"); err != nil {
+		t.Fatalf("PostSystemMessage: %v", err)
+	}
+	for name, conn := range conns {
+		f := conn.next("message")
+		if !f.IsSystem || f.SenderID != db.SystemUserID || f.Content != "carol joined" {
+			t.Errorf("%s got %+v, want the system message", name, f)
+		}
+	}
+}
@@ -0,0 +1,210 @@
+// Package websocket - typing indicator throttling
+package websocket
+
+import (
+	"log"
+	"time"
+
+	"chatgo/internal/db"
+)
+
+// typingThrottleInterval is the minimum time between typing broadcasts for one
+// client in one conversation. Events arriving faster are coalesced: only the
+// latest state is sent when the interval is up.
+const typingThrottleInterval = time.Second
+
+// typingThrottle tracks typing broadcasts for one conversation.
+type typingThrottle struct {
+	isTyping bool // Last state broadcast to the conversation
+	lastSent time.Time
+	pending  *bool       // Latest state waiting to be sent, if any
+	timer    *time.Timer // Fires when the pending state may be sent
+	expiry   *time.Timer // Fires after typingTimeout without a typing event
+}
+
+// throttleTyping sends a typing state now if the interval has passed,
+// or remembers it and sends the latest state once it has.
+func (c *Client) throttleTyping(conversationID string, isTyping bool) {
+	c.typingMutex.Lock()
+	_, tracked := c.typing[conversationID]
+	c.typingMutex.Unlock()
+
+	// Only conversations the user is in get throttle state, so typing events
+	// for made-up IDs can't grow c.typing.
+	if !tracked && !c.checkTypingMember(conversationID) {
+		return
+	}
+
+	c.typingMutex.Lock()
+	if c.closed {
+		c.typingMutex.Unlock()
+		return
+	}
+
+	t, exists := c.typing[conversationID]
+	if !exists {
+		t = &typingThrottle{}
+		c.typing[conversationID] = t
+	}
+
+	// Every "typing" event restarts the timeout; "stopped" cancels it.
+	if t.expiry != nil {
+		t.expiry.Stop()
+		t.expiry = nil
+	}
+	if isTyping {
+		var expiry *time.Timer
+		expiry = time.AfterFunc(typingTimeout, func() {
+			c.expireTyping(conversationID, expiry)
+		})
+		t.expiry = expiry
+	}
+
+	wait := typingThrottleInterval - time.Since(t.lastSent)
+	sendNow := wait <= 0 && t.timer == nil
+	if sendNow {
+		t.lastSent = time.Now()
+	} else {
+		// Too soon - keep only the most recent state.
+		t.pending = &isTyping
+		if t.timer == nil {
+			t.timer = time.AfterFunc(wait, func() {
+				c.flushTyping(conversationID)
+			})
+		}
+	}
+	c.typingMutex.Unlock()
+
+	if sendNow {
+		c.broadcastTyping(conversationID, isTyping)
+	}
+}
+
+// flushTyping sends the pending typing state for a conversation.
+func (c *Client) flushTyping(conversationID string) {
+	c.typingMutex.Lock()
+	t, exists := c.typing[conversationID]
+	if !exists || c.closed || t.pending == nil {
+		c.typingMutex.Unlock()
+		return
+	}
+	isTyping := *t.pending
+	t.pending = nil
+	t.timer = nil
+	t.lastSent = time.Now()
+	c.typingMutex.Unlock()
+
+	c.broadcastTyping(conversationID, isTyping)
+}
+
+// expireTyping clears typing state when a client's typing timeout fires.
+// expiry is the timer that fired: if a newer event replaced it in the
+// meantime, the client is still typing and nothing happens.
+func (c *Client) expireTyping(conversationID string, expiry *time.Timer) {
+	c.typingMutex.Lock()
+	t, exists := c.typing[conversationID]
+	current := exists && !c.closed && t.expiry == expiry
+	c.typingMutex.Unlock()
+
+	if current {
+		c.clearTyping(conversationID)
+	}
+}
+
+// stopTyping cancels pending typing broadcasts. Called when the client closes.
+func (c *Client) stopTyping() {
+	c.typingMutex.Lock()
+	defer c.typingMutex.Unlock()
+
+	c.closed = true
+	for _, t := range c.typing {
+		if t.timer != nil {
+			t.timer.Stop()
+		}
+		if t.expiry != nil {
+			t.expiry.Stop()
+		}
+	}
+}
+
+// checkTypingMember reports whether the user is in a conversation,
+// sending the client an error if not.
+func (c *Client) checkTypingMember(conversationID string) bool {
+	isParticipant, err := db.IsUserInConversation(c.UserID, conversationID)
+	if err != nil || !isParticipant {
+		log.Printf("User %s not in conversation %s", c.UserID, conversationID)
+		c.sendError(ErrCodeNotParticipant, "not a participant in this conversation", "")
+		return false
+	}
+	return true
+}
+
+// broadcastTyping sends a typing notification to the conversation's participants.
+func (c *Client) broadcastTyping(conversationID string, isTyping bool) {
+	// Checked again on every send: the user may have been removed since.
+	if !c.checkTypingMember(conversationID) {
+		return
+	}
+
+	c.typingMutex.Lock()
+	if t, exists := c.typing[conversationID]; exists {
+		t.isTyping = isTyping
+	}
+	c.typingMutex.Unlock()
+
+	c.sendTyping(conversationID, isTyping)
+}
+
+// clearTyping cancels any pending typing state for a conversation, drops
+// its throttle state and, if the client was shown as typing there,
+// broadcasts a stop. Unlike broadcastTyping it skips the membership check,
+// so it also works right after the user was removed from the conversation.
+func (c *Client) clearTyping(conversationID string) {
+	c.typingMutex.Lock()
+	wasTyping := false
+	if t, exists := c.typing[conversationID]; exists {
+		wasTyping = t.isTyping
+		if t.timer != nil {
+			t.timer.Stop()
+		}
+		if t.expiry != nil {
+			t.expiry.Stop()
+		}
+		delete(c.typing, conversationID)
+	}
+	c.typingMutex.Unlock()
+
+	if wasTyping {
+		c.sendTyping(conversationID, false)
+	}
+}
+
+// clearAllTyping clears typing state in every conversation.
+// Called when the connection goes away so nobody sees a stuck indicator.
+func (c *Client) clearAllTyping() {
+	c.typingMutex.Lock()
+	conversationIDs := make([]string, 0, len(c.typing))
+	for id := range c.typing {
+		conversationIDs = append(conversationIDs, id)
+	}
+	c.typingMutex.Unlock()
+
+	for _, id := range conversationIDs {
+		c.clearTyping(id)
+	}
+}
+
+// sendTyping fans a typing notification out to the conversation.
+func (c *Client) sendTyping(conversationID string, isTyping bool) {
+	typingMsg := TypingMessage{
+		Type:           "typing",
+		ConversationID: conversationID,
+		UserID:         c.UserID,
+		Username:       c.Username,
+		IsTyping:       isTyping,
+	}
+
+	// Send to all other participants (the typer knows they're typing),
+	// except those the typer has blocked.
+	c.sendToConversationParticipants(conversationID, "", typingMsg, append(c.blocking(), c.UserID))
+}
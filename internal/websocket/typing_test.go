@@ -0,0 +1,179 @@
+package websocket
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+// nextFrame returns the next frame of one of the given types queued for
+// client, skipping others, or fails the test if none is queued within wait.
+func nextFrame(t *testing.T, client *Client, wait time.Duration, types ...string) frame {
+	t.Helper()
+	timeout := time.After(wait)
+	for {
+		select {
+		case data := <-client.send:
+			var f frame
+			if err := json.Unmarshal(data, &f); err != nil {
+				t.Fatalf("bad frame %s: %v", data, err)
+			}
+			for _, typ := range types {
+				if f.Type == typ {
+					return f
+				}
+			}
+		case <-timeout:
+			t.Fatalf("no %v frame for %s within %v", types, client.UserID, wait)
+		}
+	}
+}
+
+// noFrame fails the test if a frame of one of the given types is queued
+// for client within wait.
+func noFrame(t *testing.T, client *Client, wait time.Duration, types ...string) {
+	t.Helper()
+	timeout := time.After(wait)
+	for {
+		select {
+		case data := <-client.send:
+			var f frame
+			if err := json.Unmarshal(data, &f); err != nil {
+				t.Fatalf("bad frame %s: %v", data, err)
+			}
+			for _, typ := range types {
+				if f.Type == typ {
+					t.Fatalf("unexpected %s frame for %s: %+v", f.Type, client.UserID, f)
+				}
+			}
+		case <-timeout:
+			return
+		}
+	}
+}
+
+func TestTypingEventsAreCoalesced(t *testing.T) {
+	chat := newFakeChat(t)
+	chat.addConversation("conv-1", "typer", "watcher")
+	hub := NewHub(Config{})
+	go hub.Run()
+	typer := addTestClient(t, hub, "typer", 64)
+	watcher := addTestClient(t, hub, "watcher", 64)
+
+	// A burst of events inside one throttle interval...
+	for i := range 10 {
+		typer.throttleTyping("conv-1", i%2 == 0)
+	}
+
+	// ...goes out as the first state right away, then only the latest one.
+	first := nextFrame(t, watcher, time.Second, "typing")
+	if !first.IsTyping || first.UserID != "typer" {
+		t.Errorf("first typing frame = %+v, want typer is_typing:true", first)
+	}
+	last := nextFrame(t, watcher, 2*typingThrottleInterval, "typing")
+	if last.IsTyping {
+		t.Errorf("coalesced frame is_typing = true, want the latest state (false)")
+	}
+	noFrame(t, watcher, typingThrottleInterval+200*time.Millisecond, "typing")
+}
+
+func TestTypingInOtherConversationKeepsNoState(t *testing.T) {
+	chat := newFakeChat(t)
+	chat.addConversation("conv-1", "typer", "watcher")
+	hub := NewHub(Config{})
+	go hub.Run()
+	typer := addTestClient(t, hub, "typer", 64)
+
+	for _, id := range []string{"not-mine-1", "not-mine-2", "not-mine-3"} {
+		typer.throttleTyping(id, true)
+		if f := nextFrame(t, typer, time.Second, "error"); f.Code != ErrCodeNotParticipant {
+			t.Errorf("error code = %q, want %q", f.Code, ErrCodeNotParticipant)
+		}
+	}
+
+	typer.typingMutex.Lock()
+	n := len(typer.typing)
+	typer.typingMutex.Unlock()
+	if n != 0 {
+		t.Errorf("client tracks %d conversations it isn't in", n)
+	}
+}
+
+func TestClearTypingDropsThrottleState(t *testing.T) {
+	chat := newFakeChat(t)
+	chat.addConversation("conv-1", "typer", "watcher")
+	hub := NewHub(Config{})
+	go hub.Run()
+	typer := addTestClient(t, hub, "typer", 64)
+
+	typer.throttleTyping("conv-1", true)
+	typer.clearTyping("conv-1")
+
+	typer.typingMutex.Lock()
+	_, tracked := typer.typing["conv-1"]
+	typer.typingMutex.Unlock()
+	if tracked {
+		t.Error("conversation still tracked after clearTyping")
+	}
+}
+
+func TestRemovingTypingParticipantStopsTyping(t *testing.T) {
+	chat := newFakeChat(t)
+	chat.addConversation("conv-1", "typer", "watcher", "other")
+	hub := NewHub(Config{})
+	go hub.Run()
+	typer := addTestClient(t, hub, "typer", 64)
+	watcher := addTestClient(t, hub, "watcher", 64)
+
+	typer.throttleTyping("conv-1", true)
+	if f := nextFrame(t, watcher, time.Second, "typing"); !f.IsTyping {
+		t.Fatalf("watcher got %+v, want typer typing", f)
+	}
+
+	chat.addConversation("conv-1", "watcher", "other")
+	hub.NotifyParticipantRemoved("conv-1", "typer", "typer")
+
+	f := nextFrame(t, watcher, time.Second, "typing")
+	if f.IsTyping || f.UserID != "typer" || f.ConversationID != "conv-1" {
+		t.Errorf("watcher got %+v, want typer stopped typing in conv-1", f)
+	}
+	nextFrame(t, watcher, time.Second, "participant_removed")
+}
+
+func TestDisconnectStopsTyping(t *testing.T) {
+	chat := newFakeChat(t)
+	chat.addConversation("conv-1", "typer", "watcher")
+	hub, srv := startHub(t, Config{})
+	typer := dial(t, hub, srv, "typer")
+	watcher := dial(t, hub, srv, "watcher")
+
+	typer.send(IncomingMessage{Type: "typing", ConversationID: "conv-1", IsTyping: true})
+	if f := watcher.next("typing"); !f.IsTyping {
+		t.Fatalf("watcher got %+v, want typer typing", f)
+	}
+
+	typer.conn.Close()
+	if f := watcher.next("typing"); f.IsTyping || f.UserID != "typer" {
+		t.Errorf("watcher got %+v, want typer stopped typing", f)
+	}
+}
+
+func TestTyperDoesNotGetOwnTypingEvent(t *testing.T) {
+	chat := newFakeChat(t)
+	chat.addConversation("conv-1", "typer", "watcher")
+	hub, srv := startHub(t, Config{})
+	typer := dial(t, hub, srv, "typer")
+	watcher := dial(t, hub, srv, "watcher")
+
+	typer.send(IncomingMessage{Type: "typing", ConversationID: "conv-1", IsTyping: true})
+	if f := watcher.next("typing"); !f.IsTyping || f.UserID != "typer" {
+		t.Fatalf("watcher got %+v, want typer typing", f)
+	}
+
+	// Messages do echo back, so the sender sees theirs land.
+	typer.send(IncomingMessage{Type: "message", ConversationID: "conv-1", Content: "hi"})
+	if f := typer.next("message", "typing"); f.Type != "message" {
+		t.Errorf("typer got its own %s event", f.Type)
+	}
+	typer.expectNone(typingThrottleInterval+200*time.Millisecond, "typing")
+}
@@ -0,0 +1,18 @@
+-- Migration: Create refresh tokens table
+-- Refresh tokens are long-lived and exchanged for new access tokens.
+-- We only store a SHA-256 hash of each token, never the token itself.
+
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    token_hash VARCHAR(64) UNIQUE NOT NULL,
+    created_at TIMESTAMP DEFAULT NOW(),
+
+    -- Updated on every refresh; used to expire idle sessions
+    last_used_at TIMESTAMP DEFAULT NOW(),
+
+    expires_at TIMESTAMP NOT NULL,
+    revoked_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_user ON refresh_tokens(user_id);
@@ -0,0 +1,15 @@
+-- Migration: Create invites table
+-- Admins create invites; users self-register with them (when enabled).
+-- Like refresh tokens, only a SHA-256 hash of the invite token is stored.
+
+CREATE TABLE IF NOT EXISTS invites (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    token_hash VARCHAR(64) UNIQUE NOT NULL,
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP DEFAULT NOW(),
+    expires_at TIMESTAMP NOT NULL,
+
+    -- Set when the invite is consumed; an invite can only be used once
+    used_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    used_at TIMESTAMP
+);
@@ -0,0 +1,24 @@
+-- Migration: Add a per-conversation message sequence number
+-- seq increases by one for every message in a conversation, giving clients an
+-- authoritative order even when created_at values tie.
+
+-- last_seq holds the highest seq handed out; bumping it locks the conversation row,
+-- which serializes concurrent inserts into the same conversation.
+ALTER TABLE conversations ADD COLUMN IF NOT EXISTS last_seq BIGINT NOT NULL DEFAULT 0;
+
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS seq BIGINT;
+
+-- Number existing messages in their current order
+UPDATE messages m SET seq = numbered.rn
+FROM (
+    SELECT id, ROW_NUMBER() OVER (PARTITION BY conversation_id ORDER BY created_at, id) AS rn
+    FROM messages
+) numbered
+WHERE m.id = numbered.id AND m.seq IS NULL;
+
+UPDATE conversations c
+SET last_seq = COALESCE((SELECT MAX(seq) FROM messages WHERE conversation_id = c.id), 0);
+
+ALTER TABLE messages ALTER COLUMN seq SET NOT NULL;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_messages_conversation_seq ON messages(conversation_id, seq);
@@ -0,0 +1,4 @@
+-- Migration: Add is_bot flag to users
+-- Bot accounts post messages automatically; they're hidden from user pickers by default.
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS is_bot BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,14 @@
+-- Migration: Create message deliveries table
+-- Records, per recipient, what happened when the hub tried to push a message.
+-- Best-effort diagnostics for "my message didn't arrive" reports.
+
+CREATE TABLE IF NOT EXISTS message_deliveries (
+    message_id UUID REFERENCES messages(id) ON DELETE CASCADE,
+    user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+
+    -- 'delivered' (queued to a live connection), 'offline' or 'dropped' (send buffer full)
+    status VARCHAR(20) NOT NULL,
+
+    recorded_at TIMESTAMP DEFAULT NOW(),
+    PRIMARY KEY (message_id, user_id)
+);
@@ -0,0 +1,10 @@
+-- Migration: Add per-message expiry and soft deletes
+-- Senders can give a message an expires_at; the retention worker soft-deletes
+-- it (sets deleted_at and clears the content) once that time has passed.
+
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS expires_at TIMESTAMP;
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP;
+
+-- The retention worker only looks at live messages that have an expiry
+CREATE INDEX IF NOT EXISTS idx_messages_expires_at ON messages(expires_at)
+    WHERE expires_at IS NOT NULL AND deleted_at IS NULL;
@@ -0,0 +1,4 @@
+-- Migration: Add a role to conversation participants
+-- 'owner' is the user who created a group; everyone else is a 'member'.
+
+ALTER TABLE conversation_participants ADD COLUMN IF NOT EXISTS role VARCHAR(20) NOT NULL DEFAULT 'member';
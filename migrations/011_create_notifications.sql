@@ -0,0 +1,16 @@
+-- Migration: Create notifications table
+-- Durable per-user notifications (added to a group, password reset, ...).
+-- They survive offline periods until the user acknowledges them.
+
+CREATE TABLE IF NOT EXISTS notifications (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    type VARCHAR(50) NOT NULL,
+    payload JSONB NOT NULL DEFAULT '{}',
+    created_at TIMESTAMP DEFAULT NOW(),
+    acked_at TIMESTAMP
+);
+
+-- Index for listing a user's unacknowledged notifications
+CREATE INDEX IF NOT EXISTS idx_notifications_user ON notifications(user_id, created_at)
+    WHERE acked_at IS NULL;
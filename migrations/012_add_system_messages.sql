@@ -0,0 +1,10 @@
+-- Migration: Add a reserved system user and system messages
+-- Automated messages (membership changes, announcements) are sent by this user.
+-- It can't log in: '!' is not a valid bcrypt hash, so no password ever matches.
+-- It is flagged as a bot so it stays out of user lists.
+
+INSERT INTO users (id, username, password_hash, is_admin, is_bot)
+VALUES ('00000000-0000-0000-0000-000000000001', 'system', '!', FALSE, TRUE)
+ON CONFLICT DO NOTHING;
+
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS is_system BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,9 @@
+-- Migration: Store whether a conversation is a group
+-- Previously this was guessed from the name and participant count.
+
+ALTER TABLE conversations ADD COLUMN IF NOT EXISTS is_group BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Backfill using the old rule: a group has a name OR more than 2 participants
+UPDATE conversations c SET is_group = TRUE
+WHERE c.name IS NOT NULL
+   OR (SELECT COUNT(*) FROM conversation_participants WHERE conversation_id = c.id) > 2;
@@ -0,0 +1,4 @@
+-- Migration: Add a read-only flag to conversations
+-- In a read-only conversation only the owner can post.
+
+ALTER TABLE conversations ADD COLUMN IF NOT EXISTS read_only BOOLEAN NOT NULL DEFAULT FALSE;
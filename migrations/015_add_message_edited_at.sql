@@ -0,0 +1,4 @@
+-- Migration: Track when a message was last edited
+-- NULL means the message has never been edited.
+
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS edited_at TIMESTAMP;
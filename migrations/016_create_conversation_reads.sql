@@ -0,0 +1,12 @@
+-- Migration: Create conversation reads table for read receipts
+-- One row per user per conversation: the last message that user has read.
+-- Everything up to and including last_read_seq counts as read.
+
+CREATE TABLE IF NOT EXISTS conversation_reads (
+    user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+    conversation_id UUID REFERENCES conversations(id) ON DELETE CASCADE,
+    last_read_message_id UUID NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+    last_read_seq BIGINT NOT NULL,
+    read_at TIMESTAMP DEFAULT NOW(),
+    PRIMARY KEY (user_id, conversation_id)
+);
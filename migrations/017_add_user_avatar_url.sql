@@ -0,0 +1,4 @@
+-- Migration: Optional avatar image URL per user
+-- Empty string means no avatar. The image itself is hosted elsewhere.
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS avatar_url TEXT NOT NULL DEFAULT '';
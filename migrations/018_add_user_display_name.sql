@@ -0,0 +1,8 @@
+-- Migration: Display name, separate from the login username
+-- Existing users start with their username; new users get it at insert time.
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS display_name TEXT;
+
+UPDATE users SET display_name = username WHERE display_name IS NULL;
+
+ALTER TABLE users ALTER COLUMN display_name SET NOT NULL;
@@ -0,0 +1,4 @@
+-- Migration: Let admins deactivate users instead of deleting them
+-- Inactive users can't log in, but their messages and username are kept.
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS is_active BOOLEAN NOT NULL DEFAULT TRUE;
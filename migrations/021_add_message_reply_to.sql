@@ -0,0 +1,6 @@
+-- Migration: Let a message reply to an earlier message in the same conversation
+-- NULL means the message isn't a reply.
+
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS reply_to_message_id UUID REFERENCES messages(id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS idx_messages_reply_to ON messages(reply_to_message_id);
@@ -0,0 +1,6 @@
+-- Migration: Make usernames unique regardless of case
+-- "alice" and "Alice" are now the same user; the stored casing is kept for display.
+-- Fails if two existing users differ only in case - rename one of them first:
+--   SELECT LOWER(username) FROM users GROUP BY 1 HAVING COUNT(*) > 1;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_username_lower ON users (LOWER(username));
@@ -0,0 +1,11 @@
+-- Migration: Per-user conversation settings
+-- One row per user per conversation, created the first time the user changes
+-- a setting; a missing row means the defaults (not muted).
+
+CREATE TABLE IF NOT EXISTS conversation_settings (
+    user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+    conversation_id UUID REFERENCES conversations(id) ON DELETE CASCADE,
+    muted BOOLEAN NOT NULL DEFAULT FALSE,
+    updated_at TIMESTAMP DEFAULT NOW(),
+    PRIMARY KEY (user_id, conversation_id)
+);
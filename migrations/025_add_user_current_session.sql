@@ -0,0 +1,5 @@
+-- Migration: Track each user's current session for single-session mode
+-- Holds the jti of the last access token issued to the user. Only consulted
+-- when CHATGO_SINGLE_SESSION=true; NULL means no session has been recorded.
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS current_session_id TEXT;
@@ -0,0 +1,5 @@
+-- Migration: Remember when each user was last connected
+-- Written by the WebSocket hub on disconnect and every few minutes while
+-- connected. NULL means the user has never connected.
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS last_seen_at TIMESTAMP;
@@ -0,0 +1,20 @@
+-- Migration: Remember when each conversation last had a message
+-- The conversation list sorts on this, most recent first. It's set by every
+-- message insert and starts at the conversation's creation. Deleting a message
+-- doesn't move it back.
+
+ALTER TABLE conversations ADD COLUMN IF NOT EXISTS last_message_at TIMESTAMP;
+
+UPDATE conversations c
+SET last_message_at = COALESCE(
+    (SELECT MAX(m.created_at) FROM messages m WHERE m.conversation_id = c.id AND m.deleted_at IS NULL),
+    c.created_at,
+    NOW()
+)
+WHERE last_message_at IS NULL;
+
+ALTER TABLE conversations ALTER COLUMN last_message_at SET DEFAULT NOW();
+ALTER TABLE conversations ALTER COLUMN last_message_at SET NOT NULL;
+
+-- ID breaks ties, matching the list's ORDER BY
+CREATE INDEX IF NOT EXISTS idx_conversations_last_message ON conversations(last_message_at DESC, id DESC);